@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAdminToken(t *testing.T) {
+	key := "adminkey"
+	now := time.Now()
+	claims := &AdminClaims{
+		Subject: "operator",
+		AppId:   "testapp",
+		Scopes:  []string{AdminScopeRead, AdminScopeKick},
+		Expire:  now.Add(time.Hour).Unix(),
+	}
+
+	token, err := GenerateAdminToken(key, claims)
+	if err != nil {
+		t.Fatalf("GenerateAdminToken: %+v", err)
+	}
+	if !IsAdminToken(token) {
+		t.Fatalf("IsAdminToken(%q) = false", token)
+	}
+
+	c, err := ValidAdminToken(token, key, now)
+	if err != nil {
+		t.Fatalf("ValidAdminToken: %+v", err)
+	}
+	if c.Subject != claims.Subject || c.AppId != claims.AppId {
+		t.Fatalf("claims = %#v, wants %#v", c, claims)
+	}
+	if !c.HasScope(AdminScopeKick) || c.HasScope(AdminScopeClose) {
+		t.Fatalf("invalid scopes: %v", c.Scopes)
+	}
+	if !c.AllowApp("testapp") || c.AllowApp("otherapp") {
+		t.Fatalf("invalid app: %v", c.AppId)
+	}
+
+	if _, err := ValidAdminToken(token, "invalidkey", now); err == nil {
+		t.Fatalf("ValidAdminToken must fail with invalid key")
+	}
+	if _, err := ValidAdminToken(token[:len(token)-2], key, now); err == nil {
+		t.Fatalf("ValidAdminToken must fail with broken token")
+	}
+	if _, err := ValidAdminToken(token, key, now.Add(2*time.Hour)); !errors.Is(err, ErrExpired) {
+		t.Fatalf("ValidAdminToken error = %v, wants %v", err, ErrExpired)
+	}
+}
@@ -73,6 +73,19 @@ func ValidAuthDataHash(authData, key, userId string) ([]byte, error) {
 	return data, nil
 }
 
+// AuthDataTime returns the timestamp in authData.
+// This function does not validate the hmac.
+func AuthDataTime(authData string) (time.Time, error) {
+	d, err := base64.StdEncoding.DecodeString(authData)
+	if err != nil {
+		return time.Time{}, xerrors.Errorf("decode base64: %w", err)
+	}
+	if len(d) != 8+8+32 {
+		return time.Time{}, xerrors.Errorf("too short: %v", len(d))
+	}
+	return time.Unix(int64(binary.BigEndian.Uint64(d[8:16])), 0), nil
+}
+
 // GenerateAuthData generates base64 encoded authdata.
 func GenerateAuthData(key, userId string, now time.Time) (string, error) {
 	d := make([]byte, 8+8+32)
@@ -1,6 +1,8 @@
 package binary
 
 import (
+	"time"
+
 	"wsnet2/pb"
 
 	"golang.org/x/xerrors"
@@ -17,6 +19,20 @@ const (
 	// | 24bit-be msg sequence number |
 	EvTypePeerReady EvType = 1 + iota
 	EvTypePong
+
+	// EvTypeClientStats : 各プレイヤーの接続品質 (Masterクライアントのみ)
+	// payload:
+	//  - Dict: client ID => UInts [rtt(ms), connect count, resend count, evbuf used, evbuf size]
+	EvTypeClientStats
+
+	// EvTypeSnapshot : evbufが溢れたクライアントに送る部屋の全状態
+	// payload:
+	//  - UInt: 後続のRegularEventの直前の通番
+	//  - str8: master ID
+	//  - Dict: client ID => Dict: player properties
+	//  - Dict: client ID => Dict: player private properties (受信者が見られるもののみ)
+	//  - EvRoomPropと同じ内容
+	EvTypeSnapshot
 )
 const (
 	// EvTypeJoined : クライアントが入室した
@@ -50,6 +66,7 @@ const (
 	// EvTypeMasterSwitched : Masterクライアントが切替わった
 	// payload:
 	//  - str8: new master client ID
+	//  - str8: cause
 	EvTypeMasterSwitched
 
 	// EvTypeMessage : その他の通常メッセージ
@@ -61,6 +78,58 @@ const (
 	//  - str8: client ID
 	//  - Dict: properties
 	EvTypeRejoined
+
+	// EvTypeNotice : サーバからのお知らせ
+	// payload:
+	//  - str16: message
+	EvTypeNotice
+
+	// EvTypeTurnChanged : ターン制の部屋で手番が移った
+	// payload:
+	//  - str8: active client ID
+	//  - UInt: turn number
+	//  - str8: cause
+	EvTypeTurnChanged
+
+	// EvTypeFrame : ロックステップのフレーム
+	// payload:
+	//  - UInt: frame number
+	//  - Dict: client ID => marshaled input (揃わなかった入力はNull)
+	EvTypeFrame
+
+	// EvTypeTimer : 部屋のタイマーが設定された
+	// payload:
+	//  - str8: timer name
+	//  - UInt: remaining (milli seconds). 0なら取り消された
+	//  - ULong: server time (unix time milli seconds)
+	EvTypeTimer
+
+	// EvTypeTimerExpired : 部屋のタイマーが満了した
+	// payload:
+	//  - str8: timer name
+	EvTypeTimerExpired
+
+	// EvTypeWatcherChat : 観戦者チャット. 同じHubの観戦者にだけ届く
+	// payload:
+	//  - str8: client ID
+	//  - str16: message
+	EvTypeWatcherChat
+
+	// EvTypeWatcherReaction : 観戦者のリアクション. 同じHubの観戦者にだけ届く
+	// payload:
+	//  - str8: client ID
+	//  - str8: reaction
+	EvTypeWatcherReaction
+
+	// EvTypeReactionCounts : Hub毎に集計した観戦者のリアクション. Playerにだけ届く
+	// payload:
+	//  - Dict: reaction => UInt count
+	EvTypeReactionCounts
+
+	// EvTypeWatcherChatChanged : 観戦者チャットの有効/無効が切り替わった. 観戦者にだけ届く
+	// payload:
+	//  - Bool: enabled
+	EvTypeWatcherChatChanged
 )
 const (
 	// EvTypeSucceeded:
@@ -148,6 +217,8 @@ func UnmarshalEvent(data []byte) (Event, int, error) {
 // SystemEvent (without sequence number)
 // - EvTypePeerReady
 // - EvTypePong
+// - EvTypeClientStats
+// - EvTypeSnapshot
 // binary format:
 // | 8bit MsgType | payload ... |
 type SystemEvent struct {
@@ -192,10 +263,14 @@ func UnmarshalEvPeerReadyPayload(payload []byte) (int, error) {
 // - unsigned 64bit-be: timestamp on ping sent.
 // - unsigned 32bit-be: watcher count in the room.
 // - dict: last msg timestamps of each player.
-func NewEvPong(pingtime uint64, watchers uint32, lastMsg Dict) *SystemEvent {
+// - unsigned 64bit-be: server time on pong sent (unix time micro seconds).
+//
+// server timeは後から追加したので、旧クライアントは読まずに無視する.
+func NewEvPong(pingtime uint64, watchers uint32, lastMsg Dict, now time.Time) *SystemEvent {
 	payload := MarshalULong(pingtime)
 	payload = append(payload, MarshalUInt(int64(watchers))...)
 	payload = append(payload, MarshalDict(lastMsg)...)
+	payload = append(payload, MarshalULong(uint64(now.UnixMicro()))...)
 
 	return &SystemEvent{
 		etype:   EvTypePong,
@@ -207,6 +282,7 @@ type EvPongPayload struct {
 	Timestamp    uint64
 	Watchers     uint32
 	LastMsgTimes Dict
+	ServerTime   time.Time // server timeを含まない旧形式ではゼロ値
 }
 
 func UnmarshalEvPongPayload(payload []byte) (*EvPongPayload, error) {
@@ -229,18 +305,174 @@ func UnmarshalEvPongPayload(payload []byte) (*EvPongPayload, error) {
 	payload = payload[l:]
 
 	// lastmsg
-	pp.LastMsgTimes, _, e = UnmarshalNullDict(payload)
+	pp.LastMsgTimes, l, e = UnmarshalNullDict(payload)
 	if e != nil {
 		return nil, xerrors.Errorf("Invalid EvPong payload (lastmsg): %w", e)
 	}
+	payload = payload[l:]
+
+	// server time
+	if len(payload) > 0 {
+		d, _, e = UnmarshalAs(payload, TypeULong)
+		if e != nil {
+			return nil, xerrors.Errorf("Invalid EvPong payload (server time): %w", e)
+		}
+		pp.ServerTime = time.UnixMicro(int64(d.(uint64)))
+	}
 
 	return &pp, nil
 }
 
+// ClientStats : EvClientStatsで通知する接続品質
+type ClientStats struct {
+	RTT          uint32 // milli seconds
+	ConnectCount uint32
+	ResendCount  uint32
+	EvBufUsed    uint32
+	EvBufSize    uint32
+}
+
+// NewEvClientStats : 接続品質イベント
+// payload:
+// - dict: client ID => UInts [rtt, connect count, resend count, evbuf used, evbuf size]
+func NewEvClientStats(stats map[string]ClientStats) *SystemEvent {
+	d := make(Dict, len(stats))
+	for id, s := range stats {
+		d[id] = MarshalUInts([]int64{
+			int64(s.RTT),
+			int64(s.ConnectCount),
+			int64(s.ResendCount),
+			int64(s.EvBufUsed),
+			int64(s.EvBufSize),
+		})
+	}
+
+	return &SystemEvent{
+		etype:   EvTypeClientStats,
+		payload: MarshalDict(d),
+	}
+}
+
+func UnmarshalEvClientStatsPayload(payload []byte) (map[string]ClientStats, error) {
+	d, _, e := UnmarshalNullDict(payload)
+	if e != nil {
+		return nil, xerrors.Errorf("Invalid EvClientStats payload: %w", e)
+	}
+
+	stats := make(map[string]ClientStats, len(d))
+	for id, b := range d {
+		v, _, e := UnmarshalAs(b, TypeUInts)
+		if e != nil {
+			return nil, xerrors.Errorf("Invalid EvClientStats payload (%v): %w", id, e)
+		}
+		vals := v.([]int64)
+		if len(vals) < 5 {
+			return nil, xerrors.Errorf("Invalid EvClientStats payload (%v): length=%v", id, len(vals))
+		}
+		stats[id] = ClientStats{
+			RTT:          uint32(vals[0]),
+			ConnectCount: uint32(vals[1]),
+			ResendCount:  uint32(vals[2]),
+			EvBufUsed:    uint32(vals[3]),
+			EvBufSize:    uint32(vals[4]),
+		}
+	}
+	return stats, nil
+}
+
+// NewEvSnapshot : 部屋の全状態のイベント
+// クライアントは状態を置き換え、以降のRegularEventをseqの続きから受け取る.
+// payload:
+// - UInt: event sequence number
+// - str8: master ID
+// - Dict: client ID => player properties (marshaled Dict)
+// - Dict: client ID => player private properties (marshaled Dict). 本人とMaster以外には含めない
+// - room properties (same as EvRoomProp)
+func NewEvSnapshot(seq int, masterId string, players, privates Dict, roomProp []byte) *SystemEvent {
+	payload := MarshalUInt(int64(seq))
+	payload = append(payload, MarshalStr8(masterId)...)
+	payload = append(payload, MarshalDict(players)...)
+	payload = append(payload, MarshalDict(privates)...)
+	payload = append(payload, roomProp...)
+
+	return &SystemEvent{
+		etype:   EvTypeSnapshot,
+		payload: payload,
+	}
+}
+
+type EvSnapshotPayload struct {
+	Seq      int
+	MasterId string
+	Players  map[string]Dict
+	// PrivateProps : 受信者が見られるPlayerのprivate propsのみ
+	PrivateProps map[string]Dict
+	Room         *EvRoomPropPayload
+}
+
+func UnmarshalEvSnapshotPayload(payload []byte) (*EvSnapshotPayload, error) {
+	sp := EvSnapshotPayload{}
+
+	// seq
+	d, l, e := UnmarshalAs(payload, TypeUInt)
+	if e != nil {
+		return nil, xerrors.Errorf("Invalid EvSnapshot payload (seq): %w", e)
+	}
+	sp.Seq = int(d.(int64))
+	payload = payload[l:]
+
+	// master id
+	d, l, e = UnmarshalAs(payload, TypeStr8)
+	if e != nil {
+		return nil, xerrors.Errorf("Invalid EvSnapshot payload (master id): %w", e)
+	}
+	sp.MasterId, _ = d.(string)
+	payload = payload[l:]
+
+	// players
+	players, l, e := UnmarshalNullDict(payload)
+	if e != nil {
+		return nil, xerrors.Errorf("Invalid EvSnapshot payload (players): %w", e)
+	}
+	sp.Players = make(map[string]Dict, len(players))
+	for id, b := range players {
+		props, _, e := UnmarshalNullDict(b)
+		if e != nil {
+			return nil, xerrors.Errorf("Invalid EvSnapshot payload (player %v): %w", id, e)
+		}
+		sp.Players[id] = props
+	}
+	payload = payload[l:]
+
+	// private props
+	privates, l, e := UnmarshalNullDict(payload)
+	if e != nil {
+		return nil, xerrors.Errorf("Invalid EvSnapshot payload (private props): %w", e)
+	}
+	sp.PrivateProps = make(map[string]Dict, len(privates))
+	for id, b := range privates {
+		props, _, e := UnmarshalNullDict(b)
+		if e != nil {
+			return nil, xerrors.Errorf("Invalid EvSnapshot payload (private props %v): %w", id, e)
+		}
+		sp.PrivateProps[id] = props
+	}
+	payload = payload[l:]
+
+	// room
+	sp.Room, e = UnmarshalEvRoomPropPayload(payload)
+	if e != nil {
+		return nil, xerrors.Errorf("Invalid EvSnapshot payload (room): %w", e)
+	}
+
+	return &sp, nil
+}
+
 // NewEvJoind : 入室イベント
 func NewEvJoined(cli *pb.ClientInfo) *RegularEvent {
 	payload := MarshalStr8(cli.Id)
-	payload = append(payload, cli.Props...) // cli.Props marshaled as TypeDict
+	payload = append(payload, cli.Props...)        // cli.Props marshaled as TypeDict
+	payload = append(payload, cli.PrivateProps...) // 本人とMasterに送るときのみ
 
 	return &RegularEvent{EvTypeJoined, payload}
 }
@@ -257,11 +489,21 @@ func UnmarshalEvJoinedPayload(payload []byte) (*pb.ClientInfo, error) {
 	payload = payload[l:]
 
 	// client props
-	_, _, e = UnmarshalNullDict(payload)
+	_, l, e = UnmarshalNullDict(payload)
 	if e != nil {
 		return nil, xerrors.Errorf("Invalid EvJoined payload (client props): %w", e)
 	}
-	um.Props = payload
+	um.Props = payload[:l]
+	payload = payload[l:]
+
+	// private props
+	if len(payload) > 0 {
+		_, _, e = UnmarshalNullDict(payload)
+		if e != nil {
+			return nil, xerrors.Errorf("Invalid EvJoined payload (private props): %w", e)
+		}
+		um.PrivateProps = payload
+	}
 
 	return &um, nil
 }
@@ -269,7 +511,8 @@ func UnmarshalEvJoinedPayload(payload []byte) (*pb.ClientInfo, error) {
 // NewEvRejoined : 再入室イベント
 func NewEvRejoined(cli *pb.ClientInfo) *RegularEvent {
 	payload := MarshalStr8(cli.Id)
-	payload = append(payload, cli.Props...) // cli.Props marshaled as TypeDict
+	payload = append(payload, cli.Props...)        // cli.Props marshaled as TypeDict
+	payload = append(payload, cli.PrivateProps...) // 本人とMasterに送るときのみ
 
 	return &RegularEvent{EvTypeRejoined, payload}
 }
@@ -286,11 +529,21 @@ func UnmarshalEvRejoinedPayload(payload []byte) (*pb.ClientInfo, error) {
 	payload = payload[l:]
 
 	// client props
-	_, _, e = UnmarshalNullDict(payload)
+	_, l, e = UnmarshalNullDict(payload)
 	if e != nil {
 		return nil, xerrors.Errorf("Invalid EvRejoined payload (client props): %w", e)
 	}
-	um.Props = payload
+	um.Props = payload[:l]
+	payload = payload[l:]
+
+	// private props
+	if len(payload) > 0 {
+		_, _, e = UnmarshalNullDict(payload)
+		if e != nil {
+			return nil, xerrors.Errorf("Invalid EvRejoined payload (private props): %w", e)
+		}
+		um.PrivateProps = payload
+	}
 
 	return &um, nil
 }
@@ -370,17 +623,21 @@ func UnmarshalEvRoomPropPayload(payload []byte) (*EvRoomPropPayload, error) {
 	}, nil
 }
 
-func NewEvClientProp(cliId string, props []byte) *RegularEvent {
-	payload := make([]byte, 0, len(cliId)+1+len(props))
+// NewEvClientProp : クライアントのプロパティ変更イベント.
+// privatePropsは本人とMasterにだけ送るイベントでのみ指定する.
+func NewEvClientProp(cliId string, props, privateProps []byte) *RegularEvent {
+	payload := make([]byte, 0, len(cliId)+1+len(props)+len(privateProps))
 	payload = append(payload, MarshalStr8(cliId)...)
 	payload = append(payload, props...)
+	payload = append(payload, privateProps...)
 
 	return &RegularEvent{EvTypeClientProp, payload}
 }
 
 type EvClientPropPayload struct {
-	Id    string
-	Props Dict
+	Id           string
+	Props        Dict
+	PrivateProps Dict // 本人とMaster以外にはnil
 }
 
 func UnmarshalEvClientPropPayload(payload []byte) (*EvClientPropPayload, error) {
@@ -395,25 +652,54 @@ func UnmarshalEvClientPropPayload(payload []byte) (*EvClientPropPayload, error)
 	payload = payload[l:]
 
 	// client props
-	um.Props, _, e = UnmarshalNullDict(payload)
+	um.Props, l, e = UnmarshalNullDict(payload)
 	if e != nil {
 		return nil, xerrors.Errorf("Invalid EvClientProp payload (client props): %w", e)
 	}
+	payload = payload[l:]
+
+	// private props
+	if len(payload) > 0 {
+		um.PrivateProps, _, e = UnmarshalNullDict(payload)
+		if e != nil {
+			return nil, xerrors.Errorf("Invalid EvClientProp payload (private props): %w", e)
+		}
+	}
 
 	return &um, nil
 }
 
-func NewEvMasterSwitched(cliId, masterId string) *RegularEvent {
-	return &RegularEvent{EvTypeMasterSwitched, MarshalStr8(masterId)}
+func NewEvMasterSwitched(cliId, masterId, cause string) *RegularEvent {
+	payload := MarshalStr8(masterId)
+	payload = append(payload, MarshalStr8(cause)...)
+	return &RegularEvent{EvTypeMasterSwitched, payload}
 }
 
-func UnmarshalEvMasterSwitchedPayload(payload []byte) (string, error) {
-	d, _, e := UnmarshalAs(payload, TypeStr8)
+type EvMasterSwitchedPayload struct {
+	MasterId string
+	Cause    string
+}
+
+func UnmarshalEvMasterSwitchedPayload(payload []byte) (*EvMasterSwitchedPayload, error) {
+	um := EvMasterSwitchedPayload{}
+
+	d, l, e := UnmarshalAs(payload, TypeStr8)
 	if e != nil {
-		return "", xerrors.Errorf("Invalid EvMasterSwitched payload (master id): %w", e)
+		return nil, xerrors.Errorf("Invalid EvMasterSwitched payload (master id): %w", e)
 	}
+	um.MasterId = d.(string)
+	payload = payload[l:]
 
-	return d.(string), nil
+	// causeの無い旧形式も受け付ける
+	if len(payload) > 0 {
+		d, _, e = UnmarshalAs(payload, TypeStr8)
+		if e != nil {
+			return nil, xerrors.Errorf("Invalid EvMasterSwitched payload (cause): %w", e)
+		}
+		um.Cause = d.(string)
+	}
+
+	return &um, nil
 }
 
 func NewEvMessage(cliId string, body []byte) *RegularEvent {
@@ -432,6 +718,128 @@ func UnmarshalEvMessage(payload []byte) (cliId string, body []byte, err error) {
 	return d.(string), payload[p:], nil
 }
 
+// NewEvNotice : サーバからのお知らせ
+func NewEvNotice(message string) *RegularEvent {
+	return &RegularEvent{EvTypeNotice, MarshalStr16(message)}
+}
+
+func UnmarshalEvNoticePayload(payload []byte) (string, error) {
+	d, _, e := UnmarshalAs(payload, TypeStr8, TypeStr16)
+	if e != nil {
+		return "", xerrors.Errorf("Invalid EvNotice payload (message): %w", e)
+	}
+	s, _ := d.(string)
+	return s, nil
+}
+
+func NewEvTurnChanged(activeId string, turn uint32, cause string) *RegularEvent {
+	payload := MarshalStr8(activeId)
+	payload = append(payload, MarshalUInt(int64(turn))...)
+	payload = append(payload, MarshalStr8(cause)...)
+	return &RegularEvent{EvTypeTurnChanged, payload}
+}
+
+type EvTurnChangedPayload struct {
+	ActiveId string
+	Turn     uint32
+	Cause    string
+}
+
+func UnmarshalEvTurnChangedPayload(payload []byte) (*EvTurnChangedPayload, error) {
+	um := EvTurnChangedPayload{}
+
+	d, l, e := UnmarshalAs(payload, TypeStr8)
+	if e != nil {
+		return nil, xerrors.Errorf("Invalid EvTurnChanged payload (active id): %w", e)
+	}
+	um.ActiveId = d.(string)
+	payload = payload[l:]
+
+	d, l, e = UnmarshalAs(payload, TypeUInt)
+	if e != nil {
+		return nil, xerrors.Errorf("Invalid EvTurnChanged payload (turn): %w", e)
+	}
+	um.Turn = uint32(d.(int64))
+	payload = payload[l:]
+
+	d, _, e = UnmarshalAs(payload, TypeStr8)
+	if e != nil {
+		return nil, xerrors.Errorf("Invalid EvTurnChanged payload (cause): %w", e)
+	}
+	um.Cause = d.(string)
+
+	return &um, nil
+}
+
+func NewEvFrame(frame uint32, inputs Dict) *RegularEvent {
+	payload := MarshalUInt(int64(frame))
+	payload = append(payload, MarshalDict(inputs)...)
+	return &RegularEvent{EvTypeFrame, payload}
+}
+
+func UnmarshalEvFramePayload(payload []byte) (uint32, Dict, error) {
+	d, l, e := UnmarshalAs(payload, TypeUInt)
+	if e != nil {
+		return 0, nil, xerrors.Errorf("Invalid EvFrame payload (frame): %w", e)
+	}
+	inputs, _, e := UnmarshalNullDict(payload[l:])
+	if e != nil {
+		return 0, nil, xerrors.Errorf("Invalid EvFrame payload (inputs): %w", e)
+	}
+	return uint32(d.(int64)), inputs, nil
+}
+
+func NewEvTimer(name string, remaining time.Duration, now time.Time) *RegularEvent {
+	payload := MarshalStr8(name)
+	payload = append(payload, MarshalUInt(remaining.Milliseconds())...)
+	payload = append(payload, MarshalULong(uint64(now.UnixMilli()))...)
+	return &RegularEvent{EvTypeTimer, payload}
+}
+
+type EvTimerPayload struct {
+	Name       string
+	Remaining  time.Duration
+	ServerTime time.Time
+}
+
+func UnmarshalEvTimerPayload(payload []byte) (*EvTimerPayload, error) {
+	um := EvTimerPayload{}
+
+	d, l, e := UnmarshalAs(payload, TypeStr8)
+	if e != nil {
+		return nil, xerrors.Errorf("Invalid EvTimer payload (name): %w", e)
+	}
+	um.Name = d.(string)
+	payload = payload[l:]
+
+	d, l, e = UnmarshalAs(payload, TypeUInt)
+	if e != nil {
+		return nil, xerrors.Errorf("Invalid EvTimer payload (remaining): %w", e)
+	}
+	um.Remaining = time.Duration(d.(int64)) * time.Millisecond
+	payload = payload[l:]
+
+	d, _, e = UnmarshalAs(payload, TypeULong)
+	if e != nil {
+		return nil, xerrors.Errorf("Invalid EvTimer payload (server time): %w", e)
+	}
+	um.ServerTime = time.UnixMilli(int64(d.(uint64)))
+
+	return &um, nil
+}
+
+func NewEvTimerExpired(name string) *RegularEvent {
+	return &RegularEvent{EvTypeTimerExpired, MarshalStr8(name)}
+}
+
+func UnmarshalEvTimerExpiredPayload(payload []byte) (string, error) {
+	d, _, e := UnmarshalAs(payload, TypeStr8)
+	if e != nil {
+		return "", xerrors.Errorf("Invalid EvTimerExpired payload (name): %w", e)
+	}
+	return d.(string), nil
+}
+
 // NewEvSucceeded : 成功イベント
 func NewEvSucceeded(msg RegularMsg) *RegularEvent {
 	payload := make([]byte, 3)
@@ -457,3 +865,77 @@ func NewEvTargetNotFound(msg RegularMsg, cliIds []string) *RegularEvent {
 	payload = append(payload, msg.Payload()...)
 	return &RegularEvent{EvTypeTargetNotFound, payload}
 }
+
+func NewEvWatcherChat(cliId, message string) *RegularEvent {
+	payload := MarshalStr8(cliId)
+	payload = append(payload, MarshalStr16(message)...)
+	return &RegularEvent{EvTypeWatcherChat, payload}
+}
+
+type EvWatcherChatPayload struct {
+	ClientId string
+	Message  string
+}
+
+func UnmarshalEvWatcherChatPayload(payload []byte) (*EvWatcherChatPayload, error) {
+	d, l, e := UnmarshalAs(payload, TypeStr8)
+	if e != nil {
+		return nil, xerrors.Errorf("Invalid EvWatcherChat payload (client id): %w", e)
+	}
+	um := EvWatcherChatPayload{ClientId: d.(string)}
+	d, _, e = UnmarshalAs(payload[l:], TypeStr16)
+	if e != nil {
+		return nil, xerrors.Errorf("Invalid EvWatcherChat payload (message): %w", e)
+	}
+	um.Message = d.(string)
+	return &um, nil
+}
+
+func NewEvWatcherReaction(cliId, reaction string) *RegularEvent {
+	payload := MarshalStr8(cliId)
+	payload = append(payload, MarshalStr8(reaction)...)
+	return &RegularEvent{EvTypeWatcherReaction, payload}
+}
+
+type EvWatcherReactionPayload struct {
+	ClientId string
+	Reaction string
+}
+
+func UnmarshalEvWatcherReactionPayload(payload []byte) (*EvWatcherReactionPayload, error) {
+	d, l, e := UnmarshalAs(payload, TypeStr8)
+	if e != nil {
+		return nil, xerrors.Errorf("Invalid EvWatcherReaction payload (client id): %w", e)
+	}
+	um := EvWatcherReactionPayload{ClientId: d.(string)}
+	d, _, e = UnmarshalAs(payload[l:], TypeStr8)
+	if e != nil {
+		return nil, xerrors.Errorf("Invalid EvWatcherReaction payload (reaction): %w", e)
+	}
+	um.Reaction = d.(string)
+	return &um, nil
+}
+
+func NewEvReactionCounts(counts map[string]uint32) *RegularEvent {
+	return &RegularEvent{EvTypeReactionCounts, MarshalReactionCountsPayload(counts)}
+}
+
+func UnmarshalEvReactionCountsPayload(payload []byte) (map[string]uint32, error) {
+	counts, e := UnmarshalReactionCountsPayload(payload)
+	if e != nil {
+		return nil, xerrors.Errorf("Invalid EvReactionCounts payload: %w", e)
+	}
+	return counts, nil
+}
+
+func NewEvWatcherChatChanged(enabled bool) *RegularEvent {
+	return &RegularEvent{EvTypeWatcherChatChanged, MarshalBool(enabled)}
+}
+
+func UnmarshalEvWatcherChatChangedPayload(payload []byte) (bool, error) {
+	d, _, e := UnmarshalAs(payload, TypeTrue, TypeFalse)
+	if e != nil {
+		return false, xerrors.Errorf("Invalid EvWatcherChatChanged payload (enabled): %w", e)
+	}
+	return d.(bool), nil
+}
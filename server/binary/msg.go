@@ -70,6 +70,7 @@ const (
 	// MsgTypeClientProp : 自身のプロパティの変更
 	// payload:
 	// - Dict: properties (modified keys only)
+	// - Dict: private properties (modified keys only, optional)
 	MsgTypeClientProp
 
 	// MsgTypeSwitchMaster : Masterクライアントの切替え
@@ -96,6 +97,55 @@ const (
 	// - str8: client id
 	// - string: message
 	MsgTypeKick
+
+	// MsgTypeSubmitResult : 試合結果の提出
+	// Playerからのみ有効. 部屋の終了時に全員の提出内容を突き合わせて記録する
+	// payload:
+	// - Dict: result
+	MsgTypeSubmitResult
+
+	// MsgTypeEndTurn : 手番を終える
+	// ターン制の部屋で手番のPlayerからのみ有効
+	// payload: (none)
+	MsgTypeEndTurn
+
+	// MsgTypeFrameInput : ロックステップのフレームの入力
+	// ロックステップの部屋のPlayerからのみ有効
+	// payload:
+	// - UInt: frame number
+	// - marshaled data...
+	MsgTypeFrameInput
+
+	// MsgTypeSetTimer : 部屋のタイマーの設定
+	// MasterClientからのみ有効. 同じ名前のタイマーは上書きする
+	// payload:
+	// - str8: timer name
+	// - UInt: duration (milli seconds). 0ならタイマーを取り消す
+	MsgTypeSetTimer
+
+	// MsgTypeWatcherChat : 観戦者チャット
+	// Hub経由の観戦者からのみ有効. 同じHubの観戦者にだけ届き、Gameサーバには送らない
+	// payload:
+	// - str16: message
+	MsgTypeWatcherChat
+
+	// MsgTypeWatcherReaction : 観戦者のリアクション
+	// Hub経由の観戦者からのみ有効. 同じHubの観戦者に届き、Hubが集計してPlayerに送る
+	// payload:
+	// - str8: reaction
+	MsgTypeWatcherReaction
+
+	// MsgTypeReactionCounts : 観戦者のリアクションの集計
+	// Hubからのみ有効
+	// payload:
+	// - Dict: reaction => UInt count
+	MsgTypeReactionCounts
+
+	// MsgTypeSetWatcherChat : 観戦者チャットの有効/無効の切り替え
+	// MasterClientからのみ有効
+	// payload:
+	// - Bool: enabled
+	MsgTypeSetWatcherChat
 )
 
 type nonregularMsg struct {
@@ -343,18 +393,32 @@ func GetRoomPropClientDeadline(payload []byte) (uint32, error) {
 	return uint32(v), e
 }
 
-// MarshalClientPropPayload marshals MsgClientProp payload
-func MarshalClientPropPayload(prop Dict) []byte {
-	return MarshalDict(prop)
+// MarshalClientPropPayload marshals MsgClientProp payload.
+// privatePropが空のときは省略する.
+func MarshalClientPropPayload(prop, privateProp Dict) []byte {
+	payload := MarshalDict(prop)
+	if len(privateProp) > 0 {
+		payload = append(payload, MarshalDict(privateProp)...)
+	}
+	return payload
 }
 
-// UnmarshalClientPropPayload unmarshals MsgClientProp payload
-func UnmarshalClientPropPayload(payload []byte) (Dict, error) {
-	d, _, e := UnmarshalNullDict(payload)
+// UnmarshalClientPropPayload unmarshals MsgClientProp payload.
+// private propsが省略されているときはnilを返す.
+func UnmarshalClientPropPayload(payload []byte) (prop, privateProp Dict, err error) {
+	prop, l, e := UnmarshalNullDict(payload)
 	if e != nil {
-		return nil, xerrors.Errorf("Invalid MsgClientProp payload (props): %w", e)
+		return nil, nil, xerrors.Errorf("Invalid MsgClientProp payload (props): %w", e)
 	}
-	return d, nil
+	payload = payload[l:]
+	if len(payload) == 0 {
+		return prop, nil, nil
+	}
+	privateProp, _, e = UnmarshalNullDict(payload)
+	if e != nil {
+		return nil, nil, xerrors.Errorf("Invalid MsgClientProp payload (private props): %w", e)
+	}
+	return prop, privateProp, nil
 }
 
 // MarshalSwitchMasterPayload marshals MsgSwitchMaster payload
@@ -411,6 +475,65 @@ func MarshalKickPayload(target, msg string) []byte {
 	return append(MarshalStr8(target), MarshalStr8(msg)...)
 }
 
+// MarshalSubmitResultPayload marshals MsgSubmitResult payload
+func MarshalSubmitResultPayload(result Dict) []byte {
+	return MarshalDict(result)
+}
+
+// UnmarshalSubmitResultPayload parses payload of MsgTypeSubmitResult
+//
+// 結果を突き合わせられるよう、Dictの中身まで再帰的にUnmarshalする
+func UnmarshalSubmitResultPayload(payload []byte) (map[string]any, error) {
+	if len(payload) == 0 {
+		return nil, xerrors.Errorf("Invalid MsgSubmitResult payload (result): empty")
+	}
+	u, l, e := unmarshalRecursive(payload)
+	if e != nil {
+		return nil, xerrors.Errorf("Invalid MsgSubmitResult payload (result): %w", e)
+	}
+	d, ok := u.(map[string]any)
+	if !ok {
+		return nil, xerrors.Errorf("Invalid MsgSubmitResult payload (result): not a dict: %T", u)
+	}
+	if l != len(payload) {
+		return nil, xerrors.Errorf("Invalid MsgSubmitResult payload (result): trailing data: %v bytes", len(payload)-l)
+	}
+	return d, nil
+}
+
+// MarshalFrameInputPayload marshals MsgFrameInput payload
+func MarshalFrameInputPayload(frame uint32, input []byte) []byte {
+	return append(MarshalUInt(int64(frame)), input...)
+}
+
+// UnmarshalFrameInputPayload parses payload of MsgTypeFrameInput
+func UnmarshalFrameInputPayload(payload []byte) (uint32, []byte, error) {
+	d, l, e := UnmarshalAs(payload, TypeUInt)
+	if e != nil {
+		return 0, nil, xerrors.Errorf("Invalid MsgFrameInput payload (frame): %w", e)
+	}
+	return uint32(d.(int64)), payload[l:], nil
+}
+
+// MarshalSetTimerPayload marshals MsgSetTimer payload
+func MarshalSetTimerPayload(name string, d time.Duration) []byte {
+	return append(MarshalStr8(name), MarshalUInt(d.Milliseconds())...)
+}
+
+// UnmarshalSetTimerPayload parses payload of MsgTypeSetTimer
+func UnmarshalSetTimerPayload(payload []byte) (string, time.Duration, error) {
+	d, l, e := UnmarshalAs(payload, TypeStr8)
+	if e != nil {
+		return "", 0, xerrors.Errorf("Invalid MsgSetTimer payload (name): %w", e)
+	}
+	name := d.(string)
+	d, _, e = UnmarshalAs(payload[l:], TypeUInt)
+	if e != nil {
+		return "", 0, xerrors.Errorf("Invalid MsgSetTimer payload (duration): %w", e)
+	}
+	return name, time.Duration(d.(int64)) * time.Millisecond, nil
+}
+
 // UnmarshalKickPayload parses payload of MsgTypeKick
 func UnmarshalKickPayload(payload []byte) (string, string, error) {
 	d, l, e := UnmarshalAs(payload, TypeStr8)
@@ -431,3 +554,71 @@ func UnmarshalKickPayload(payload []byte) (string, string, error) {
 
 	return d.(string), msg, nil
 }
+
+// MarshalWatcherChatPayload marshals MsgWatcherChat payload
+func MarshalWatcherChatPayload(message string) []byte {
+	return MarshalStr16(message)
+}
+
+// UnmarshalWatcherChatPayload parses payload of MsgTypeWatcherChat
+func UnmarshalWatcherChatPayload(payload []byte) (string, error) {
+	d, _, e := UnmarshalAs(payload, TypeStr16)
+	if e != nil {
+		return "", xerrors.Errorf("Invalid MsgWatcherChat payload (message): %w", e)
+	}
+	return d.(string), nil
+}
+
+// MarshalWatcherReactionPayload marshals MsgWatcherReaction payload
+func MarshalWatcherReactionPayload(reaction string) []byte {
+	return MarshalStr8(reaction)
+}
+
+// UnmarshalWatcherReactionPayload parses payload of MsgTypeWatcherReaction
+func UnmarshalWatcherReactionPayload(payload []byte) (string, error) {
+	d, _, e := UnmarshalAs(payload, TypeStr8)
+	if e != nil {
+		return "", xerrors.Errorf("Invalid MsgWatcherReaction payload (reaction): %w", e)
+	}
+	return d.(string), nil
+}
+
+// MarshalReactionCountsPayload marshals MsgReactionCounts payload
+func MarshalReactionCountsPayload(counts map[string]uint32) []byte {
+	dict := make(Dict, len(counts))
+	for k, n := range counts {
+		dict[k] = MarshalUInt(int64(n))
+	}
+	return MarshalDict(dict)
+}
+
+// UnmarshalReactionCountsPayload parses payload of MsgTypeReactionCounts
+func UnmarshalReactionCountsPayload(payload []byte) (map[string]uint32, error) {
+	dict, _, e := UnmarshalNullDict(payload)
+	if e != nil {
+		return nil, xerrors.Errorf("Invalid MsgReactionCounts payload: %w", e)
+	}
+	counts := make(map[string]uint32, len(dict))
+	for k, v := range dict {
+		d, _, e := UnmarshalAs(v, TypeUInt)
+		if e != nil {
+			return nil, xerrors.Errorf("Invalid MsgReactionCounts payload (%v): %w", k, e)
+		}
+		counts[k] = uint32(d.(int64))
+	}
+	return counts, nil
+}
+
+// MarshalSetWatcherChatPayload marshals MsgSetWatcherChat payload
+func MarshalSetWatcherChatPayload(enabled bool) []byte {
+	return MarshalBool(enabled)
+}
+
+// UnmarshalSetWatcherChatPayload parses payload of MsgTypeSetWatcherChat
+func UnmarshalSetWatcherChatPayload(payload []byte) (bool, error) {
+	d, _, e := UnmarshalAs(payload, TypeTrue, TypeFalse)
+	if e != nil {
+		return false, xerrors.Errorf("Invalid MsgSetWatcherChat payload (enabled): %w", e)
+	}
+	return d.(bool), nil
+}
@@ -2,7 +2,9 @@ package binary
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestUnmarshalNullDict(t *testing.T) {
@@ -113,8 +115,10 @@ func TestRoomPropPayload(t *testing.T) {
 
 func TestClientPropPayload(t *testing.T) {
 	tests := map[string]struct {
-		prop Dict
-		exp  Dict
+		prop    Dict
+		private Dict
+		exp     Dict
+		expPriv Dict
 	}{
 		"null": {
 			prop: nil,
@@ -124,16 +128,25 @@ func TestClientPropPayload(t *testing.T) {
 			prop: Dict{"a": MarshalBool(true), "b": MarshalNull()},
 			exp:  Dict{"a": MarshalBool(true), "b": MarshalNull()},
 		},
+		"private": {
+			prop:    Dict{"a": MarshalBool(true)},
+			private: Dict{"s": MarshalInt(1)},
+			exp:     Dict{"a": MarshalBool(true)},
+			expPriv: Dict{"s": MarshalInt(1)},
+		},
 	}
 	for k, tc := range tests {
-		p := MarshalClientPropPayload(tc.prop)
-		u, err := UnmarshalClientPropPayload(p)
+		p := MarshalClientPropPayload(tc.prop, tc.private)
+		u, priv, err := UnmarshalClientPropPayload(p)
 		if err != nil {
 			t.Fatalf("%v: %v", k, err)
 		}
 		if !reflect.DeepEqual(u, tc.exp) {
 			t.Fatalf("%v: %#v, watns %#v", k, u, tc.exp)
 		}
+		if !reflect.DeepEqual(priv, tc.expPriv) {
+			t.Fatalf("%v: private %#v, watns %#v", k, priv, tc.expPriv)
+		}
 	}
 }
 
@@ -149,3 +162,84 @@ func TestSwitchMasterPayload(t *testing.T) {
 		t.Fatalf("new master: %v, wants %v", u, newmaster)
 	}
 }
+
+func TestPingPayload(t *testing.T) {
+	now := time.Now()
+	ts := uint64(now.UnixMilli())
+
+	p, err := UnmarshalPingPayload(NewMsgPing(now).Payload())
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if p != ts {
+		t.Fatalf("timestamp: %v, wants %v", p, ts)
+	}
+}
+
+func TestSubmitResultPayload(t *testing.T) {
+	payload := MarshalSubmitResultPayload(Dict{"winner": MarshalStr8("p1")})
+	d, err := UnmarshalSubmitResultPayload(payload)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if d["winner"] != "p1" {
+		t.Fatalf("result: %v", d)
+	}
+
+	tests := map[string][]byte{
+		"not a dict":    MarshalStr8("p1"),
+		"trailing data": append(payload, MarshalInt(1)...),
+	}
+	for name, p := range tests {
+		if _, err := UnmarshalSubmitResultPayload(p); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("%v: error = %v", name, err)
+		}
+	}
+}
+
+func TestPongPayload(t *testing.T) {
+	now := time.Now()
+	lastMsg := Dict{"p1": MarshalULong(100)}
+
+	p, err := UnmarshalEvPongPayload(NewEvPong(10000, 3, lastMsg, now).Payload())
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if p.Timestamp != 10000 || p.Watchers != 3 || !reflect.DeepEqual(p.LastMsgTimes, lastMsg) {
+		t.Fatalf("payload: %+v", p)
+	}
+	if !p.ServerTime.Equal(now.Truncate(time.Microsecond)) {
+		t.Fatalf("ServerTime = %v, wants %v", p.ServerTime, now)
+	}
+
+	// server timeを含まない旧形式
+	old := MarshalULong(10000)
+	old = append(old, MarshalUInt(3)...)
+	old = append(old, MarshalDict(lastMsg)...)
+	p, err = UnmarshalEvPongPayload(old)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if p.Timestamp != 10000 || !p.ServerTime.IsZero() {
+		t.Fatalf("payload: %+v", p)
+	}
+}
+
+func TestReactionCountsPayload(t *testing.T) {
+	counts := map[string]uint32{"clap": 3, "fire": 1}
+	u, err := UnmarshalReactionCountsPayload(MarshalReactionCountsPayload(counts))
+	if err != nil {
+		t.Fatalf("UnmarshalReactionCountsPayload: %v", err)
+	}
+	if !reflect.DeepEqual(u, counts) {
+		t.Fatalf("counts = %v, wants %v", u, counts)
+	}
+
+	p, err := UnmarshalEvWatcherChatPayload(NewEvWatcherChat("w1", "hello").Payload())
+	if err != nil {
+		t.Fatalf("UnmarshalEvWatcherChatPayload: %v", err)
+	}
+	if p.ClientId != "w1" || p.Message != "hello" {
+		t.Fatalf("EvWatcherChat = %#v", p)
+	}
+}
@@ -14,11 +14,15 @@ type AccessInfo struct {
 	MACKey    string
 	Bearer    string
 	EncMACKey string
+
+	// Region : 近くのサーバを選ばせるための地域 (省略可)
+	Region string
 }
 
 // GenAccessinfo : AccessInfoを生成
 //
-// appkeyを知らないクライアントサイドは、この関数を使わずサーバから貰うこと
+// appkeyを知らないクライアントサイドは、この関数を使わずサーバから貰うこと.
+// サーバはLobbyの管理API(/_admin/token)で発行することもできる
 func GenAccessInfo(lobby, appid, appkey, userid string) (*AccessInfo, error) {
 	bearer, err := auth.GenerateAuthData(appkey, userid, time.Now())
 	if err != nil {
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// clockSamples : オフセット推定に使うPongの数
+	clockSamples = 8
+	// maxClockDrift : 推定するドリフトの上限 (1000ppm)
+	maxClockDrift = 1e-3
+)
+
+type clockSample struct {
+	local  time.Time     // Ping送信からPong受信までの中間時刻
+	rtt    time.Duration // Ping送信からPong受信までの時間
+	offset time.Duration // サーバ時刻 - local
+}
+
+// clockSync : Ping/Pongからサーバ時刻を推定する.
+//
+// NTPと同様に、Pongのサーバ時刻がPing送信とPong受信の中間時刻のものとみなしてオフセットを求める.
+// RTTが最小のサンプルを最も確からしいものとして基準にし、
+// サンプル全体のオフセットの傾きをドリフトとして補正する.
+type clockSync struct {
+	mu      sync.Mutex
+	sent    time.Time // 直近のPing送信時刻
+	samples []clockSample
+
+	base   time.Time
+	offset time.Duration
+	drift  float64
+}
+
+// ping : Pingの送信時刻を記録する
+func (c *clockSync) ping(sent time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = sent
+}
+
+// pong : Pongの受信時刻とサーバ時刻を記録する.
+// timestampはPingに載せた送信時刻 (unix milli seconds).
+func (c *clockSync) pong(timestamp uint64, recv, server time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Pingのtimestampはミリ秒精度なので、記録した送信時刻と一致すればそちらを使う
+	sent := c.sent
+	if uint64(sent.UnixMilli()) != timestamp {
+		sent = time.UnixMilli(int64(timestamp))
+	}
+	c.add(sent, recv, server)
+}
+
+func (c *clockSync) add(sent, recv, server time.Time) {
+	rtt := recv.Sub(sent)
+	if rtt < 0 {
+		return
+	}
+	local := sent.Add(rtt / 2)
+	c.samples = append(c.samples, clockSample{
+		local:  local,
+		rtt:    rtt,
+		offset: server.Sub(local),
+	})
+	if len(c.samples) > clockSamples {
+		c.samples = c.samples[len(c.samples)-clockSamples:]
+	}
+
+	best := c.samples[0]
+	for _, s := range c.samples[1:] {
+		if s.rtt < best.rtt {
+			best = s
+		}
+	}
+	c.base = best.local
+	c.offset = best.offset
+	c.drift = estimateDrift(c.samples)
+}
+
+// estimateDrift : オフセットの時間変化を最小二乗法で求める
+func estimateDrift(samples []clockSample) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+	t0 := samples[0].local
+	n := float64(len(samples))
+	var sx, sy, sxx, sxy float64
+	for _, s := range samples {
+		x := float64(s.local.Sub(t0))
+		y := float64(s.offset)
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	d := n*sxx - sx*sx
+	if d == 0 {
+		return 0
+	}
+	drift := (n*sxy - sx*sy) / d
+	return min(max(drift, -maxClockDrift), maxClockDrift)
+}
+
+// now : ローカル時刻localに対応するサーバ時刻. サンプルが無ければlocalをそのまま返す
+func (c *clockSync) now(local time.Time) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	local = local.Round(0) // monotonic clockを落としてサーバ時刻と比較できるようにする
+	if len(c.samples) == 0 {
+		return local
+	}
+	return local.Add(c.offset + time.Duration(c.drift*float64(local.Sub(c.base))))
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClockSync(t *testing.T) {
+	var c clockSync
+	local := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if now := c.now(local); !now.Equal(local) {
+		t.Fatalf("now without samples = %v, wants %v", now, local)
+	}
+
+	// サーバは1秒進んでいて、RTTが最小のサンプルのオフセットを基準にする
+	offset := time.Second
+	rtts := []time.Duration{80, 20, 50, 120}
+	for i, rtt := range rtts {
+		sent := local.Add(time.Duration(i) * time.Second)
+		rtt *= time.Millisecond
+		server := sent.Add(offset + rtt/2)
+		if i != 1 {
+			server = server.Add(rtt / 4) // 経路が非対称で誤差がある
+		}
+		c.add(sent, sent.Add(rtt), server)
+	}
+	at := local.Add(10 * time.Second)
+	got := c.now(at)
+	wants := at.Add(offset)
+	if d := got.Sub(wants); d < -10*time.Millisecond || d > 10*time.Millisecond {
+		t.Fatalf("now = %v, wants %v (diff %v)", got, wants, d)
+	}
+}
+
+func TestEstimateDrift(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	samples := make([]clockSample, 5)
+	for i := range samples {
+		x := time.Duration(i) * 10 * time.Second
+		samples[i] = clockSample{local: base.Add(x), offset: x / 10000} // 100ppm
+	}
+	if d := estimateDrift(samples); d < 0.99e-4 || d > 1.01e-4 {
+		t.Fatalf("drift = %v, wants 1e-4", d)
+	}
+
+	samples[4].offset = time.Second // 外れ値でも上限に収まる
+	if d := estimateDrift(samples); d != maxClockDrift {
+		t.Fatalf("drift = %v, wants %v", d, maxClockDrift)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"wsnet2/binary"
 	"wsnet2/common"
 	"wsnet2/pb"
+	"wsnet2/trace"
 )
 
 const reconnectInterval = 3 * time.Second
@@ -59,6 +60,8 @@ type Connection struct {
 	bearer string
 
 	deadline atomic.Uint32
+	rtt      atomic.Uint32 // 直近のPongから計測したRTT (milli seconds)
+	clock    clockSync
 
 	mumsg  sync.Mutex
 	msgseq int
@@ -77,6 +80,17 @@ func (c *Connection) UserId() string {
 	return c.userid
 }
 
+// RTT : 直近のPingから計測したRTT
+func (c *Connection) RTT() time.Duration {
+	return time.Duration(c.rtt.Load()) * time.Millisecond
+}
+
+// ServerTime : Ping/Pongから推定した現在のサーバ時刻.
+// まだPongを受信していないときはローカル時刻を返す.
+func (c *Connection) ServerTime() time.Time {
+	return c.clock.now(time.Now())
+}
+
 // Send : Msg (RegularMsg) を送信（バッファに書き込み、自動再送対象）
 func (c *Connection) Send(typ binary.MsgType, payload []byte) error {
 	c.mumsg.Lock()
@@ -150,6 +164,21 @@ func (c *Connection) Kick(player, msg string) error {
 	return c.Send(binary.MsgTypeKick, binary.MarshalKickPayload(player, msg))
 }
 
+// EndTurn : 手番を終える
+func (c *Connection) EndTurn() error {
+	return c.Send(binary.MsgTypeEndTurn, nil)
+}
+
+// FrameInput : ロックステップのフレームの入力を送信
+func (c *Connection) FrameInput(frame uint32, input []byte) error {
+	return c.Send(binary.MsgTypeFrameInput, binary.MarshalFrameInputPayload(frame, input))
+}
+
+// SetTimer : 部屋のタイマーを設定. dが0なら取り消す
+func (c *Connection) SetTimer(name string, d time.Duration) error {
+	return c.Send(binary.MsgTypeSetTimer, binary.MarshalSetTimerPayload(name, d))
+}
+
 // Leave : MsgLeaveを送信する
 func (c *Connection) Leave(msg string) error {
 	return c.Send(binary.MsgTypeLeave, binary.MarshalLeavePayload(msg))
@@ -174,6 +203,10 @@ func newConn(ctx context.Context, accinfo *AccessInfo, joined *pb.JoinedRoomRes,
 		msgbuf: common.NewRingBuf[marshaledMsg](32),
 		hmac:   mac,
 
+		// Rejoinでは前回の続きの通番から再開する
+		msgseq: int(joined.LastMsgSeq),
+		lastev: int(joined.LastEventSeq),
+
 		evch:   make(chan binary.Event, 32),
 		sysmsg: make(chan binary.Msg, 1),
 		done:   make(chan msgerr, 1),
@@ -217,6 +250,9 @@ func (conn *Connection) connect(ctx context.Context, warn func(error)) (string,
 		hdr.Add("Wsnet2-User", conn.userid)
 		hdr.Add("Wsnet2-LastEventSeq", strconv.Itoa(conn.lastev))
 		hdr.Add("Authorization", conn.bearer)
+		if tp := trace.Inject(ctx); tp != "" {
+			hdr.Add(trace.Header, tp)
+		}
 
 		ws, res, err := dialer.DialContext(ctx, conn.url, hdr)
 		if err != nil {
@@ -315,6 +351,28 @@ func (conn *Connection) receiver(ctx context.Context, ws *websocket.Conn, starts
 			}
 			startsender(msgseq)
 
+		case binary.EvTypePong:
+			p, err := binary.UnmarshalEvPongPayload(ev.Payload())
+			if err != nil {
+				return xerrors.Errorf("unmarshal pong payload: %w", err)
+			}
+			now := time.Now()
+			conn.rtt.Store(uint32(uint64(now.UnixMilli()) - p.Timestamp))
+			if !p.ServerTime.IsZero() {
+				conn.clock.pong(p.Timestamp, now, p.ServerTime)
+			}
+
+		case binary.EvTypeSnapshot:
+			// 以降のEventはスナップショットの通番の続きから届く
+			p, err := binary.UnmarshalEvSnapshotPayload(ev.Payload())
+			if err != nil {
+				return xerrors.Errorf("unmarshal snapshot payload: %w", err)
+			}
+			lastev = p.Seq
+			if p.Room.ClientDeadline != 0 {
+				conn.deadline.Store(p.Room.ClientDeadline)
+			}
+
 		case binary.EvTypeRoomProp:
 			deadline, err := binary.GetRoomPropClientDeadline(ev.Payload())
 			if err != nil {
@@ -342,8 +400,10 @@ func (conn *Connection) receiver(ctx context.Context, ws *websocket.Conn, starts
 func (conn *Connection) pinger(ctx context.Context, ws *websocket.Conn, mu *sync.Mutex) error {
 	for {
 		conn.mumsg.Lock()
-		msg := binary.NewMsgPing(time.Now()).Marshal(conn.hmac)
+		now := time.Now()
+		msg := binary.NewMsgPing(now).Marshal(conn.hmac)
 		conn.mumsg.Unlock()
+		conn.clock.ping(now)
 
 		mu.Lock()
 		ws.SetWriteDeadline(time.Now().Add(time.Second))
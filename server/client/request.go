@@ -17,6 +17,7 @@ import (
 	"wsnet2/auth"
 	"wsnet2/lobby"
 	"wsnet2/pb"
+	"wsnet2/trace"
 )
 
 var (
@@ -30,6 +31,9 @@ var (
 	ErrRoomLimit   = errors.New(lobby.ResponseTypeRoomLimit.String())
 	ErrNoRoomFound = errors.New(lobby.ResponseTypeNoRoomFound.String())
 	ErrRoomFull    = errors.New(lobby.ResponseTypeRoomFull.String())
+
+	ErrQuotaExceeded = errors.New(lobby.ResponseTypeQuotaExceeded.String())
+	ErrMaintenance   = errors.New(lobby.ResponseTypeMaintenance.String())
 )
 
 // Create : Roomを作成して入室
@@ -96,6 +100,26 @@ func RandomJoin(ctx context.Context, accinfo *AccessInfo, group uint32, query *Q
 	return connectToRoom(ctx, accinfo, res.Room, warn)
 }
 
+// Rejoin : 入室中の部屋のうち最も新しいものに再入室.
+// クラッシュ等でRoomIDや接続状態を失っていても、未読のEventから受信を再開できる
+func Rejoin(ctx context.Context, accinfo *AccessInfo, query *Query, warn func(error)) (*Room, *Connection, error) {
+	var q []lobby.PropQueries
+	if query != nil {
+		q = []lobby.PropQueries(*query)
+	}
+	param := lobby.RejoinParam{
+		Queries:   q,
+		EncMACKey: accinfo.EncMACKey,
+	}
+
+	res, err := lobbyRequest(ctx, accinfo, "/rooms/rejoin", param)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("lobbyRequest: %w", err)
+	}
+
+	return connectToRoom(ctx, accinfo, res.Room, warn)
+}
+
 // Watch : RoomIDを指定して観戦入室
 func Watch(ctx context.Context, accinfo *AccessInfo, roomid string, query *Query, warn func(error)) (*Room, *Connection, error) {
 	var q []lobby.PropQueries
@@ -203,6 +227,12 @@ func lobbyRequest(ctx context.Context, accinfo *AccessInfo, path string, param i
 	req.Header.Add("Wsnet2-App", accinfo.AppId)
 	req.Header.Add("Wsnet2-User", accinfo.UserId)
 	req.Header.Add("Authorization", "Bearer "+accinfo.Bearer)
+	if accinfo.Region != "" {
+		req.Header.Add("Wsnet2-Region", accinfo.Region)
+	}
+	if tp := trace.Inject(ctx); tp != "" {
+		req.Header.Add(trace.Header, tp)
+	}
 
 	client := &http.Client{
 		Transport: LobbyTransport,
@@ -237,6 +267,10 @@ func lobbyRequest(ctx context.Context, accinfo *AccessInfo, path string, param i
 		return &res, ErrNoRoomFound
 	case lobby.ResponseTypeRoomFull:
 		return &res, ErrRoomFull
+	case lobby.ResponseTypeQuotaExceeded:
+		return &res, ErrQuotaExceeded
+	case lobby.ResponseTypeMaintenance:
+		return &res, ErrMaintenance
 	default:
 		return &res, xerrors.Errorf("response type: %s: %v", res.Type, res.Msg)
 	}
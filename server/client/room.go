@@ -26,11 +26,18 @@ type Room struct {
 	Me             *Player
 	Master         *Player
 	LastMsgTimes   binary.Dict
+	ClientStats    map[string]binary.ClientStats // RoomOption.ClientStats指定時、Masterのみ
+	TurnPlayer     *Player                       // RoomOption.TurnBased指定時、手番のPlayer
+	Turn           uint32                        // RoomOption.TurnBased指定時、手番の通番
+	Timers         map[string]time.Time          // 部屋のタイマーの満了時刻 (ローカル時刻)
+
+	WatcherChatDisabled bool // Masterが観戦者チャットを無効にした. 観戦者のみ
 }
 
 type Player struct {
-	Id    string
-	Props binary.Dict
+	Id           string
+	Props        binary.Dict
+	PrivateProps binary.Dict // 自分自身とMasterのときのみ. それ以外はnil
 }
 
 func newRoom(joined *pb.JoinedRoomRes, myid string) (*Room, error) {
@@ -56,12 +63,30 @@ func newRoom(joined *pb.JoinedRoomRes, myid string) (*Room, error) {
 		if err != nil {
 			return nil, xerrors.Errorf("player[%v] props: %w", p.Id, err)
 		}
+		privProps, err := unmarshalPrivateProps(p.PrivateProps)
+		if err != nil {
+			return nil, xerrors.Errorf("player[%v] private props: %w", p.Id, err)
+		}
 		players[p.Id] = &Player{
-			Id:    p.Id,
-			Props: props,
+			Id:           p.Id,
+			Props:        props,
+			PrivateProps: privProps,
 		}
 	}
 
+	var turnPlayer *Player
+	var turn uint32
+	if joined.Turn != nil {
+		turnPlayer = players[joined.Turn.ActiveId]
+		turn = joined.Turn.Turn
+	}
+
+	now := time.Now()
+	timers := make(map[string]time.Time, len(joined.Timers))
+	for _, t := range joined.Timers {
+		timers[t.Name] = now.Add(time.Duration(t.Remaining) * time.Millisecond)
+	}
+
 	return &Room{
 		Id:             joined.RoomInfo.Id,
 		Number:         num,
@@ -79,6 +104,9 @@ func newRoom(joined *pb.JoinedRoomRes, myid string) (*Room, error) {
 		Me:             players[myid],
 		Master:         players[joined.MasterId],
 		LastMsgTimes:   make(binary.Dict),
+		TurnPlayer:     turnPlayer,
+		Turn:           turn,
+		Timers:         timers,
 	}, nil
 }
 
@@ -101,6 +129,18 @@ func (r *Room) Update(ev binary.Event) error {
 		return r.onEvRejoined(ev)
 	case binary.EvTypePong:
 		return r.onEvPong(ev)
+	case binary.EvTypeClientStats:
+		return r.onEvClientStats(ev)
+	case binary.EvTypeSnapshot:
+		return r.onEvSnapshot(ev)
+	case binary.EvTypeTurnChanged:
+		return r.onEvTurnChanged(ev)
+	case binary.EvTypeTimer:
+		return r.onEvTimer(ev)
+	case binary.EvTypeTimerExpired:
+		return r.onEvTimerExpired(ev)
+	case binary.EvTypeWatcherChatChanged:
+		return r.onEvWatcherChatChanged(ev)
 	}
 	return nil
 }
@@ -114,9 +154,14 @@ func (r *Room) onEvJoined(ev binary.Event) error {
 	if err != nil {
 		return xerrors.Errorf("Room.onEvJoined: player(%v) props: %w", clinfo.Id, err)
 	}
+	privProps, err := unmarshalPrivateProps(clinfo.PrivateProps)
+	if err != nil {
+		return xerrors.Errorf("Room.onEvJoined: player(%v) private props: %w", clinfo.Id, err)
+	}
 	r.Players[clinfo.Id] = &Player{
-		Id:    clinfo.Id,
-		Props: props,
+		Id:           clinfo.Id,
+		Props:        props,
+		PrivateProps: privProps,
 	}
 	return nil
 }
@@ -158,18 +203,69 @@ func (r *Room) onEvClientProp(ev binary.Event) error {
 	if err != nil {
 		return xerrors.Errorf("Room.onEvClientProp: payload: %w", err)
 	}
+	player := r.Players[p.Id]
 	for k, v := range p.Props {
-		r.Players[p.Id].Props[k] = v
+		player.Props[k] = v
+	}
+	if len(p.PrivateProps) > 0 && player.PrivateProps == nil {
+		player.PrivateProps = make(binary.Dict, len(p.PrivateProps))
+	}
+	for k, v := range p.PrivateProps {
+		player.PrivateProps[k] = v
 	}
 	return nil
 }
 
+// unmarshalPrivateProps : 省略されたprivate propsはnilとする
+func unmarshalPrivateProps(b []byte) (binary.Dict, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	d, _, err := binary.UnmarshalNullDict(b)
+	return d, err
+}
+
 func (r *Room) onEvMasterSwitched(ev binary.Event) error {
-	mid, err := binary.UnmarshalEvMasterSwitchedPayload(ev.Payload())
+	p, err := binary.UnmarshalEvMasterSwitchedPayload(ev.Payload())
 	if err != nil {
 		return xerrors.Errorf("Room.onEvMasterSwitched: payload: %w", err)
 	}
-	r.Master = r.Players[mid]
+	r.Master = r.Players[p.MasterId]
+	return nil
+}
+
+func (r *Room) onEvTurnChanged(ev binary.Event) error {
+	p, err := binary.UnmarshalEvTurnChangedPayload(ev.Payload())
+	if err != nil {
+		return xerrors.Errorf("Room.onEvTurnChanged: payload: %w", err)
+	}
+	r.TurnPlayer = r.Players[p.ActiveId]
+	r.Turn = p.Turn
+	return nil
+}
+
+func (r *Room) onEvTimer(ev binary.Event) error {
+	p, err := binary.UnmarshalEvTimerPayload(ev.Payload())
+	if err != nil {
+		return xerrors.Errorf("Room.onEvTimer: payload: %w", err)
+	}
+	if r.Timers == nil {
+		r.Timers = make(map[string]time.Time)
+	}
+	if p.Remaining == 0 {
+		delete(r.Timers, p.Name)
+	} else {
+		r.Timers[p.Name] = time.Now().Add(p.Remaining)
+	}
+	return nil
+}
+
+func (r *Room) onEvTimerExpired(ev binary.Event) error {
+	name, err := binary.UnmarshalEvTimerExpiredPayload(ev.Payload())
+	if err != nil {
+		return xerrors.Errorf("Room.onEvTimerExpired: payload: %w", err)
+	}
+	delete(r.Timers, name)
 	return nil
 }
 
@@ -182,9 +278,14 @@ func (r *Room) onEvRejoined(ev binary.Event) error {
 	if err != nil {
 		return xerrors.Errorf("Room.onEvRejoined: player(%v) props: %w", p.Id, err)
 	}
+	privProps, err := unmarshalPrivateProps(p.PrivateProps)
+	if err != nil {
+		return xerrors.Errorf("Room.onEvRejoined: player(%v) private props: %w", p.Id, err)
+	}
 	r.Players[p.Id] = &Player{
-		Id:    p.Id,
-		Props: props,
+		Id:           p.Id,
+		Props:        props,
+		PrivateProps: privProps,
 	}
 	return nil
 }
@@ -198,3 +299,55 @@ func (r *Room) onEvPong(ev binary.Event) error {
 	r.LastMsgTimes = p.LastMsgTimes
 	return nil
 }
+
+func (r *Room) onEvClientStats(ev binary.Event) error {
+	stats, err := binary.UnmarshalEvClientStatsPayload(ev.Payload())
+	if err != nil {
+		return xerrors.Errorf("Room.onEvClientStats: payload: %w", err)
+	}
+	r.ClientStats = stats
+	return nil
+}
+
+// onEvSnapshot : 受信が遅れてevbufが溢れたときに届く全状態で置き換える
+func (r *Room) onEvSnapshot(ev binary.Event) error {
+	p, err := binary.UnmarshalEvSnapshotPayload(ev.Payload())
+	if err != nil {
+		return xerrors.Errorf("Room.onEvSnapshot: payload: %w", err)
+	}
+	r.Visible = p.Room.Visible
+	r.Joinable = p.Room.Joinable
+	r.Watchable = p.Room.Watchable
+	r.SearchGroup = p.Room.SearchGroup
+	r.MaxPlayers = p.Room.MaxPlayer
+	if p.Room.ClientDeadline != 0 {
+		r.ClientDeadline = p.Room.ClientDeadline
+	}
+	r.PublicProps = p.Room.PublicProps
+	r.PrivateProps = p.Room.PrivateProps
+
+	// private propsは見られるPlayerのものだけ含まれる
+	players := make(map[string]*Player, len(p.Players))
+	for id, props := range p.Players {
+		players[id] = &Player{
+			Id:           id,
+			Props:        props,
+			PrivateProps: p.PrivateProps[id],
+		}
+	}
+	r.Players = players
+	if r.Me != nil { // 観戦者はnil
+		r.Me = r.Players[r.Me.Id]
+	}
+	r.Master = r.Players[p.MasterId]
+	return nil
+}
+
+func (r *Room) onEvWatcherChatChanged(ev binary.Event) error {
+	enabled, err := binary.UnmarshalEvWatcherChatChangedPayload(ev.Payload())
+	if err != nil {
+		return xerrors.Errorf("Room.onEvWatcherChatChanged: payload: %w", err)
+	}
+	r.WatcherChatDisabled = !enabled
+	return nil
+}
@@ -3,6 +3,7 @@ package client_test
 import (
 	"reflect"
 	"testing"
+	"time"
 	"wsnet2/binary"
 	"wsnet2/client"
 	"wsnet2/pb"
@@ -157,6 +158,8 @@ func TestRoom_Update_onEvClientProp(t *testing.T) {
 	user := "user1"
 	ev := binary.NewEvClientProp(user, binary.MarshalDict(binary.Dict{
 		"cli2": binary.MarshalBool(false),
+	}), binary.MarshalDict(binary.Dict{
+		"secret": binary.MarshalInt(1),
 	}))
 	exp := binary.Dict{
 		"cli1": binary.MarshalInt(100),
@@ -172,11 +175,15 @@ func TestRoom_Update_onEvClientProp(t *testing.T) {
 	if !reflect.DeepEqual(room.Players[user].Props, exp) {
 		t.Fatalf("player[%v] prop: %v, wants %v", user, room.Players[user].Props, exp)
 	}
+	expPriv := binary.Dict{"secret": binary.MarshalInt(1)}
+	if !reflect.DeepEqual(room.Players[user].PrivateProps, expPriv) {
+		t.Fatalf("player[%v] private prop: %v, wants %v", user, room.Players[user].PrivateProps, expPriv)
+	}
 }
 
 func TestRoom_Update_onEvMasterSwitched(t *testing.T) {
 	newmaster := "user2"
-	ev := binary.NewEvMasterSwitched("user1", "user2")
+	ev := binary.NewEvMasterSwitched("user1", "user2", "test")
 
 	room := newRoom()
 	err := room.Update(ev)
@@ -189,6 +196,23 @@ func TestRoom_Update_onEvMasterSwitched(t *testing.T) {
 	}
 }
 
+func TestRoom_Update_onEvTurnChanged(t *testing.T) {
+	ev := binary.NewEvTurnChanged("user2", 3, "end")
+
+	room := newRoom()
+	err := room.Update(ev)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if room.TurnPlayer != room.Players["user2"] {
+		t.Fatalf("turn player: %v, wants %v", room.TurnPlayer, "user2")
+	}
+	if room.Turn != 3 {
+		t.Fatalf("turn: %v, wants %v", room.Turn, 3)
+	}
+}
+
 func TestRoom_Update_onRejoined(t *testing.T) {
 	user := "user1"
 	props := binary.Dict{
@@ -212,7 +236,7 @@ func TestRoom_Update_onRejoined(t *testing.T) {
 
 func TestRoom_Update_onEvPong(t *testing.T) {
 	const watchers = 17
-	ev := binary.NewEvPong(10000, watchers, binary.Dict{})
+	ev := binary.NewEvPong(10000, watchers, binary.Dict{}, time.Now())
 
 	room := newRoom()
 	err := room.Update(ev)
@@ -224,3 +248,65 @@ func TestRoom_Update_onEvPong(t *testing.T) {
 		t.Fatalf("Watchers = %v, wants %v", room.Watchers, watchers)
 	}
 }
+
+func TestRoom_Update_onEvClientStats(t *testing.T) {
+	stats := map[string]binary.ClientStats{
+		"user1": {RTT: 30, ConnectCount: 1, EvBufUsed: 2, EvBufSize: 64},
+		"user2": {RTT: 120, ConnectCount: 3, ResendCount: 5, EvBufSize: 64},
+	}
+	ev := binary.NewEvClientStats(stats)
+
+	room := newRoom()
+	err := room.Update(ev)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !reflect.DeepEqual(room.ClientStats, stats) {
+		t.Fatalf("ClientStats = %v, wants %v", room.ClientStats, stats)
+	}
+}
+
+func TestRoom_Update_onEvSnapshot(t *testing.T) {
+	user2props := binary.Dict{"cli2": binary.MarshalInt(300)}
+	players := binary.Dict{
+		"user2": binary.MarshalDict(user2props),
+		"user3": binary.MarshalDict(binary.Dict{}),
+	}
+	pubProps := binary.Dict{"pub3": binary.MarshalStr8("new")}
+	roomProp := binary.MarshalRoomPropPayload(true, false, true, 20, 6, 40, pubProps, binary.Dict{})
+	user2private := binary.Dict{"secret": binary.MarshalInt(1)}
+	privates := binary.Dict{"user2": binary.MarshalDict(user2private)}
+	ev := binary.NewEvSnapshot(123, "user3", players, privates, roomProp)
+
+	room := newRoom()
+	err := room.Update(ev)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, ok := room.Players["user1"]; ok {
+		t.Fatalf("user1 must be removed")
+	}
+	if !reflect.DeepEqual(room.Players["user2"].Props, user2props) {
+		t.Fatalf("user2 props = %v, wants %v", room.Players["user2"].Props, user2props)
+	}
+	if !reflect.DeepEqual(room.Players["user2"].PrivateProps, user2private) {
+		t.Fatalf("user2 private props = %v, wants %v", room.Players["user2"].PrivateProps, user2private)
+	}
+	if room.Players["user3"].PrivateProps != nil {
+		t.Fatalf("user3 private props = %v, wants nil", room.Players["user3"].PrivateProps)
+	}
+	if room.Me != room.Players["user2"] {
+		t.Fatalf("Me = %v, wants user2", room.Me)
+	}
+	if room.Master.Id != "user3" {
+		t.Fatalf("Master = %v, wants user3", room.Master.Id)
+	}
+	if !room.Visible || room.Joinable || !room.Watchable || room.SearchGroup != 20 || room.MaxPlayers != 6 || room.ClientDeadline != 40 {
+		t.Fatalf("room = %+v", room)
+	}
+	if !reflect.DeepEqual(room.PublicProps, pubProps) {
+		t.Fatalf("PublicProps = %v, wants %v", room.PublicProps, pubProps)
+	}
+}
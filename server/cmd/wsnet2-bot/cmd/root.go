@@ -28,6 +28,7 @@ const (
 	ScenarioSearchCurrent    = 104
 	ScenarioClientProp       = 105
 	ScenarioRejoin           = 106
+	ScenarioResync           = 107
 
 	SoakSearchGroup = 200
 
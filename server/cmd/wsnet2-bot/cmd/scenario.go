@@ -22,6 +22,7 @@ import (
 //   - 入室
 //   - メッセージ送信
 //   - Kick
+//   - evbuf溢れ時のスナップショット
 var scenarioCmd = &cobra.Command{
 	Use:   "scenario",
 	Short: "Run scenario test",
@@ -39,6 +40,7 @@ var scenarios = map[string]func(context.Context) error{
 	"SearchCurrent": scenarioSearchCurrent,
 	"ClientProp":    scenarioClientProp,
 	"Rejoin":        scenarioRejoin,
+	"Resync":        scenarioResync,
 }
 
 var scenarioNoWatcher bool
@@ -746,7 +748,7 @@ func scenarioClientProp(ctx context.Context) error {
 		"prop2": binary.MarshalStr8("abc"),
 	}
 
-	master.Send(binary.MsgTypeClientProp, binary.MarshalClientPropPayload(prop))
+	master.Send(binary.MsgTypeClientProp, binary.MarshalClientPropPayload(prop, nil))
 
 	ev, ok := waitEvent(master, time.Second, binary.EvTypeClientProp)
 	if !ok {
@@ -763,7 +765,7 @@ func scenarioClientProp(ctx context.Context) error {
 
 	// "prop1"のみ変更
 	prop1 := binary.Dict{"prop1": binary.MarshalInt(200)}
-	master.Send(binary.MsgTypeClientProp, binary.MarshalClientPropPayload(prop1))
+	master.Send(binary.MsgTypeClientProp, binary.MarshalClientPropPayload(prop1, nil))
 
 	ev, ok = waitEvent(master, time.Second, binary.EvTypeClientProp)
 	if !ok {
@@ -890,3 +892,99 @@ func scenarioRejoin(ctx context.Context) error {
 	logger.Info("rejoin ok")
 	return nil
 }
+
+const (
+	// evbufを溢れさせるためのメッセージ数とサイズ.
+	// 受信しないクライアントのwebsocketの送信バッファも埋まる量にする
+	resyncMessages    = 1000
+	resyncPayloadSize = 32 * 1024
+)
+
+// scenarioResync : 受信が滞ってevbufが溢れたクライアントがスナップショットから復帰するテスト
+func scenarioResync(ctx context.Context) error {
+	logger.Infof("=== Scenario Resync ===")
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	room, master, err := createRoom(ctx, "resync_master", &pb.RoomOption{
+		Joinable:    true,
+		SearchGroup: ScenarioResync,
+	})
+	if err != nil {
+		return fmt.Errorf("resync: create: %w", err)
+	}
+	defer cleanupConn(ctx, master)
+	discardEvents(master)
+
+	id := "resync_player"
+	proom, player, err := joinRoom(ctx, id, room.Id, nil)
+	if err != nil {
+		return fmt.Errorf("resync: join: %w", err)
+	}
+	defer cleanupConn(ctx, player)
+
+	// playerはEventを読まずにいる間にmasterが大量に送信する
+	payload := make([]byte, resyncPayloadSize)
+	for i := 0; i < resyncMessages; i++ {
+		for {
+			err := master.Broadcast(payload)
+			if err == nil {
+				break
+			}
+			// msgbufが空くのを待つ
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+	logger.Infof("resync: %v messages sent", resyncMessages)
+
+	prop := binary.Dict{"resync": binary.MarshalBool(true)}
+	master.Send(binary.MsgTypeRoomProp, binary.MarshalRoomPropPayload(
+		proom.Visible, proom.Joinable, proom.Watchable, proom.SearchGroup, proom.MaxPlayers, 0, prop, nil))
+
+	ev, ok := waitEvent(player, 30*time.Second, binary.EvTypeSnapshot)
+	if !ok {
+		return fmt.Errorf("resync: wait EvSnapshot failed")
+	}
+	if err := proom.Update(ev); err != nil {
+		return fmt.Errorf("resync: apply snapshot: %w", err)
+	}
+	if _, ok := proom.Players["resync_master"]; !ok || proom.Me == nil {
+		return fmt.Errorf("resync: players: %v", proom.Players)
+	}
+	logger.Infof("resync: snapshot applied: players=%v", len(proom.Players))
+
+	// スナップショット以降のEventは通常通り届く
+	after := binary.MarshalStr8("after resync")
+	if err := master.Broadcast(after); err != nil {
+		return fmt.Errorf("resync: broadcast: %w", err)
+	}
+	for {
+		ev, ok := waitEvent(player, 10*time.Second, binary.EvTypeMessage, binary.EvTypeRoomProp)
+		if !ok {
+			return fmt.Errorf("resync: no message after snapshot")
+		}
+		if err := proom.Update(ev); err != nil {
+			return fmt.Errorf("resync: update: %w", err)
+		}
+		if ev.Type() != binary.EvTypeMessage {
+			continue
+		}
+		_, pl, err := binary.UnmarshalEvMessage(ev.Payload())
+		if err != nil {
+			return fmt.Errorf("resync: unmarshal message: %w", err)
+		}
+		if reflect.DeepEqual(pl, after) {
+			break
+		}
+	}
+	if _, ok := proom.PublicProps["resync"]; !ok {
+		return fmt.Errorf("resync: room props not synced: %v", proom.PublicProps)
+	}
+
+	logger.Info("resync ok")
+	return nil
+}
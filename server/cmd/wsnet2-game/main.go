@@ -16,7 +16,9 @@ import (
 	"wsnet2"
 	"wsnet2/config"
 	"wsnet2/game/service"
+	"wsnet2/lifecycle"
 	"wsnet2/log"
+	"wsnet2/trace"
 )
 
 func main() {
@@ -40,6 +42,12 @@ func main() {
 		}
 	}
 
+	closeTrace, err := trace.Init("wsnet2-game", &conf.Game.TraceConf)
+	if err != nil {
+		panic(fmt.Errorf("%+v\n", err))
+	}
+	defer closeTrace()
+
 	db := sqlx.MustOpen("mysql", conf.Db.DSN())
 	maxConns := conf.Game.DbMaxConns
 	if maxConns > 0 {
@@ -49,6 +57,12 @@ func main() {
 	}
 	db.SetConnMaxLifetime(time.Duration(conf.Db.ConnMaxLifetime))
 
+	closeLifecycle, err := lifecycle.Init(&conf.Game.LifecycleConf, db)
+	if err != nil {
+		panic(fmt.Errorf("%+v\n", err))
+	}
+	defer closeLifecycle()
+
 	service, err := service.New(db, &conf.Game)
 	if err != nil {
 		panic(fmt.Errorf("%+v\n", err))
@@ -17,6 +17,7 @@ import (
 	"wsnet2/config"
 	"wsnet2/hub/service"
 	"wsnet2/log"
+	"wsnet2/trace"
 )
 
 func main() {
@@ -40,6 +41,12 @@ func main() {
 		}
 	}
 
+	closeTrace, err := trace.Init("wsnet2-hub", &conf.Hub.TraceConf)
+	if err != nil {
+		panic(fmt.Errorf("%+v\n", err))
+	}
+	defer closeTrace()
+
 	db := sqlx.MustOpen("mysql", conf.Db.DSN())
 	maxConns := conf.Hub.DbMaxConns
 	if maxConns > 0 {
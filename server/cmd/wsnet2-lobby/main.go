@@ -15,6 +15,7 @@ import (
 	"wsnet2/config"
 	"wsnet2/lobby/service"
 	"wsnet2/log"
+	"wsnet2/trace"
 )
 
 func main() {
@@ -38,6 +39,12 @@ func main() {
 		}
 	}
 
+	closeTrace, err := trace.Init("wsnet2-lobby", &conf.Lobby.TraceConf)
+	if err != nil {
+		panic(fmt.Errorf("%+v\n", err))
+	}
+	defer closeTrace()
+
 	db := sqlx.MustOpen("mysql", conf.Db.DSN())
 	maxConns := conf.Lobby.DbMaxConns
 	if maxConns > 0 {
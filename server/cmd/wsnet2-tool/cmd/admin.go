@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"wsnet2/auth"
+)
+
+var (
+	adminToken string
+	lobbyURL   string
+)
+
+// addAdminFlags : 管理API経由で操作するためのフラグ
+func addAdminFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&adminToken, "token", "t", "", "Admin token (use lobby admin API)")
+	cmd.Flags().StringVar(&lobbyURL, "lobby", "", "Lobby URL (default http://<lobby.hostname>:<lobby.port>)")
+}
+
+// adminRequest : lobbyの管理APIを呼び出す
+func adminRequest(ctx context.Context, appId, path string, param, res any) error {
+	u := lobbyURL
+	if u == "" {
+		host := conf.Lobby.Hostname
+		if host == "" {
+			host = "localhost"
+		}
+		u = fmt.Sprintf("http://%s:%d", host, conf.Lobby.Port)
+	}
+	u = strings.TrimSuffix(u, "/") + path
+
+	body, err := json.Marshal(param)
+	if err != nil {
+		return xerrors.Errorf("marshal param: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return xerrors.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Wsnet2-App", appId)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return xerrors.Errorf("do request: %w", err)
+	}
+	defer r.Body.Close()
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return xerrors.Errorf("read body: %w", err)
+	}
+	if r.StatusCode != http.StatusOK {
+		return xerrors.Errorf("%v: %s", r.Status, strings.TrimSpace(string(b)))
+	}
+	if res == nil {
+		return nil
+	}
+	if err := json.Unmarshal(b, res); err != nil {
+		return xerrors.Errorf("unmarshal response: %w", err)
+	}
+	return nil
+}
+
+var (
+	adminTokenApp string
+	adminTokenTTL time.Duration
+)
+
+// adminTokenCmd represents the admin-token command
+var adminTokenCmd = &cobra.Command{
+	Use:   "admin-token <subject> <scope>...",
+	Short: "Generate admin token",
+	Long: `Generate admin token for lobby admin API signed by lobby.admin_token_key.
+Scopes: "*", "` + strings.Join([]string{auth.AdminScopeRead, auth.AdminScopeKick, auth.AdminScopeClose, auth.AdminScopeNotice, auth.AdminScopeMaintenance, auth.AdminScopeToken}, `", "`) + `"`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return xerrors.Errorf("need subject and scopes")
+		}
+
+		token, err := auth.GenerateAdminToken(conf.Lobby.AdminTokenKey, &auth.AdminClaims{
+			Subject: args[0],
+			AppId:   adminTokenApp,
+			Scopes:  args[1:],
+			Expire:  time.Now().Add(adminTokenTTL).Unix(),
+		})
+		if err != nil {
+			return err
+		}
+
+		cmd.SetOut(os.Stdout)
+		cmd.Println(token)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(adminTokenCmd)
+
+	adminTokenCmd.Flags().StringVarP(&adminTokenApp, "app", "a", "", "Restrict to the app (default all apps)")
+	adminTokenCmd.Flags().DurationVar(&adminTokenTTL, "ttl", time.Hour, "Time to live")
+}
@@ -10,6 +10,16 @@ type app struct {
 	Id   string `db:"id"`
 	Name string `db:"name"`
 	Key  string `db:"key"`
+
+	MaxRooms      uint32 `db:"max_rooms"`
+	MaxPlayers    uint32 `db:"max_players"`
+	MaxWatchers   uint32 `db:"max_watchers"`
+	MaxPropsBytes uint32 `db:"max_props_bytes"`
+	MaxMsgRate    uint32 `db:"max_msg_rate"`
+
+	MaxLifetime uint32 `db:"max_lifetime"`
+	IdleTimeout uint32 `db:"idle_timeout"`
+	EmptyGrace  uint32 `db:"empty_grace"`
 }
 
 // appsCmd represents the apps command
@@ -18,7 +28,7 @@ var appsCmd = &cobra.Command{
 	Short: "Show applications",
 	Long:  "Show applications registered on the DB",
 	Run: func(cmd *cobra.Command, args []string) {
-		const sql = "SELECT `id`, `key`, `name` FROM `app`"
+		const sql = "SELECT `id`, `key`, `name`, `max_rooms`, `max_players`, `max_watchers`, `max_props_bytes`, `max_msg_rate`, `max_lifetime`, `idle_timeout`, `empty_grace` FROM `app`"
 
 		var apps []*app
 		err := db.SelectContext(cmd.Context(), &apps, sql)
@@ -28,11 +38,13 @@ var appsCmd = &cobra.Command{
 
 		cmd.SetOut(os.Stdout)
 		if verbose {
-			cmd.Println("id\tkey\tname")
+			cmd.Println("id\tkey\tname\tmax_rooms\tmax_players\tmax_watchers\tmax_props_bytes\tmax_msg_rate\tmax_lifetime\tidle_timeout\tempty_grace")
 		}
 
 		for _, app := range apps {
-			cmd.Printf("%s\t%s\t%q\n", app.Id, app.Key, app.Name)
+			cmd.Printf("%s\t%s\t%q\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n", app.Id, app.Key, app.Name,
+				app.MaxRooms, app.MaxPlayers, app.MaxWatchers, app.MaxPropsBytes, app.MaxMsgRate,
+				app.MaxLifetime, app.IdleTimeout, app.EmptyGrace)
 		}
 	},
 }
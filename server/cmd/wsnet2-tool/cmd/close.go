@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"wsnet2/lobby"
+	"wsnet2/pb"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+// closeCmd represents the close command
+var closeCmd = &cobra.Command{
+	Use:   "close <room> [reason]",
+	Short: "Close the room",
+	Long: `Close the room forcibly. All clients receive the left event with the reason.
+When --token is given, close via the lobby admin API.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return xerrors.Errorf("need room")
+		}
+		reason := "closed by admin"
+		if len(args) > 1 {
+			reason = args[1]
+		}
+
+		svrs, err := selectGrpcServers(cmd.Context(), args[0:1])
+		if err != nil {
+			return err
+		}
+		svr, ok := svrs[args[0]]
+		if !ok {
+			return xerrors.Errorf("room not found: %v", args[0])
+		}
+
+		if adminToken != "" {
+			return adminRequest(cmd.Context(), svr.App, "/_admin/close", &lobby.AdminCloseParam{
+				RoomID: svr.Room,
+				Reason: reason,
+			}, nil)
+		}
+
+		conn, err := svr.Dial()
+		if err != nil {
+			return err
+		}
+
+		_, err = pb.NewGameClient(conn).Close(cmd.Context(), &pb.CloseReq{
+			AppId:  svr.App,
+			RoomId: svr.Room,
+			Reason: reason,
+		})
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(closeCmd)
+
+	addAdminFlags(closeCmd)
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"wsnet2/lobby"
 	"wsnet2/pb"
 
 	"golang.org/x/xerrors"
@@ -12,7 +13,8 @@ import (
 var kickCmd = &cobra.Command{
 	Use:   "kick <player> <room>",
 	Short: "Kick the player",
-	Long:  `Kick the player from the specified room`,
+	Long: `Kick the player from the specified room.
+When --token is given, kick via the lobby admin API.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) < 2 {
 			return xerrors.Errorf("need player and room")
@@ -27,6 +29,13 @@ var kickCmd = &cobra.Command{
 			return xerrors.Errorf("room not found: %v", args[1])
 		}
 
+		if adminToken != "" {
+			return adminRequest(cmd.Context(), svr.App, "/_admin/kick", &lobby.AdminKickParam{
+				TargetID: args[0],
+				RoomID:   svr.Room,
+			}, nil)
+		}
+
 		conn, err := svr.Dial()
 		if err != nil {
 			return err
@@ -47,4 +56,6 @@ var kickCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(kickCmd)
+
+	addAdminFlags(kickCmd)
 }
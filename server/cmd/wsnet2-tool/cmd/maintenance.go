@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"wsnet2/lobby"
+)
+
+var (
+	maintenanceStart   string
+	maintenanceEnd     string
+	maintenanceMessage string
+	maintenanceClear   bool
+)
+
+// maintenanceCmd represents the maintenance command
+var maintenanceCmd = &cobra.Command{
+	Use:   "maintenance [app]",
+	Short: "Show or set maintenance windows",
+	Long: `Show the scheduled maintenance windows, or set the window of the app with --end.
+Creating rooms is rejected during the window while the existing rooms continue.
+The times are formatted in RFC3339 (e.g. 2006-01-02T15:04:05+09:00).
+When --token is given, set via the lobby admin API.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SetOut(os.Stdout)
+
+		if maintenanceEnd == "" && !maintenanceClear {
+			return showMaintenance(cmd, args)
+		}
+		if len(args) < 1 {
+			return xerrors.Errorf("need app")
+		}
+		appId := args[0]
+
+		var start, end time.Time
+		if !maintenanceClear {
+			var err error
+			start = time.Now()
+			if maintenanceStart != "" {
+				start, err = time.Parse(time.RFC3339, maintenanceStart)
+				if err != nil {
+					return xerrors.Errorf("invalid start: %w", err)
+				}
+			}
+			end, err = time.Parse(time.RFC3339, maintenanceEnd)
+			if err != nil {
+				return xerrors.Errorf("invalid end: %w", err)
+			}
+			if !start.Before(end) {
+				return xerrors.Errorf("end must be after start: %v - %v", start, end)
+			}
+		}
+
+		if adminToken != "" {
+			param := &lobby.AdminMaintenanceParam{Message: maintenanceMessage}
+			if !end.IsZero() {
+				param.StartAt = start.Unix()
+				param.EndAt = end.Unix()
+			}
+			return adminRequest(cmd.Context(), appId, "/_admin/maintenance", param, nil)
+		}
+
+		if end.IsZero() {
+			_, err := db.ExecContext(cmd.Context(), "DELETE FROM `maintenance` WHERE `app_id`=?", appId)
+			return err
+		}
+		const sql = "INSERT INTO `maintenance` (`app_id`, `start_at`, `end_at`, `message`) VALUES (?, ?, ?, ?) " +
+			"ON DUPLICATE KEY UPDATE `start_at`=VALUES(`start_at`), `end_at`=VALUES(`end_at`), `message`=VALUES(`message`)"
+		_, err := db.ExecContext(cmd.Context(), sql, appId, start, end, maintenanceMessage)
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(maintenanceCmd)
+
+	maintenanceCmd.Flags().StringVar(&maintenanceStart, "start", "", "Start time of the window (default now)")
+	maintenanceCmd.Flags().StringVar(&maintenanceEnd, "end", "", "End time of the window")
+	maintenanceCmd.Flags().StringVarP(&maintenanceMessage, "message", "m", "", "Message for the window")
+	maintenanceCmd.Flags().BoolVar(&maintenanceClear, "clear", false, "Clear the window of the app")
+	addAdminFlags(maintenanceCmd)
+}
+
+func showMaintenance(cmd *cobra.Command, args []string) error {
+	sql := "SELECT `app_id`, `start_at`, `end_at`, `message` FROM `maintenance`"
+	var params []any
+	if len(args) > 0 {
+		sql += " WHERE `app_id`=?"
+		params = append(params, args[0])
+	}
+
+	var windows []lobby.Maintenance
+	err := db.SelectContext(cmd.Context(), &windows, sql, params...)
+	if err != nil {
+		return err
+	}
+
+	if verbose {
+		cmd.Println("app\tstart\tend\tstatus\tmessage")
+	}
+	now := time.Now()
+	for _, m := range windows {
+		st := "Scheduled"
+		if m.In(now) {
+			st = "InMaintenance"
+		} else if !now.Before(m.EndAt) {
+			st = "Finished"
+		}
+		cmd.Printf("%s\t%v\t%v\t%s\t%q\n", m.AppId, m.StartAt, m.EndAt, st, m.Message)
+	}
+	return nil
+}
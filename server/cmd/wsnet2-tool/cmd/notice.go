@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"wsnet2/lobby"
+	"wsnet2/pb"
+)
+
+var (
+	noticeRoom string
+	noticeApp  string
+)
+
+// noticeCmd represents the notice command
+var noticeCmd = &cobra.Command{
+	Use:   "notice <message>",
+	Short: "Send notice to rooms",
+	Long: `Send notice to the room (--room) or all rooms of the app (--app).
+When --token is given, send via the lobby admin API.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return xerrors.Errorf("need message")
+		}
+		if (noticeRoom == "") == (noticeApp == "") {
+			return xerrors.Errorf("need either --room or --app")
+		}
+
+		if noticeRoom != "" {
+			svrs, err := selectGrpcServers(cmd.Context(), []string{noticeRoom})
+			if err != nil {
+				return err
+			}
+			svr, ok := svrs[noticeRoom]
+			if !ok {
+				return xerrors.Errorf("room not found: %v", noticeRoom)
+			}
+
+			if adminToken != "" {
+				return adminRequest(cmd.Context(), svr.App, "/_admin/notice", &lobby.AdminNoticeParam{
+					RoomID:  svr.Room,
+					Message: args[0],
+				}, nil)
+			}
+
+			conn, err := svr.Dial()
+			if err != nil {
+				return err
+			}
+			_, err = pb.NewGameClient(conn).Notice(cmd.Context(), &pb.NoticeReq{
+				AppId:   svr.App,
+				RoomId:  svr.Room,
+				Message: args[0],
+			})
+			return err
+		}
+
+		if adminToken != "" {
+			return adminRequest(cmd.Context(), noticeApp, "/_admin/notice", &lobby.AdminNoticeParam{
+				Message: args[0],
+			}, nil)
+		}
+
+		var servers []server
+		err := db.SelectContext(cmd.Context(), &servers, "select * from game_server")
+		if err != nil {
+			return err
+		}
+		for _, s := range servers {
+			if !s.Available() {
+				continue
+			}
+			conn, err := grpc.NewClient(fmt.Sprintf("%s:%d", s.HostName, s.GRPCPort),
+				grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				return err
+			}
+			_, err = pb.NewGameClient(conn).Notice(cmd.Context(), &pb.NoticeReq{
+				AppId:   noticeApp,
+				Message: args[0],
+			})
+			conn.Close()
+			if err != nil {
+				return xerrors.Errorf("notice to %v: %w", s.HostName, err)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(noticeCmd)
+
+	noticeCmd.Flags().StringVarP(&noticeRoom, "room", "r", "", "Target room id")
+	noticeCmd.Flags().StringVarP(&noticeApp, "app", "a", "", "Target app id (all rooms of the app)")
+	addAdminFlags(noticeCmd)
+}
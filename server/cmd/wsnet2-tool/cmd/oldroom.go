@@ -27,8 +27,10 @@ type roomHistory struct {
 	PrivateProps []byte        `db:"private_props"`
 	Created      time.Time     `db:"created"`
 	Closed       time.Time     `db:"closed"`
+	CloseReason  string        `db:"close_reason"`
 
 	PlayerLogs []*playerLog
+	Results    []*roomResult
 }
 
 type playerLog struct {
@@ -39,6 +41,32 @@ type playerLog struct {
 	Datetime time.Time         `db:"datetime" json:"datetime"`
 }
 
+type roomResult struct {
+	ID          int       `db:"id" json:"-"`
+	AppID       string    `db:"app_id" json:"-"`
+	RoomID      string    `db:"room_id" json:"-"`
+	Agreed      bool      `db:"agreed" json:"agreed"`
+	Result      string    `db:"result" json:"-"`
+	Submissions string    `db:"submissions" json:"-"`
+	Created     time.Time `db:"created" json:"created"`
+}
+
+func (r *roomResult) MarshalJSON() ([]byte, error) {
+	type alias roomResult
+	return json.Marshal(struct {
+		*alias
+		Result      json.RawMessage `json:"result"`
+		Submissions json.RawMessage `json:"submissions"`
+	}{(*alias)(r), rawJSON(r.Result), rawJSON(r.Submissions)})
+}
+
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(s)
+}
+
 // oldroomCmd represents the oldroom command
 var oldroomCmd = &cobra.Command{
 	Use:   "oldroom <roomid>...",
@@ -88,7 +116,25 @@ func selectRoomHistoryByIds(ctx context.Context, ids []string) (map[string]*room
 		return nil, err
 	}
 	_, rooms, err := selectRoomHistory(ctx, q, p...)
-	return rooms, err
+	if err != nil || len(rooms) == 0 {
+		return rooms, err
+	}
+
+	q, p, err = sqlx.In("SELECT * FROM room_result WHERE room_id IN (?) ORDER BY id", ids)
+	if err != nil {
+		return nil, err
+	}
+	var results []*roomResult
+	err = db.SelectContext(ctx, &results, q, p...)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		if room, ok := rooms[r.RoomID]; ok {
+			room.Results = append(room.Results, r)
+		}
+	}
+	return rooms, nil
 }
 
 func selectRoomHistory(ctx context.Context, q string, p ...any) ([]*roomHistory, map[string]*roomHistory, error) {
@@ -152,7 +198,9 @@ func formatRoomHistory(r *roomHistory) (_ map[string]any, err error) {
 		"public_props":  publicProps,
 		"private_props": privateProps,
 		"player_logs":   r.PlayerLogs,
+		"results":       r.Results,
 		"created":       r.Created,
 		"closed":        r.Closed,
+		"close_reason":  r.CloseReason,
 	}, nil
 }
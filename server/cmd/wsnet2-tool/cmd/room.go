@@ -132,6 +132,11 @@ func formatRoom(res *pb.GetRoomInfoRes, host string) (map[string]any, error) {
 		return nil, err
 	}
 
+	stats := make(map[string]*pb.ClientStats, len(res.ClientStats))
+	for _, s := range res.ClientStats {
+		stats[s.Id] = s
+	}
+
 	ps := make([]map[string]any, 0)
 	for _, c := range cs {
 		props, err := binary.UnmarshalRecursive(c.Props)
@@ -145,6 +150,12 @@ func formatRoom(res *pb.GetRoomInfoRes, host string) (map[string]any, error) {
 			"props":     props,
 			"last_msg":  time.UnixMilli(int64(res.LastMsgTimes[c.Id])),
 		}
+		if s, ok := stats[c.Id]; ok {
+			p["rtt_ms"] = s.Rtt
+			p["connect_count"] = s.ConnectCount
+			p["resend_count"] = s.ResendCount
+			p["evbuf"] = fmt.Sprintf("%d/%d", s.EvbufUsed, s.EvbufSize)
+		}
 
 		ps = append(ps, p)
 	}
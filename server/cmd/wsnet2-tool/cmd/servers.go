@@ -1,10 +1,16 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"wsnet2/common"
+	"wsnet2/lobby"
 )
 
 var (
@@ -12,7 +18,9 @@ var (
 	serversHubOnly  bool
 	serversAll      bool
 
-	serverStatusStr = []string{"Starting", "Running", "Closing"}
+	serverStatusStr = []string{"Starting", "Running", "Closing", "Draining"}
+
+	drainHub bool
 )
 
 type server struct {
@@ -21,8 +29,17 @@ type server struct {
 	PublicName    string `db:"public_name"`
 	GRPCPort      int    `db:"grpc_port"`
 	WebSocketPort int    `db:"ws_port"`
+	Region        string `db:"region"`
 	Status        int    `db:"status"`
 	HeartBeat     int64  `db:"heartbeat"`
+	Rooms         int    `db:"rooms"`
+	Watchers      int    `db:"watchers"`
+	Goroutines    int    `db:"goroutines"`
+	MsgBacklog    int    `db:"msg_backlog"`
+
+	// game_serverのみ
+	Clients  int     `db:"clients"`
+	Capacity float64 `db:"capacity"`
 }
 
 // serversCmd represents the servers command
@@ -63,8 +80,38 @@ var serversCmd = &cobra.Command{
 	},
 }
 
+// serversDrainCmd represents the servers drain command
+var serversDrainCmd = &cobra.Command{
+	Use:   "drain <id>",
+	Short: "Drain the server",
+	Long: `Mark the running game (or hub) server as draining.
+New rooms are not assigned to the draining server while the existing rooms continue.
+When --token is given, drain via the lobby admin API.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return drainServer(cmd, args, true)
+	},
+}
+
+// serversUndrainCmd represents the servers undrain command
+var serversUndrainCmd = &cobra.Command{
+	Use:   "undrain <id>",
+	Short: "Undrain the server",
+	Long: `Mark the draining game (or hub) server as running again.
+When --token is given, undrain via the lobby admin API.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return drainServer(cmd, args, false)
+	},
+}
+
 func init() {
 	rootCmd.AddCommand(serversCmd)
+	serversCmd.AddCommand(serversDrainCmd)
+	serversCmd.AddCommand(serversUndrainCmd)
+
+	for _, c := range []*cobra.Command{serversDrainCmd, serversUndrainCmd} {
+		c.Flags().BoolVarP(&drainHub, "hub", "u", false, "target hub server")
+		addAdminFlags(c)
+	}
 
 	serversCmd.Flags().BoolVarP(&serversGameOnly, "game", "g", false, "show game servers only")
 	serversCmd.Flags().BoolVarP(&serversHubOnly, "hub", "u", false, "show hub servers only")
@@ -72,7 +119,7 @@ func init() {
 }
 
 func printServersHeader(cmd *cobra.Command) {
-	cmd.Println("type\tid\thost\tpublic\tgrpc\twebsocket\tstatus\theartbeat")
+	cmd.Println("type\tid\thost\tpublic\tgrpc\twebsocket\tregion\tstatus\theartbeat\trooms\twatchers\tgoroutines\tbacklog\tclients\tcapacity")
 }
 
 func printServer(cmd *cobra.Command, typ string, s server) {
@@ -86,11 +133,56 @@ func printServer(cmd *cobra.Command, typ string, s server) {
 		ok = "Dead"
 	}
 
-	cmd.Printf("%s\t%d\t%s\t%s\t%d\t%d\t%s:%s\t%v\n",
-		typ, s.Id, s.HostName, s.PublicName, s.GRPCPort, s.WebSocketPort, st, ok, hb)
+	load := fmt.Sprintf("%d\t%d\t%d\t%d", s.Rooms, s.Watchers, s.Goroutines, s.MsgBacklog)
+	if typ == "game" {
+		load += fmt.Sprintf("\t%d\t%.2f", s.Clients, s.Capacity)
+	} else {
+		load += "\t-\t-"
+	}
+
+	cmd.Printf("%s\t%d\t%s\t%s\t%d\t%d\t%s\t%s:%s\t%v\t%s\n",
+		typ, s.Id, s.HostName, s.PublicName, s.GRPCPort, s.WebSocketPort, s.Region, st, ok, hb, load)
 }
 
 func (s *server) Available() bool {
 	v := time.Now().Add(-time.Duration(conf.Lobby.ValidHeartBeat)).Unix()
 	return v < s.HeartBeat
 }
+
+func drainServer(cmd *cobra.Command, args []string, drain bool) error {
+	if len(args) < 1 {
+		return xerrors.Errorf("need server id")
+	}
+	id, err := strconv.ParseUint(args[0], 10, 32)
+	if err != nil {
+		return xerrors.Errorf("invalid server id: %w", err)
+	}
+	typ := "game"
+	if drainHub {
+		typ = "hub"
+	}
+
+	if adminToken != "" {
+		return adminRequest(cmd.Context(), "", "/_admin/drain", &lobby.AdminDrainParam{
+			Type:   typ,
+			HostID: uint32(id),
+			Drain:  drain,
+		}, nil)
+	}
+
+	from, to := common.HostStatusRunning, common.HostStatusDraining
+	if !drain {
+		from, to = to, from
+	}
+	sql := fmt.Sprintf("UPDATE `%s_server` SET `status`=? WHERE `id`=? AND `status`=?", typ)
+	res, err := db.ExecContext(cmd.Context(), sql, to, id, from)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return xerrors.Errorf("%s server %v is not found or not %s", typ, id, serverStatusStr[from])
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"wsnet2/lobby"
+)
+
+var (
+	tokenTTL    time.Duration
+	tokenRevoke bool
+)
+
+// tokenCmd represents the token command
+var tokenCmd = &cobra.Command{
+	Use:   "token <app> <user>",
+	Short: "Issue or revoke access token of the user",
+	Long: `Issue the bearer and MAC key of the user as JSON, or revoke all the bearers issued before with --revoke.
+The bearer expires after --ttl (default lobby.token_ttl), which is limited to lobby.authdata_expire.
+When --token is given, issue or revoke via the lobby admin API.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return xerrors.Errorf("need app and user")
+		}
+		appId, userId := args[0], args[1]
+		cmd.SetOut(os.Stdout)
+
+		if tokenRevoke {
+			if adminToken != "" {
+				return adminRequest(cmd.Context(), appId, "/_admin/revoke", &lobby.AdminRevokeParam{UserID: userId}, nil)
+			}
+			const query = "INSERT INTO `revoked_user` (`app_id`, `user_id`, `revoked_at`) VALUES (?, ?, ?) " +
+				"ON DUPLICATE KEY UPDATE `revoked_at`=VALUES(`revoked_at`)"
+			_, err := db.ExecContext(cmd.Context(), query, appId, userId, time.Now().Unix())
+			return err
+		}
+
+		var token *lobby.AccessToken
+		if adminToken != "" {
+			var res lobby.AdminResponse
+			param := &lobby.AdminTokenParam{UserID: userId, TTL: int64(tokenTTL / time.Second)}
+			if err := adminRequest(cmd.Context(), appId, "/_admin/token", param, &res); err != nil {
+				return err
+			}
+			token = res.Token
+		} else {
+			var err error
+			token, err = issueToken(cmd, appId, userId)
+			if err != nil {
+				return err
+			}
+		}
+
+		out, err := json.Marshal(token)
+		if err != nil {
+			return err
+		}
+		cmd.Println(string(out))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tokenCmd)
+
+	tokenCmd.Flags().DurationVar(&tokenTTL, "ttl", 0, "Time to live of the bearer (default lobby.token_ttl)")
+	tokenCmd.Flags().BoolVar(&tokenRevoke, "revoke", false, "Revoke the bearers issued before")
+	addAdminFlags(tokenCmd)
+}
+
+func issueToken(cmd *cobra.Command, appId, userId string) (*lobby.AccessToken, error) {
+	var appKey string
+	err := db.GetContext(cmd.Context(), &appKey, "SELECT `key` FROM `app` WHERE `id`=?", appId)
+	if err != nil {
+		return nil, xerrors.Errorf("select app %q: %w", appId, err)
+	}
+
+	var revokedAt int64
+	err = db.GetContext(cmd.Context(), &revokedAt,
+		"SELECT `revoked_at` FROM `revoked_user` WHERE `app_id`=? AND `user_id`=?", appId, userId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, xerrors.Errorf("select revoked_user: %w", err)
+	}
+
+	ttl := tokenTTL
+	if ttl <= 0 {
+		ttl = time.Duration(conf.Lobby.TokenTTL)
+	}
+	return lobby.NewAccessToken(appId, appKey, userId, time.Now(), ttl,
+		time.Duration(conf.Lobby.AuthDataExpire), time.Unix(revokedAt, 0))
+}
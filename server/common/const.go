@@ -1,10 +1,17 @@
 package common
 
+import "google.golang.org/grpc/codes"
+
 const (
 	HostStatusStarting = 0
 	HostStatusRunning  = 1
 	HostStatusClosing  = 2
+	HostStatusDraining = 3
 
 	RoomIdLen     = 32
 	RoomIdPattern = "^[0-9a-f]{32}$"
 )
+
+// CodeQuotaExceeded : アプリ毎の上限(appテーブル)に達したときのコード.
+// サーバ全体の上限(ResourceExhausted)と区別するためPermissionDeniedを使う.
+const CodeQuotaExceeded = codes.PermissionDenied
@@ -4,6 +4,8 @@ import (
 	"sync"
 
 	"google.golang.org/grpc"
+
+	"wsnet2/trace"
 )
 
 type GrpcPool struct {
@@ -12,9 +14,10 @@ type GrpcPool struct {
 	pool map[string]*grpc.ClientConn
 }
 
+// NewGrpcPool : トレースコンテキストを伝搬するinterceptorは自動で追加される
 func NewGrpcPool(options ...grpc.DialOption) *GrpcPool {
 	return &GrpcPool{
-		opts: options,
+		opts: append(options, grpc.WithChainUnaryInterceptor(trace.UnaryClientInterceptor())),
 		pool: make(map[string]*grpc.ClientConn),
 	}
 }
@@ -59,6 +59,34 @@ func (b *RingBuf[T]) HasData() <-chan struct{} {
 	return b.hasData
 }
 
+// Len returns the number of unread data.
+func (b *RingBuf[T]) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.wSeq - b.rSeq
+}
+
+// Size returns the length of buffer.
+func (b *RingBuf[T]) Size() int {
+	return len(b.buf)
+}
+
+// ReadSeq returns the current read sequence number.
+func (b *RingBuf[T]) ReadSeq() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.rSeq
+}
+
+// Skip discards all unread data and returns the write sequence number.
+// It called from Room.MsgLoop goroutine.
+func (b *RingBuf[T]) Skip() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rSeq = b.wSeq
+	return b.wSeq
+}
+
 // Read returns all message stored in this buffer and last seqence numer.
 // It called from Client.EventLoop goroutine.
 func (b *RingBuf[T]) Read(seq int) ([]T, error) {
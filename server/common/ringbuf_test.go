@@ -125,3 +125,28 @@ func TestReadWithRewind(t *testing.T) {
 		t.Fatalf("Read(2) must error")
 	}
 }
+
+func TestSkip(t *testing.T) {
+	buf := NewEvBuf(2)
+	ev := binary.NewRegularEvent(0, nil)
+
+	buf.Write(ev)
+	buf.Write(ev)
+	if e := buf.Write(ev); e == nil {
+		t.Fatalf("Write must error")
+	}
+
+	if seq := buf.Skip(); seq != 2 {
+		t.Fatalf("Skip() = %v, wants 2", seq)
+	}
+	if e := buf.Write(ev); e != nil {
+		t.Fatalf("Write error after skip: %v", e)
+	}
+	r, err := buf.Read(2)
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if len(r) != 1 {
+		t.Fatalf("Read(2) len=%v, wants 1", len(r))
+	}
+}
@@ -34,6 +34,28 @@ type LogConf struct {
 	LogCompress   bool   `toml:"log_compress"`
 }
 
+type TraceConf struct {
+	// TraceExporter : トレースの出力先. "": 出力しない, "stdout": 標準出力, "file": TracePath
+	TraceExporter string `toml:"trace_exporter"`
+	// TracePath : TraceExporter="file"のときの出力ファイル (JSON Lines)
+	TracePath string `toml:"trace_path"`
+}
+
+type LifecycleConf struct {
+	// LifecycleSinks : 部屋のライフサイクルイベントの出力先. "db", "file", "webhook"を複数指定できる
+	LifecycleSinks []string `toml:"lifecycle_sinks"`
+	// LifecyclePath : "file"の出力ファイル (JSON Lines)
+	LifecyclePath string `toml:"lifecycle_path"`
+	// LifecycleWebhook : "webhook"の送信先URL
+	LifecycleWebhook string `toml:"lifecycle_webhook"`
+	// LifecycleWebhookRetry : webhook送信失敗時のリトライ回数
+	LifecycleWebhookRetry int `toml:"lifecycle_webhook_retry"`
+	// LifecycleBatchSize : まとめて出力するイベントの最大数
+	LifecycleBatchSize int `toml:"lifecycle_batch_size"`
+	// LifecycleFlushInterval : バッチが埋まらなくても出力する間隔
+	LifecycleFlushInterval Duration `toml:"lifecycle_flush_interval"`
+}
+
 type DbConf struct {
 	Host            string
 	Port            int
@@ -54,6 +76,9 @@ type GameConf struct {
 	WebsocketPort int `toml:"websocket_port"`
 	PprofPort     int `toml:"pprof_port"`
 
+	// Region : サーバの地域やゾーン. Lobbyがクライアントの近くのサーバを選ぶのに使う
+	Region string `toml:"region"`
+
 	TLSCert string `toml:"tls_cert"`
 	TLSKey  string `toml:"tls_key"`
 
@@ -74,8 +99,31 @@ type GameConf struct {
 
 	DbMaxConns int `toml:"db_max_conns"`
 
+	// MasterDetachedGrace : Masterの接続が切れてから他のプレイヤーに切り替えるまでの猶予. 0なら切り替えない
+	MasterDetachedGrace Duration `toml:"master_detached_grace"`
+	// MasterMaxRTT : MasterのRTT(ミリ秒)がこれを超えたら他のプレイヤーに切り替える. 0なら切り替えない
+	MasterMaxRTT uint32 `toml:"master_max_rtt"`
+	// MasterSwitchBack : 自動で切り替えた後、元のMasterが復帰したら戻す
+	MasterSwitchBack bool `toml:"master_switch_back"`
+
+	// EventSpill : 再送バッファ(EventBufSize)から溢れた未読イベントの保存先. ""なら保存しない
+	//  - "memory": メモリ上に保持する
+	//  - "file": 部屋毎の追記専用ファイルに書き出す
+	EventSpill string `toml:"event_spill"`
+	// EventSpillSize : EventSpillにクライアントあたり保持するイベント数
+	EventSpillSize int `toml:"event_spill_size"`
+	// EventSpillDir : EventSpillが"file"のときにファイルを作るディレクトリ. 空ならos.TempDir()
+	EventSpillDir string `toml:"event_spill_dir"`
+
+	// ResultSinks : 部屋の終了時に突き合わせた試合結果の出力先. 複数指定できる
+	//  - "db": room_resultテーブル
+	//  - "lifecycle": ライフサイクルイベント(room_result)
+	ResultSinks []string `toml:"result_sinks"`
+
 	ClientConf
 	LogConf
+	TraceConf
+	LifecycleConf
 }
 
 type HubConf struct {
@@ -88,6 +136,9 @@ type HubConf struct {
 	WebsocketPort int `toml:"websocket_port"`
 	PprofPort     int `toml:"pprof_port"`
 
+	// Region : サーバの地域やゾーン. Lobbyが観戦者の近くのHubを選ぶのに使う
+	Region string `toml:"region"`
+
 	TLSCert string `toml:"tls_cert"`
 	TLSKey  string `toml:"tls_key"`
 
@@ -102,10 +153,16 @@ type HubConf struct {
 	HeartBeatInterval Duration `toml:"heartbeat_interval"`
 	NodeCountInterval Duration `toml:"nodecount_interval"`
 
+	// WatcherChatRate : 観戦者1人が1秒間に送れるチャットとリアクションの数. 0なら無制限
+	WatcherChatRate int `toml:"watcher_chat_rate"`
+	// ReactionReportInterval : 観戦者のリアクションを集計してPlayerに送る間隔. 0なら送らない
+	ReactionReportInterval Duration `toml:"reaction_report_interval"`
+
 	DbMaxConns int `toml:"db_max_conns"`
 
 	ClientConf
 	LogConf
+	TraceConf
 }
 
 type ClientConf struct {
@@ -131,13 +188,30 @@ type LobbyConf struct {
 
 	AuthDataExpire Duration `toml:"authdata_expire"`
 
+	// TokenTTL : 管理API(/_admin/token)で発行するbearerの有効期間. 0またはAuthDataExpireより長ければAuthDataExpire
+	TokenTTL Duration `toml:"token_ttl"`
+
 	ApiTimeout Duration `toml:"api_timeout"`
 
 	HubMaxWatchers int `toml:"hub_max_watchers"`
 
+	// OverloadGoroutines : goroutine数がこれを超えたGame/Hubには新しい部屋を割り当てない. 0なら制限しない
+	OverloadGoroutines int `toml:"overload_goroutines"`
+	// OverloadMsgBacklog : 部屋のmsgChの滞留がこれを超えたGame/Hubには新しい部屋を割り当てない. 0なら制限しない
+	OverloadMsgBacklog int `toml:"overload_msg_backlog"`
+	// OverloadFallback : 全てのGame/Hubが閾値を超えているとき、超えていないものとして選ぶ. falseなら割り当てない
+	OverloadFallback bool `toml:"overload_fallback"`
+
 	DbMaxConns int `toml:"db_max_conns"`
 
+	// AdminTokenKey : 管理APIトークンの署名鍵. 空なら管理APIトークンは無効
+	AdminTokenKey string `toml:"admin_token_key"`
+	// AdminLegacyAuth : 管理APIトークンの代わりにAppIdをユーザIDとしたauthdataでのkickを許可する (互換用).
+	// 既存の呼び出し元が移行するまでデフォルトで有効. 将来のリリースでデフォルトを無効にする
+	AdminLegacyAuth bool `toml:"admin_legacy_auth"`
+
 	LogConf
+	TraceConf
 }
 
 type Duration time.Duration
@@ -155,6 +229,7 @@ func (d *Duration) UnmarshalText(text []byte) error {
 // - WSNET2_GAME_PUBLICNAME: Config.{Game,Hub}.PublicName
 // - WSNET2_GAME_GRPCPORT:   Config.{Game,Hub}.GRPCPort
 // - WSNET2_GAME_WSPORT:     Config.{Game,Hub}.WebsocketPort
+// - WSNET2_REGION:          Config.{Game,Hub}.Region
 func Load(conffile string) (*Config, error) {
 	hostname, _ := os.Hostname()
 	if hostname == "" {
@@ -184,6 +259,10 @@ func Load(conffile string) (*Config, error) {
 
 			DbMaxConns: 0,
 
+			EventSpillSize: 4096,
+
+			ResultSinks: []string{"db", "lifecycle"},
+
 			ClientConf: ClientConf{
 				EventBufSize:   128,
 				WaitAfterClose: Duration(30 * time.Second),
@@ -198,6 +277,12 @@ func Load(conffile string) (*Config, error) {
 				LogMaxAge:      0,
 				LogCompress:    false,
 			},
+
+			LifecycleConf: LifecycleConf{
+				LifecycleWebhookRetry:  3,
+				LifecycleBatchSize:     100,
+				LifecycleFlushInterval: Duration(time.Second),
+			},
 		},
 		Hub: HubConf{
 			Hostname:   hostname,
@@ -212,6 +297,8 @@ func Load(conffile string) (*Config, error) {
 			HeartBeatInterval: Duration(2 * time.Second),
 			NodeCountInterval: Duration(1 * time.Second),
 
+			WatcherChatRate: 2,
+
 			DbMaxConns: 0,
 
 			ClientConf: ClientConf{
@@ -238,6 +325,8 @@ func Load(conffile string) (*Config, error) {
 
 			DbMaxConns: 0,
 
+			AdminLegacyAuth: true,
+
 			LogConf: LogConf{
 				LogStdoutLevel: 4,
 				LogPath:        "/var/log/wsnet2/wsnet2-lobby.log",
@@ -317,4 +406,8 @@ func (c *Config) applyEnvVar() {
 		c.Game.GRPCPort = v
 		c.Hub.GRPCPort = v
 	}
+	if v := os.Getenv("WSNET2_REGION"); v != "" {
+		c.Game.Region = v
+		c.Hub.Region = v
+	}
 }
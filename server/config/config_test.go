@@ -45,6 +45,11 @@ func TestLoad(t *testing.T) {
 
 		HeartBeatInterval: Duration(time.Second * 10),
 
+		EventSpill:     "file",
+		EventSpillSize: 4096,
+		EventSpillDir:  "/tmp/wsnet2-evspill",
+		ResultSinks:    []string{"db", "lifecycle"},
+
 		ClientConf: ClientConf{
 			EventBufSize:   512,
 			WaitAfterClose: Duration(time.Second * 60),
@@ -60,6 +65,15 @@ func TestLoad(t *testing.T) {
 			LogMaxAge:        3,
 			LogCompress:      true,
 		},
+
+		LifecycleConf: LifecycleConf{
+			LifecycleSinks:         []string{"file", "webhook"},
+			LifecyclePath:          "/tmp/wsnet2-lifecycle.log",
+			LifecycleWebhook:       "http://localhost:9000/lifecycle",
+			LifecycleWebhookRetry:  3,
+			LifecycleBatchSize:     10,
+			LifecycleFlushInterval: Duration(time.Second),
+		},
 	}
 	if diff := cmp.Diff(c.Game, game); diff != "" {
 		t.Fatalf("c.Game differs: (-got +want)\n%s", diff)
@@ -75,6 +89,9 @@ func TestLoad(t *testing.T) {
 		AuthDataExpire: Duration(time.Second * 10),
 		ApiTimeout:     Duration(time.Second * 5),
 		HubMaxWatchers: 10000,
+
+		AdminLegacyAuth: true,
+
 		LogConf: LogConf{
 			LogStdoutConsole: false,
 			LogStdoutLevel:   4,
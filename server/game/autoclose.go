@@ -0,0 +1,91 @@
+package game
+
+import (
+	"time"
+
+	"wsnet2/binary"
+	"wsnet2/pb"
+)
+
+// autoCloseCheckInterval : 部屋の自動クローズの確認間隔
+const autoCloseCheckInterval = time.Second
+
+// 部屋を閉じた理由 (room_history.close_reason)
+const (
+	closeReasonEmpty    = "all players left"
+	closeReasonGrace    = "empty room grace expired"
+	closeReasonLifetime = "max lifetime exceeded"
+	closeReasonIdle     = "idle timeout"
+)
+
+// closePolicy : 部屋の自動クローズの設定. 0は無効
+type closePolicy struct {
+	// lifetime : 部屋の作成からの最大存続時間
+	lifetime time.Duration
+	// idle : Playerからのメッセージが途絶えてから閉じるまでの時間
+	idle time.Duration
+	// emptyGrace : 全員退室してから閉じるまでの猶予. 0なら即座に閉じる
+	emptyGrace time.Duration
+}
+
+// newClosePolicy : アプリの設定とRoomOptionのうち、0でない短い方を採用する
+func newClosePolicy(app *pb.App, op *pb.RoomOption) closePolicy {
+	return closePolicy{
+		lifetime:   shorterSeconds(app.GetMaxLifetime(), op.MaxLifetime),
+		idle:       shorterSeconds(app.GetIdleTimeout(), op.IdleTimeout),
+		emptyGrace: shorterSeconds(app.GetEmptyGrace(), op.EmptyGrace),
+	}
+}
+
+func shorterSeconds(a, b uint32) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		a = b
+	}
+	return time.Duration(a) * time.Second
+}
+
+func (p closePolicy) enabled() bool {
+	return p.lifetime > 0 || p.idle > 0 || p.emptyGrace > 0
+}
+
+// check : 部屋を閉じるべきならその理由を返す
+func (p closePolicy) check(now, created, lastActive, emptySince time.Time) string {
+	switch {
+	case p.lifetime > 0 && now.Sub(created) >= p.lifetime:
+		return closeReasonLifetime
+	case !emptySince.IsZero() && now.Sub(emptySince) >= p.emptyGrace:
+		return closeReasonGrace
+	case p.idle > 0 && now.Sub(lastActive) >= p.idle:
+		return closeReasonIdle
+	}
+	return ""
+}
+
+// updateLastActive : Playerの入室やRegularMsgを部屋の活動として記録する.
+// Pingなどのシステムメッセージは活動とみなさない.
+func (r *Room) updateLastActive(msg Msg) {
+	switch msg.(type) {
+	case *MsgCreate, *MsgJoin:
+		r.lastActive = time.Now()
+	case binary.RegularMsg:
+		if _, ok := r.lastMsg[string(msg.SenderID())]; ok {
+			r.lastActive = time.Now()
+		}
+	}
+}
+
+// checkAutoClose : 自動クローズの条件を満たしていたら部屋を閉じる
+func (r *Room) checkAutoClose() {
+	r.muClients.Lock()
+	defer r.muClients.Unlock()
+
+	if r.closing {
+		return
+	}
+	reason := r.closePolicy.check(time.Now(), r.Created.Time(), r.lastActive, r.emptySince)
+	if reason == "" {
+		return
+	}
+	r.logger.Infof("close room automatically: %v", reason)
+	r.startClosing(reason)
+}
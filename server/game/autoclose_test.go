@@ -0,0 +1,40 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"wsnet2/pb"
+)
+
+func TestNewClosePolicy(t *testing.T) {
+	app := &pb.App{MaxLifetime: 3600, IdleTimeout: 0, EmptyGrace: 30}
+	op := &pb.RoomOption{MaxLifetime: 7200, IdleTimeout: 600, EmptyGrace: 10}
+	p := newClosePolicy(app, op)
+	wants := closePolicy{lifetime: time.Hour, idle: 10 * time.Minute, emptyGrace: 10 * time.Second}
+	if p != wants {
+		t.Fatalf("policy = %+v, wants %+v", p, wants)
+	}
+}
+
+func TestClosePolicyCheck(t *testing.T) {
+	p := closePolicy{lifetime: time.Hour, idle: 10 * time.Minute, emptyGrace: 30 * time.Second}
+	created := time.Now()
+	var zero time.Time
+
+	tests := map[string]struct {
+		now, lastActive, emptySince time.Time
+		wants                       string
+	}{
+		"alive":    {created.Add(time.Minute), created.Add(30 * time.Second), zero, ""},
+		"idle":     {created.Add(15 * time.Minute), created.Add(time.Minute), zero, closeReasonIdle},
+		"lifetime": {created.Add(time.Hour), created.Add(59 * time.Minute), zero, closeReasonLifetime},
+		"grace":    {created.Add(2 * time.Minute), created.Add(time.Minute), created.Add(90 * time.Second), closeReasonGrace},
+		"empty":    {created.Add(2 * time.Minute), created.Add(time.Minute), created.Add(100 * time.Second), ""},
+	}
+	for name, tc := range tests {
+		if r := p.check(tc.now, created, tc.lastActive, tc.emptySince); r != tc.wants {
+			t.Errorf("%v: reason = %q, wants %q", name, r, tc.wants)
+		}
+	}
+}
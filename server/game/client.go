@@ -5,6 +5,7 @@ import (
 	"crypto/sha1"
 	"hash"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/xerrors"
@@ -14,6 +15,7 @@ import (
 	"wsnet2/binary"
 	"wsnet2/common"
 	"wsnet2/log"
+	"wsnet2/metrics"
 	"wsnet2/pb"
 )
 
@@ -26,14 +28,21 @@ type Client struct {
 	isPlayer  bool
 	nodeCount uint32
 
-	props binary.Dict
+	props        binary.Dict
+	privateProps binary.Dict // 本人とMasterにのみ公開
 
 	removed     chan struct{}
 	removeCause string
 	done        chan struct{}
 	newDeadline chan time.Duration
 
-	evbuf *common.RingBuf[*binary.RegularEvent]
+	evbuf eventBuffer
+
+	// evbufが溢れたときに未読Eventの代わりに送るスナップショット.
+	// evbufの読み出しと排他するためmuEvbufで保護する
+	muEvbuf     sync.Mutex
+	snapshot    *binary.SystemEvent
+	snapshotSeq int
 
 	mu           sync.RWMutex
 	msgSeqNum    int
@@ -42,9 +51,14 @@ type Client struct {
 	renewPeer    chan struct{}
 	connectCount int
 	received     bool
+	detachedAt   time.Time // peerが無くなった時刻. 接続中はゼロ値
+
+	// 接続品質
+	rtt         atomic.Uint32 // サーバがwebsocketのpingで計測したRTT (milli seconds)
+	resendCount atomic.Uint32 // 再接続時に再送したイベント数
 
-	authKey string
-	hmac    hash.Hash
+	authKey string    // muで保護. Rejoinで更新される
+	hmac    hash.Hash // muで保護. Rejoinで更新される
 
 	logger log.Logger
 
@@ -67,22 +81,34 @@ func newClient(info *pb.ClientInfo, macKey string, room IRoom, isPlayer bool) (*
 			codes.InvalidArgument)
 	}
 	info.Props = iProps
+	privateProps, iPrivateProps, err := common.InitProps(info.PrivateProps)
+	if err != nil {
+		return nil, WithCode(
+			xerrors.Errorf("InitProps(private): %w", err),
+			codes.InvalidArgument)
+	}
+	if len(privateProps) == 0 {
+		iPrivateProps = nil // 空のprivate propsはEventに含めない
+	}
+	info.PrivateProps = iPrivateProps
 	c := &Client{
 		ClientInfo: info,
 		room:       room,
 		isPlayer:   isPlayer,
 		nodeCount:  1,
 
-		props: props,
+		props:        props,
+		privateProps: privateProps,
 
 		removed:     make(chan struct{}),
 		done:        make(chan struct{}),
 		newDeadline: make(chan time.Duration, 1),
 
-		evbuf: common.NewRingBuf[*binary.RegularEvent](room.ClientConf().EventBufSize),
+		evbuf: newEventBuffer(room.ClientConf().EventBufSize, room.EventSpill()),
 
-		waitPeer:  make(chan *Peer, 1),
-		renewPeer: make(chan struct{}, 1),
+		waitPeer:   make(chan *Peer, 1),
+		renewPeer:  make(chan struct{}, 1),
+		detachedAt: time.Now(),
 
 		authKey: RandomHex(room.ClientConf().AuthKeyLen),
 		hmac:    hmac.New(sha1.New, []byte(macKey)),
@@ -112,28 +138,82 @@ func (c *Client) RoomID() RoomID {
 }
 
 func (c *Client) AuthKey() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.authKey
 }
 
+// macHash : メッセージの検証に使うhmac
+func (c *Client) macHash() hash.Hash {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.hmac
+}
+
 func (c *Client) NodeCount() uint32 {
 	return c.nodeCount
 }
 
+// Stats : 接続品質
+func (c *Client) Stats() *pb.ClientStats {
+	c.mu.RLock()
+	connectCount := c.connectCount
+	c.mu.RUnlock()
+	return &pb.ClientStats{
+		Id:           c.Id,
+		Rtt:          c.rtt.Load(),
+		ConnectCount: uint32(connectCount),
+		ResendCount:  c.resendCount.Load(),
+		EvbufUsed:    uint32(c.evbuf.Len()),
+		EvbufSize:    uint32(c.evbuf.Size()),
+	}
+}
+
+// DetachedSince : peerが無くなった時刻. 接続中ならゼロ値
+func (c *Client) DetachedSince() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.detachedAt
+}
+
 func (c *Client) Logger() log.Logger {
 	return c.logger
 }
 
 func (c *Client) ValidAuthData(authData string) error {
 	// clientのtimestampは信用できないのでhashだけ検証
-	_, err := auth.ValidAuthDataHash(authData, c.authKey, c.Id)
+	_, err := auth.ValidAuthDataHash(authData, c.AuthKey(), c.Id)
 	return err
 }
 
+// Rejoin : 再入室のためauthKeyとMAC Keyを更新し、接続中のpeerを切断する.
+// 新しいpeerで未読Eventと未受信Msgの再送を受けるための通番を返す.
+// RoomのMsgLoopから呼ばれる
+func (c *Client) Rejoin(macKey string) (authKey string, lastEvSeq, lastMsgSeq int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 旧peerへの送信を止めてから通番を確定させる
+	c.peer.Close("client rejoined")
+
+	c.authKey = RandomHex(c.room.ClientConf().AuthKeyLen)
+	c.hmac = hmac.New(sha1.New, []byte(macKey))
+
+	return c.authKey, c.evbuf.ReadSeq(), c.msgSeqNum
+}
+
 // MsgLoop goroutine.
 func (c *Client) MsgLoop(deadline time.Duration) {
 	var peerMsgCh <-chan binary.Msg
 	var curPeer *Peer
 	t := time.NewTimer(deadline)
+
+	// Hubは複数の観戦者のメッセージを中継するので制限しない
+	var msgRate, msgCount uint32
+	var rateWindow time.Time
+	if !c.IsHub {
+		msgRate = c.room.App().MaxMsgRate
+	}
 loop:
 	for {
 		select {
@@ -182,6 +262,9 @@ loop:
 				}
 			} else {
 				c.connectCount++
+				if c.connectCount > 1 {
+					metrics.Reconnects.Inc()
+				}
 				c.logger.Infof("new peer attached: %v peer=%p", c.Id, c.peer)
 				peerMsgCh = c.peer.MsgCh()
 				curPeer = c.peer
@@ -231,6 +314,20 @@ loop:
 					c.DetachAndClosePeer(curPeer, err)
 					continue
 				}
+
+				if msgRate > 0 {
+					now := time.Now()
+					if now.Sub(rateWindow) >= time.Second {
+						rateWindow = now
+						msgCount = 0
+					}
+					msgCount++
+					if msgCount > msgRate {
+						// アプリ毎の上限を超えたメッセージは破棄してPermissionDeniedを返す
+						c.logger.Infof("client msg rate exceeded: %v max_msg_rate=%v", c.Id, msgRate)
+						msg = &MsgRateExceeded{Sender: c, Msg: regmsg}
+					}
+				}
 			}
 			if !t.Stop() {
 				<-t.C
@@ -272,6 +369,11 @@ func (c *Client) Removed(cause string) {
 	close(c.removed)
 	c.removeCause = cause
 
+	// spillのファイルを他のClientの分だけにできるよう参照を外す
+	if b, ok := c.evbuf.(*tieredBuf); ok {
+		b.release()
+	}
+
 	c.mu.RLock()
 	p := c.peer
 	c.mu.RUnlock()
@@ -295,6 +397,43 @@ func (c *Client) Send(e *binary.RegularEvent) error {
 	return c.evbuf.Write(e)
 }
 
+// Resync : evbufが溢れたとき、未読Eventを破棄してスナップショットから再開させる.
+// snapshotには破棄した直後の通番が渡される.
+// RoomのMsgLoopから呼ばれる
+func (c *Client) Resync(snapshot func(seq int) *binary.SystemEvent) {
+	c.muEvbuf.Lock()
+	defer c.muEvbuf.Unlock()
+	seq := c.evbuf.Skip()
+	c.snapshot = snapshot(seq)
+	c.snapshotSeq = seq
+	c.logger.Infof("resync with snapshot: %v seq=%v", c.Id, seq)
+}
+
+// readEvents : 未読Eventを読み出す.
+// 送信待ちのスナップショットがあれば、それと以降のEventの直前の通番も返す
+func (c *Client) readEvents(lastSeq int) (snapshot *binary.SystemEvent, seq int, evs []*binary.RegularEvent, err error) {
+	c.muEvbuf.Lock()
+	defer c.muEvbuf.Unlock()
+	snapshot, seq = c.snapshot, lastSeq
+	if snapshot != nil {
+		c.snapshot = nil
+		seq = c.snapshotSeq
+	}
+	evs, err = c.evbuf.Read(seq)
+	return snapshot, seq, evs, err
+}
+
+// requeueSnapshot : 送信できなかったスナップショットを次のpeerで送り直す.
+// 既に新しいスナップショットがあればそちらを優先する
+func (c *Client) requeueSnapshot(snapshot *binary.SystemEvent, seq int) {
+	c.muEvbuf.Lock()
+	defer c.muEvbuf.Unlock()
+	if c.snapshot == nil {
+		c.snapshot = snapshot
+		c.snapshotSeq = seq
+	}
+}
+
 // RoomのMsgLoopから呼ばれる.
 func (c *Client) SendSystemEvent(e *binary.SystemEvent) {
 	c.mu.RLock()
@@ -324,7 +463,7 @@ func (c *Client) AttachPeer(p *Peer, lastEvSeq int) error {
 	defer c.mu.Unlock()
 
 	// 未読Eventを再送. client終了後でも送信する.
-	if err := p.SendEvents(c.evbuf); err != nil {
+	if err := p.SendEvents(); err != nil {
 		return xerrors.Errorf("SendEvents: %w", err)
 	}
 
@@ -347,6 +486,7 @@ func (c *Client) AttachPeer(p *Peer, lastEvSeq int) error {
 		c.peer.Close("new peer attached")
 	}
 	c.peer = p
+	c.detachedAt = time.Time{}
 	c.sendRenewPeer()
 	return nil
 }
@@ -373,6 +513,7 @@ func (c *Client) DetachPeer(p *Peer) {
 	}
 
 	c.peer = nil
+	c.detachedAt = time.Now()
 	c.waitPeer = make(chan *Peer, 1)
 	c.sendRenewPeer()
 }
@@ -400,6 +541,7 @@ func (c *Client) DetachAndClosePeer(p *Peer, err error) {
 	}
 
 	c.peer = nil
+	c.detachedAt = time.Now()
 	c.waitPeer = make(chan *Peer, 1)
 	c.sendRenewPeer()
 }
@@ -432,7 +574,7 @@ loop:
 			}
 		}
 
-		if err := peer.SendEvents(c.evbuf); err != nil {
+		if err := peer.SendEvents(); err != nil {
 			// 再接続でも復帰不能なので終わる.
 			c.evErr <- xerrors.Errorf("send event: %w", err)
 			break loop
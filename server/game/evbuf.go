@@ -0,0 +1,415 @@
+package game
+
+import (
+	"os"
+	"sync"
+
+	"golang.org/x/xerrors"
+
+	"wsnet2/binary"
+	"wsnet2/common"
+	"wsnet2/config"
+)
+
+// eventBuffer : Clientに送るEventのバッファ
+type eventBuffer interface {
+	Write(ev *binary.RegularEvent) error
+	HasData() <-chan struct{}
+	Len() int
+	Size() int
+	ReadSeq() int
+	Read(seq int) ([]*binary.RegularEvent, error)
+	Skip() int
+}
+
+var _ eventBuffer = (*common.RingBuf[*binary.RegularEvent])(nil)
+
+// newEventBuffer : spillがnilならRingBufをそのまま使う
+func newEventBuffer(size int, spill SpillStore) eventBuffer {
+	if spill == nil {
+		return common.NewRingBuf[*binary.RegularEvent](size)
+	}
+	return newTieredBuf(size, spill)
+}
+
+// SpillRef : SpillStoreに書き出したEventの位置
+type SpillRef struct {
+	ev  *binary.RegularEvent
+	seg *spillSegment
+	off int64
+	len int
+}
+
+// SpillStore : 再送バッファから溢れた古いEventの保存先.
+// AppendとReleaseは部屋のMsgLoopからのみ呼ばれ、Loadは各ClientのEventLoopから呼ばれる.
+type SpillStore interface {
+	Append(ev *binary.RegularEvent) (SpillRef, error)
+	Load(ref SpillRef) (*binary.RegularEvent, error)
+	// Release : Appendで得たrefを読み出さなくなった. Appendの度に1回呼ぶ
+	Release(ref SpillRef)
+	// Capacity : Clientあたりに保持するEvent数
+	Capacity() int
+	Close() error
+}
+
+// NewSpillStore : 設定に従ってSpillStoreを作る. 無効ならnil
+func NewSpillStore(conf *config.GameConf) (SpillStore, error) {
+	if conf.EventSpillSize <= 0 {
+		return nil, nil
+	}
+	switch conf.EventSpill {
+	case "":
+		return nil, nil
+	case "memory":
+		return &memorySpill{capacity: conf.EventSpillSize}, nil
+	case "file":
+		s, err := newFileSpill(conf.EventSpillDir, conf.EventSpillSize)
+		if err != nil {
+			// *fileSpill(nil)をそのまま返すとnilでないSpillStoreになってしまう
+			return nil, err
+		}
+		return s, nil
+	}
+	return nil, xerrors.Errorf("unknown event_spill: %q", conf.EventSpill)
+}
+
+// memorySpill : Eventをメモリ上に保持する.
+// 保持数はClient毎のSpillRefの数で制限される.
+type memorySpill struct {
+	capacity int
+}
+
+func (s *memorySpill) Append(ev *binary.RegularEvent) (SpillRef, error) {
+	return SpillRef{ev: ev}, nil
+}
+
+func (s *memorySpill) Load(ref SpillRef) (*binary.RegularEvent, error) {
+	return ref.ev, nil
+}
+
+func (s *memorySpill) Release(ref SpillRef) {}
+
+func (s *memorySpill) Capacity() int { return s.capacity }
+func (s *memorySpill) Close() error  { return nil }
+
+// fileSpill : Eventを部屋毎の追記専用ファイルに書き出す.
+// レコードはEvType(1byte)+payload.
+// ファイルはcapacity件毎に切り替え、参照されなくなった古いファイルは削除するので
+// 読み出されないEventでファイルが際限なく大きくなることはない.
+type fileSpill struct {
+	capacity int
+	dir      string
+
+	mu     sync.Mutex
+	cur    *spillSegment
+	segs   map[*spillSegment]struct{}
+	closed bool
+
+	// broadcastされたEventは各Clientから続けて書き出されるので直前のものは共有する
+	last    *binary.RegularEvent
+	lastRef SpillRef
+}
+
+// spillSegment : fileSpillのファイル1つ分
+type spillSegment struct {
+	file    *os.File
+	offset  int64
+	records int
+	refs    int // Releaseされていない参照の数
+}
+
+// newFileSpill : 溢れるまでファイルは作らないが、dirが使えなければエラーにする
+func newFileSpill(dir string, capacity int) (*fileSpill, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	st, err := os.Stat(dir)
+	if err != nil {
+		return nil, xerrors.Errorf("spill dir: %w", err)
+	}
+	if !st.IsDir() {
+		return nil, xerrors.Errorf("spill dir: %q is not a directory", dir)
+	}
+	return &fileSpill{capacity: capacity, dir: dir, segs: make(map[*spillSegment]struct{})}, nil
+}
+
+func (s *fileSpill) Append(ev *binary.RegularEvent) (SpillRef, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return SpillRef{}, xerrors.New("spill file closed")
+	}
+	if s.last == ev {
+		s.lastRef.seg.refs++
+		return s.lastRef, nil
+	}
+	if s.cur == nil || s.cur.records >= s.capacity {
+		f, err := os.CreateTemp(s.dir, "wsnet2-evspill-*")
+		if err != nil {
+			return SpillRef{}, xerrors.Errorf("create spill file: %w", err)
+		}
+		prev := s.cur
+		s.cur = &spillSegment{file: f}
+		s.segs[s.cur] = struct{}{}
+		if prev != nil && prev.refs == 0 {
+			s.remove(prev)
+		}
+	}
+
+	seg := s.cur
+	buf := make([]byte, 0, len(ev.Payload())+1)
+	buf = append(buf, byte(ev.Type()))
+	buf = append(buf, ev.Payload()...)
+	if _, err := seg.file.WriteAt(buf, seg.offset); err != nil {
+		return SpillRef{}, xerrors.Errorf("write spill file: %w", err)
+	}
+	ref := SpillRef{seg: seg, off: seg.offset, len: len(buf)}
+	seg.offset += int64(len(buf))
+	seg.records++
+	seg.refs++
+	s.last, s.lastRef = ev, ref
+	return ref, nil
+}
+
+func (s *fileSpill) Load(ref SpillRef) (*binary.RegularEvent, error) {
+	s.mu.Lock()
+	var f *os.File
+	if ref.seg != nil {
+		f = ref.seg.file
+	}
+	s.mu.Unlock()
+	if f == nil {
+		return nil, xerrors.New("spill file closed")
+	}
+
+	// 追記のみなので書き出し済みの範囲はロック無しで読める
+	buf := make([]byte, ref.len)
+	if _, err := f.ReadAt(buf, ref.off); err != nil {
+		return nil, xerrors.Errorf("read spill file: off=%v len=%v: %w", ref.off, ref.len, err)
+	}
+	return binary.NewRegularEvent(binary.EvType(buf[0]), buf[1:]), nil
+}
+
+func (s *fileSpill) Release(ref SpillRef) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seg := ref.seg
+	if seg == nil || seg.file == nil {
+		return
+	}
+	seg.refs--
+	if seg.refs <= 0 && seg != s.cur {
+		s.remove(seg)
+	}
+}
+
+// remove : ファイルを閉じて削除する. mu のロックを取得してから呼び出すこと
+func (s *fileSpill) remove(seg *spillSegment) error {
+	delete(s.segs, seg)
+	name := seg.file.Name()
+	err := seg.file.Close()
+	seg.file = nil
+	if e := os.Remove(name); err == nil {
+		err = e
+	}
+	return err
+}
+
+func (s *fileSpill) Capacity() int { return s.capacity }
+
+func (s *fileSpill) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.cur = nil
+	s.last = nil
+	var err error
+	for seg := range s.segs {
+		if e := s.remove(seg); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// tieredBuf : 直近のEventはメモリに、それより古いEventはSpillStoreに保持するバッファ.
+// 未読のままringから押し出されたEventだけをspillに書き出すので、再接続時にRingBufより遡って再送できる.
+// 読み出し済みのEventはRingBufと同じくringにある間だけ巻き戻せる.
+// WriteとSkipはRoom.MsgLoop, ReadはClient.EventLoopから呼ばれる.
+type tieredBuf struct {
+	ring  []*binary.RegularEvent
+	refs  []SpillRef
+	spill SpillStore
+
+	mu   sync.RWMutex
+	rSeq int
+	wSeq int
+
+	// oldest : 読み出せる最古の通番
+	oldest int
+
+	hasData chan struct{}
+}
+
+func newTieredBuf(size int, spill SpillStore) *tieredBuf {
+	return &tieredBuf{
+		ring:    make([]*binary.RegularEvent, size),
+		refs:    make([]SpillRef, spill.Capacity()),
+		spill:   spill,
+		hasData: make(chan struct{}, 1),
+	}
+}
+
+func (b *tieredBuf) Write(ev *binary.RegularEvent) error {
+	// wSeqはここでしか書き換えない
+	b.mu.RLock()
+	r, w, oldest := b.rSeq, b.wSeq, b.oldest
+	b.mu.RUnlock()
+
+	rs, ss := len(b.ring), len(b.refs)
+	if w-r >= rs+ss {
+		return xerrors.Errorf("tieredBuf overflow: size=%v+%v, read=%v, write=%v", rs, ss, r, w)
+	}
+
+	// ringから押し出される未読Eventをspillに移す
+	var ref SpillRef
+	evicted := w - rs
+	if evicted >= oldest {
+		if evicted < r {
+			// 読み出し済みなので書き出さない. これより前には巻き戻せなくなる
+			oldest = evicted + 1
+		} else {
+			var err error
+			ref, err = b.spill.Append(b.ring[w%rs])
+			if err != nil {
+				// 未読Eventを失うのでoverflowとして扱う
+				return xerrors.Errorf("tieredBuf spill: seq=%v: %w", evicted, err)
+			}
+		}
+	}
+	if o := w + 1 - rs - ss; oldest < o {
+		oldest = o
+	}
+
+	b.mu.Lock()
+	released := b.dropRefs(oldest)
+	if evicted >= oldest {
+		b.refs[evicted%ss] = ref
+	}
+	b.ring[w%rs] = ev
+	b.oldest = oldest
+	b.wSeq++
+	b.mu.Unlock()
+
+	for _, ref := range released {
+		b.spill.Release(ref)
+	}
+
+	select {
+	case b.hasData <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// dropRefs : oldestより前になって読み出せなくなったspillのEventの参照を外す.
+// mu のロックを取得してから呼び出すこと
+func (b *tieredBuf) dropRefs(oldest int) []SpillRef {
+	rs, ss := len(b.ring), len(b.refs)
+	from, to := max(b.oldest, 0), min(oldest, b.wSeq-rs)
+	var released []SpillRef
+	for s := from; s < to; s++ {
+		released = append(released, b.refs[s%ss])
+		b.refs[s%ss] = SpillRef{}
+	}
+	return released
+}
+
+// release : spillに書き出したEventを全て解放する. 以降はringにあるEventだけ読み出せる.
+// Clientが退室したときにRoom.MsgLoopから呼ばれる
+func (b *tieredBuf) release() {
+	b.mu.Lock()
+	oldest := max(b.oldest, b.wSeq-len(b.ring))
+	released := b.dropRefs(oldest)
+	b.oldest = oldest
+	b.mu.Unlock()
+
+	for _, ref := range released {
+		b.spill.Release(ref)
+	}
+}
+
+func (b *tieredBuf) HasData() <-chan struct{} {
+	return b.hasData
+}
+
+func (b *tieredBuf) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.wSeq - b.rSeq
+}
+
+func (b *tieredBuf) Size() int {
+	return len(b.ring) + len(b.refs)
+}
+
+func (b *tieredBuf) ReadSeq() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.rSeq
+}
+
+func (b *tieredBuf) Skip() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rSeq = b.wSeq
+	return b.wSeq
+}
+
+func (b *tieredBuf) Read(seq int) ([]*binary.RegularEvent, error) {
+	rs, ss := len(b.ring), len(b.refs)
+
+	b.mu.Lock()
+	r, w := b.rSeq, b.wSeq
+	if seq < r {
+		// rewind read seq num
+		if seq < b.oldest {
+			oldest := b.oldest
+			b.mu.Unlock()
+			return nil, xerrors.Errorf("tieredBuf too old seq num: %v, oldest:%v write:%v", seq, oldest, w)
+		}
+		b.rSeq = seq
+		r = seq
+	}
+	if r == w {
+		b.mu.Unlock()
+		return []*binary.RegularEvent{}, nil
+	}
+
+	// spillからの読み出しはロックの外で行う
+	evs := make([]*binary.RegularEvent, w-r)
+	var spilled []SpillRef
+	for s := r; s < w; s++ {
+		if s < w-rs {
+			spilled = append(spilled, b.refs[s%ss])
+		} else {
+			evs[s-r] = b.ring[s%rs]
+		}
+	}
+	b.mu.Unlock()
+
+	for i, ref := range spilled {
+		ev, err := b.spill.Load(ref)
+		if err != nil {
+			return nil, xerrors.Errorf("tieredBuf load seq=%v: %w", r+i, err)
+		}
+		evs[i] = ev
+	}
+
+	b.mu.Lock()
+	b.rSeq = w
+	b.mu.Unlock()
+
+	return evs, nil
+}
@@ -0,0 +1,180 @@
+package game
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"wsnet2/binary"
+	"wsnet2/config"
+)
+
+func TestTieredBuf(t *testing.T) {
+	tests := map[string]*config.GameConf{
+		"memory": {EventSpill: "memory", EventSpillSize: 4},
+		"file":   {EventSpill: "file", EventSpillSize: 4, EventSpillDir: t.TempDir()},
+	}
+	for name, conf := range tests {
+		t.Run(name, func(t *testing.T) {
+			spill, err := NewSpillStore(conf)
+			if err != nil {
+				t.Fatalf("NewSpillStore: %v", err)
+			}
+			defer spill.Close()
+			buf := newEventBuffer(3, spill)
+
+			evs := make([]*binary.RegularEvent, 7)
+			for i := range evs {
+				evs[i] = binary.NewRegularEvent(binary.EvType(i+30), []byte{byte(i)})
+				if err := buf.Write(evs[i]); err != nil {
+					t.Fatalf("Write(%v): %v", i, err)
+				}
+			}
+			// ring(3)+spill(4)を超える未読は書き込めない
+			if err := buf.Write(evs[0]); err == nil {
+				t.Fatalf("Write must overflow")
+			}
+
+			got, err := buf.Read(0)
+			if err != nil {
+				t.Fatalf("Read(0): %v", err)
+			}
+			if !reflect.DeepEqual(got, evs) {
+				t.Fatalf("Read(0) = %v, wants %v", got, evs)
+			}
+
+			// 未読のままspillに移ったEventは読み出した後も巻き戻せる
+			got, err = buf.Read(1)
+			if err != nil {
+				t.Fatalf("Read(1): %v", err)
+			}
+			if !reflect.DeepEqual(got, evs[1:]) {
+				t.Fatalf("Read(1) = %v, wants %v", got, evs[1:])
+			}
+
+			more := []*binary.RegularEvent{
+				binary.NewRegularEvent(40, []byte{7}),
+				binary.NewRegularEvent(41, []byte{8}),
+			}
+			for _, ev := range more {
+				if err := buf.Write(ev); err != nil {
+					t.Fatalf("Write: %v", err)
+				}
+			}
+
+			// 読み出し済みでringから押し出されたEventより前には巻き戻せない
+			if _, err := buf.Read(5); err == nil {
+				t.Fatalf("Read(5) must be too old")
+			}
+			got, err = buf.Read(6)
+			if err != nil {
+				t.Fatalf("Read(6): %v", err)
+			}
+			wants := append(append([]*binary.RegularEvent{}, evs[6:]...), more...)
+			if !reflect.DeepEqual(got, wants) {
+				t.Fatalf("Read(6) = %v, wants %v", got, wants)
+			}
+		})
+	}
+}
+
+func TestFileSpill(t *testing.T) {
+	dir := t.TempDir()
+
+	// 使えないディレクトリならnilのSpillStoreを返す
+	spill, err := NewSpillStore(&config.GameConf{EventSpill: "file", EventSpillSize: 4, EventSpillDir: filepath.Join(dir, "none")})
+	if err == nil {
+		t.Fatalf("NewSpillStore must fail")
+	}
+	if spill != nil {
+		t.Fatalf("spill = %#v, wants nil", spill)
+	}
+	if buf := newEventBuffer(3, spill); buf == nil {
+		t.Fatalf("newEventBuffer returns nil")
+	}
+
+	// ファイルは最初のAppendで作る
+	spill, err = NewSpillStore(&config.GameConf{EventSpill: "file", EventSpillSize: 4, EventSpillDir: dir})
+	if err != nil {
+		t.Fatalf("NewSpillStore: %v", err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("files created before Append: %v", files)
+	}
+	ev := binary.NewRegularEvent(30, []byte{1})
+	ref, err := spill.Append(ev)
+	if err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("files = %v, wants 1", files)
+	}
+	if got, err := spill.Load(ref); err != nil || !reflect.DeepEqual(got, ev) {
+		t.Fatalf("Load = %v, %v, wants %v", got, err, ev)
+	}
+
+	spill.Close()
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("files remain after Close: %v", files)
+	}
+	if _, err := spill.Append(binary.NewRegularEvent(31, nil)); err == nil {
+		t.Fatalf("Append after Close must fail")
+	}
+}
+
+func TestFileSpillBounded(t *testing.T) {
+	dir := t.TempDir()
+	spill, err := NewSpillStore(&config.GameConf{EventSpill: "file", EventSpillSize: 4, EventSpillDir: dir})
+	if err != nil {
+		t.Fatalf("NewSpillStore: %v", err)
+	}
+	defer spill.Close()
+	buf := newEventBuffer(3, spill)
+
+	diskUsage := func() int64 {
+		var total int64
+		files, _ := os.ReadDir(dir)
+		for _, f := range files {
+			if info, err := f.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return total
+	}
+	payload := make([]byte, 100)
+
+	// 読み出しが追いついていればspillには書き出さない
+	for i := 0; i < 20; i++ {
+		if err := buf.Write(binary.NewRegularEvent(30, payload)); err != nil {
+			t.Fatalf("Write(%v): %v", i, err)
+		}
+		if _, err := buf.Read(buf.ReadSeq()); err != nil {
+			t.Fatalf("Read(%v): %v", i, err)
+		}
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("spilled read events: %v", files)
+	}
+
+	// 遅れて読み出すときも、ring+spillを大きく超えて書き込んだファイルは残らない
+	for i := 0; i < 50; i++ {
+		for j := 0; j < 7; j++ {
+			if err := buf.Write(binary.NewRegularEvent(30, payload)); err != nil {
+				t.Fatalf("Write(%v, %v): %v", i, j, err)
+			}
+		}
+		if _, err := buf.Read(buf.ReadSeq()); err != nil {
+			t.Fatalf("Read(%v): %v", i, err)
+		}
+	}
+	// 参照中のファイルと書き込み中のファイルの2つ分まで
+	if size, limit := diskUsage(), int64(2*4*(len(payload)+1)); size > limit {
+		t.Fatalf("spill files = %v bytes, wants <= %v", size, limit)
+	}
+
+	buf.(*tieredBuf).release()
+	if size, limit := diskUsage(), int64(4*(len(payload)+1)); size > limit {
+		t.Fatalf("spill files after release = %v bytes, wants <= %v", size, limit)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 	"wsnet2/config"
 	"wsnet2/log"
+	"wsnet2/pb"
 )
 
 type RoomID string
@@ -16,6 +17,13 @@ type IRoom interface {
 
 	ClientConf() *config.ClientConf
 
+	// EventSpill returns the store for events overflowed from the client's buffer.
+	// It returns nil if disabled.
+	EventSpill() SpillStore
+
+	// App returns the app including its quotas.
+	App() *pb.App
+
 	Deadline() time.Duration
 	WaitGroup() *sync.WaitGroup
 	Logger() log.Logger
@@ -0,0 +1,165 @@
+package game
+
+import (
+	"time"
+
+	"wsnet2/binary"
+	"wsnet2/pb"
+)
+
+// lockstep : ロックステップの部屋のフレーム.
+// muClients で保護する.
+//
+// Playerはフレーム番号をつけて入力を送り、全Playerの入力が揃うか
+// frameTimeoutを過ぎたらEvFrameとしてまとめて配信する.
+// EvFrameは通常のEventなので、再接続や再入室では通番に従って再送される.
+type lockstep struct {
+	// frame : 次に配信するフレーム
+	frame      uint32
+	inputDelay uint32
+	inputs     map[uint32]map[ClientID][]byte
+
+	timeout  time.Duration
+	deadline time.Time
+	timer    *time.Timer
+}
+
+// newLockstep : ロックステップでなければnil
+func newLockstep(enabled bool, inputDelay, timeoutMS uint32) *lockstep {
+	if !enabled {
+		return nil
+	}
+	ls := &lockstep{
+		inputDelay: inputDelay,
+		inputs:     make(map[uint32]map[ClientID][]byte),
+		timeout:    time.Duration(timeoutMS) * time.Millisecond,
+	}
+	if ls.timeout > 0 {
+		ls.timer = time.NewTimer(ls.timeout)
+		ls.timer.Stop()
+	}
+	return ls
+}
+
+// timeoutC : フレームの待ち時間を通知するchannel. 無制限ならnil
+func (ls *lockstep) timeoutC() <-chan time.Time {
+	if ls == nil || ls.timer == nil {
+		return nil
+	}
+	return ls.timer.C
+}
+
+// startTimer : 次のフレームの入力が来ていれば待ち時間を計りはじめる
+func (ls *lockstep) startTimer() {
+	if ls.timer == nil {
+		return
+	}
+	if len(ls.inputs[ls.frame]) == 0 {
+		ls.timer.Stop()
+		ls.deadline = time.Time{}
+		return
+	}
+	ls.deadline = time.Now().Add(ls.timeout)
+	ls.timer.Reset(ls.timeout)
+}
+
+func (ls *lockstep) info() *pb.LockstepInfo {
+	if ls == nil {
+		return nil
+	}
+	return &pb.LockstepInfo{
+		Frame:        ls.frame,
+		InputDelay:   ls.inputDelay,
+		FrameTimeout: uint32(ls.timeout / time.Millisecond),
+	}
+}
+
+func (ls *lockstep) stop() {
+	if ls != nil && ls.timer != nil {
+		ls.timer.Stop()
+	}
+}
+
+// sendFrames : 全Playerの入力が揃ったフレームを配信する.
+// fillがtrueなら次のフレームは揃っていなくても配信する.
+// muClients のロックを取得してから呼び出すこと
+func (r *Room) sendFrames(fill bool) {
+	ls := r.lockstep
+	if ls == nil {
+		return
+	}
+	for {
+		inputs := ls.inputs[ls.frame]
+		frame := make(binary.Dict, len(r.players))
+		arrived := 0
+		for id := range r.players {
+			if in, ok := inputs[id]; ok {
+				frame[string(id)] = in
+				arrived++
+			} else {
+				frame[string(id)] = binary.MarshalNull()
+			}
+		}
+		if len(r.players) == 0 || (!fill && arrived < len(r.players)) {
+			return
+		}
+		fill = false
+
+		delete(ls.inputs, ls.frame)
+		r.broadcast(binary.NewEvFrame(ls.frame, frame))
+		ls.frame++
+		ls.startTimer()
+	}
+}
+
+// checkFrameTimeout : 待ち時間を過ぎたフレームを揃っていない入力を空にして配信する
+func (r *Room) checkFrameTimeout() {
+	r.muClients.Lock()
+	defer r.muClients.Unlock()
+
+	ls := r.lockstep
+	if ls.deadline.IsZero() || time.Now().Before(ls.deadline) {
+		// 待っている間に配信された
+		return
+	}
+	r.logger.Debugf("frame timeout: %v inputs=%v/%v", ls.frame, len(ls.inputs[ls.frame]), len(r.players))
+	r.sendFrames(true)
+}
+
+func (r *Room) msgFrameInput(msg *MsgFrameInput) {
+	r.muClients.Lock()
+	defer r.muClients.Unlock()
+
+	ls := r.lockstep
+	if ls == nil || !msg.Sender.isPlayer {
+		msg.Sender.logger.Warnf("msgFrameInput: room is not lockstep or sender %q is not a player", msg.Sender.Id)
+		r.sendTo(msg.Sender, binary.NewEvPermissionDenied(msg))
+		return
+	}
+	if r.players[msg.Sender.ID()] != msg.Sender {
+		return
+	}
+
+	// 配信済みのフレームと入力遅延を超えて先のフレームは受け付けない
+	if msg.Frame < ls.frame || msg.Frame > ls.frame+ls.inputDelay {
+		msg.Sender.logger.Infof("msgFrameInput: frame %v out of range [%v, %v]", msg.Frame, ls.frame, ls.frame+ls.inputDelay)
+		r.sendTo(msg.Sender, binary.NewEvPermissionDenied(msg))
+		return
+	}
+	inputs, ok := ls.inputs[msg.Frame]
+	if !ok {
+		inputs = make(map[ClientID][]byte, len(r.players))
+		ls.inputs[msg.Frame] = inputs
+	}
+	if _, dup := inputs[msg.Sender.ID()]; dup {
+		msg.Sender.logger.Infof("msgFrameInput: frame %v already received", msg.Frame)
+		r.sendTo(msg.Sender, binary.NewEvPermissionDenied(msg))
+		return
+	}
+	inputs[msg.Sender.ID()] = msg.Input
+
+	if msg.Frame == ls.frame && ls.deadline.IsZero() {
+		ls.startTimer()
+	}
+	r.sendFrames(false)
+}
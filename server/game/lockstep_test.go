@@ -0,0 +1,97 @@
+package game
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"wsnet2/binary"
+	"wsnet2/pb"
+)
+
+func TestSendFrames(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+	r := &Room{
+		players:  make(map[ClientID]*Client),
+		watchers: make(map[ClientID]*Client),
+		lockstep: newLockstep(true, 2, 0),
+		logger:   logger,
+	}
+	for _, id := range []string{"p1", "p2"} {
+		r.players[ClientID(id)] = &Client{
+			ClientInfo: &pb.ClientInfo{Id: id},
+			isPlayer:   true,
+			evbuf:      newEventBuffer(8, nil),
+			logger:     logger,
+		}
+	}
+	mac := hmac.New(sha1.New, []byte("key"))
+	input := func(id string, frame uint32, in []byte) {
+		data := binary.BuildRegularMsgFrame(binary.MsgTypeFrameInput, 1, binary.MarshalFrameInputPayload(frame, in), mac)
+		m, err := binary.UnmarshalMsg(mac, data)
+		if err != nil {
+			t.Fatalf("UnmarshalMsg: %v", err)
+		}
+		msg, err := ConstructMsg(r.players[ClientID(id)], m)
+		if err != nil {
+			t.Fatalf("ConstructMsg: %v", err)
+		}
+		r.msgFrameInput(msg.(*MsgFrameInput))
+	}
+	frames := func(id string) []*binary.RegularEvent {
+		evs, err := r.players[ClientID(id)].evbuf.Read(r.players[ClientID(id)].evbuf.ReadSeq())
+		if err != nil {
+			t.Fatalf("read evbuf: %v", err)
+		}
+		return evs
+	}
+	// Dictの並びは不定なのでunmarshalして比べる
+	decode := func(evs []*binary.RegularEvent) map[uint32]binary.Dict {
+		frames := make(map[uint32]binary.Dict)
+		for _, ev := range evs {
+			f, inputs, err := binary.UnmarshalEvFramePayload(ev.Payload())
+			if err != nil {
+				t.Fatalf("UnmarshalEvFramePayload: %v", err)
+			}
+			frames[f] = inputs
+		}
+		return frames
+	}
+
+	input("p1", 0, []byte{1})
+	input("p1", 1, []byte{2})
+	if evs := frames("p2"); len(evs) != 0 {
+		t.Fatalf("frames sent before all inputs arrived: %v", evs)
+	}
+
+	// p2の入力で揃ったフレームがまとめて配信される
+	input("p2", 1, []byte{3})
+	input("p2", 0, []byte{4})
+	wants := map[uint32]binary.Dict{
+		0: {"p1": {1}, "p2": {4}},
+		1: {"p1": {2}, "p2": {3}},
+	}
+	if evs := decode(frames("p2")); !reflect.DeepEqual(evs, wants) {
+		t.Fatalf("frames = %v, wants %v", evs, wants)
+	}
+
+	// 入力遅延を超えたフレームは拒否される
+	input("p1", 5, []byte{5})
+	evs := frames("p1")
+	if len(evs) != 3 || evs[2].Type() != binary.EvTypePermissionDenied {
+		t.Fatalf("frame out of range must be denied: %v", evs)
+	}
+
+	// 揃っていない入力はNullで埋める
+	input("p1", 2, []byte{6})
+	r.sendFrames(true)
+	wants = map[uint32]binary.Dict{
+		2: {"p1": {6}, "p2": binary.MarshalNull()},
+	}
+	if evs := decode(frames("p2")); !reflect.DeepEqual(evs, wants) {
+		t.Fatalf("frames = %v, wants %v", evs, wants)
+	}
+}
@@ -17,6 +17,7 @@ type Msg interface {
 var _ Msg = &MsgCreate{}
 var _ Msg = &MsgJoin{}
 var _ Msg = &MsgWatch{}
+var _ Msg = &MsgRejoin{}
 var _ Msg = &MsgPing{}
 var _ Msg = &MsgNodeCount{}
 var _ Msg = &MsgLeave{}
@@ -25,7 +26,16 @@ var _ Msg = &MsgClientProp{}
 var _ Msg = &MsgBroadcast{}
 var _ Msg = &MsgSwitchMaster{}
 var _ Msg = &MsgKick{}
+var _ Msg = &MsgSubmitResult{}
+var _ Msg = &MsgEndTurn{}
+var _ Msg = &MsgFrameInput{}
+var _ Msg = &MsgSetTimer{}
+var _ Msg = &MsgWatcherChat{}
+var _ Msg = &MsgWatcherReaction{}
+var _ Msg = &MsgReactionCounts{}
+var _ Msg = &MsgSetWatcherChat{}
 var _ Msg = &MsgClientError{}
+var _ Msg = &MsgRateExceeded{}
 var _ Msg = &MsgClientTimeout{}
 
 const adminClientID = ClientID("")
@@ -37,6 +47,19 @@ type JoinedInfo struct {
 	Client   *Client
 	MasterId ClientID
 	Deadline time.Duration
+	Turn     *pb.TurnInfo
+	Lockstep *pb.LockstepInfo
+	Timers   []*pb.RoomTimer
+	// ServerTime : Timersの残り時間を計算した時刻
+	ServerTime time.Time
+}
+
+// RejoinedInfo : MsgRejoin成功時点の情報
+type RejoinedInfo struct {
+	JoinedInfo
+	AuthKey      string
+	LastEventSeq int
+	LastMsgSeq   int
 }
 
 // MsgCreate : 部屋作成メッセージ
@@ -84,6 +107,22 @@ func (m *MsgWatch) SenderID() ClientID {
 	return ClientID(m.Info.Id)
 }
 
+// MsgRejoin : 既存Clientへの再入室メッセージ.
+// Clientを差し替えずに再送を受けられるようにする.
+// gRPCリクエストよりwsnet内で発生
+type MsgRejoin struct {
+	ClientId ClientID
+	MACKey   string
+	Rejoined chan<- *RejoinedInfo
+	Err      chan<- ErrorWithCode
+}
+
+func (*MsgRejoin) msg() {}
+
+func (m *MsgRejoin) SenderID() ClientID {
+	return m.ClientId
+}
+
 // MsgPing : タイムアウト防止定期通信.
 // nonregular message
 type MsgPing struct {
@@ -154,6 +193,41 @@ func (m *MsgAdminKick) SenderID() ClientID {
 	return adminClientID
 }
 
+// MsgAdminClose : 部屋を強制終了する
+// gRPCから実行される
+type MsgAdminClose struct {
+	Reason string
+	Res    chan<- error
+}
+
+func (*MsgAdminClose) msg() {}
+func (m *MsgAdminClose) SenderID() ClientID {
+	return adminClientID
+}
+
+// MsgAdminNotice : 部屋の全員にお知らせを送る
+// gRPCから実行される
+type MsgAdminNotice struct {
+	Message string
+	Res     chan<- error
+}
+
+func (*MsgAdminNotice) msg() {}
+func (m *MsgAdminNotice) SenderID() ClientID {
+	return adminClientID
+}
+
+// msgCloseRoom : 部屋を閉じる
+// MsgAdminCloseや自動クローズの後、イベント送信の猶予をおいてRoom自身が送る
+type msgCloseRoom struct {
+	Reason string
+}
+
+func (*msgCloseRoom) msg() {}
+func (m *msgCloseRoom) SenderID() ClientID {
+	return adminClientID
+}
+
 // MsgLeave : 退室メッセージ
 // クライアントの自発的な退室リクエスト
 type MsgLeave struct {
@@ -209,8 +283,9 @@ func msgRoomProp(sender *Client, msg binary.RegularMsg) (Msg, error) {
 // MsgClientProp : 自身のプロパティの変更
 type MsgClientProp struct {
 	binary.RegularMsg
-	Sender *Client
-	Props  binary.Dict
+	Sender       *Client
+	Props        binary.Dict
+	PrivateProps binary.Dict // 本人とMasterにのみ公開
 }
 
 func (*MsgClientProp) msg() {}
@@ -220,14 +295,15 @@ func (m *MsgClientProp) SenderID() ClientID {
 }
 
 func msgClientProp(sender *Client, msg binary.RegularMsg) (Msg, error) {
-	props, err := binary.UnmarshalClientPropPayload(msg.Payload())
+	props, privateProps, err := binary.UnmarshalClientPropPayload(msg.Payload())
 	if err != nil {
 		return nil, err
 	}
 	return &MsgClientProp{
-		RegularMsg: msg,
-		Sender:     sender,
-		Props:      props,
+		RegularMsg:   msg,
+		Sender:       sender,
+		Props:        props,
+		PrivateProps: privateProps,
 	}, nil
 }
 
@@ -354,6 +430,212 @@ func msgKick(sender *Client, msg binary.RegularMsg) (Msg, error) {
 	}, nil
 }
 
+// MsgSubmitResult : 試合結果の提出
+// Playerからのみ受け付ける.
+type MsgSubmitResult struct {
+	binary.RegularMsg
+	Sender *Client
+	Result map[string]any
+}
+
+func (*MsgSubmitResult) msg() {}
+
+func (m *MsgSubmitResult) SenderID() ClientID {
+	return m.Sender.ID()
+}
+
+func msgSubmitResult(sender *Client, msg binary.RegularMsg) (Msg, error) {
+	result, err := binary.UnmarshalSubmitResultPayload(msg.Payload())
+	if err != nil {
+		return nil, err
+	}
+	return &MsgSubmitResult{
+		RegularMsg: msg,
+		Sender:     sender,
+		Result:     result,
+	}, nil
+}
+
+// MsgEndTurn : 手番を終える
+// ターン制の部屋で手番のPlayerからのみ受け付ける.
+type MsgEndTurn struct {
+	binary.RegularMsg
+	Sender *Client
+}
+
+func (*MsgEndTurn) msg() {}
+
+func (m *MsgEndTurn) SenderID() ClientID {
+	return m.Sender.ID()
+}
+
+func msgEndTurn(sender *Client, msg binary.RegularMsg) (Msg, error) {
+	return &MsgEndTurn{
+		RegularMsg: msg,
+		Sender:     sender,
+	}, nil
+}
+
+// MsgFrameInput : ロックステップのフレームの入力
+// ロックステップの部屋のPlayerからのみ受け付ける.
+type MsgFrameInput struct {
+	binary.RegularMsg
+	Sender *Client
+	Frame  uint32
+	Input  []byte
+}
+
+func (*MsgFrameInput) msg() {}
+
+func (m *MsgFrameInput) SenderID() ClientID {
+	return m.Sender.ID()
+}
+
+func msgFrameInput(sender *Client, msg binary.RegularMsg) (Msg, error) {
+	frame, input, err := binary.UnmarshalFrameInputPayload(msg.Payload())
+	if err != nil {
+		return nil, err
+	}
+	return &MsgFrameInput{
+		RegularMsg: msg,
+		Sender:     sender,
+		Frame:      frame,
+		Input:      input,
+	}, nil
+}
+
+// MsgSetTimer : 部屋のタイマーの設定
+// MasterClientからのみ受け付ける.
+type MsgSetTimer struct {
+	binary.RegularMsg
+	Sender   *Client
+	Name     string
+	Duration time.Duration
+}
+
+func (*MsgSetTimer) msg() {}
+
+func (m *MsgSetTimer) SenderID() ClientID {
+	return m.Sender.ID()
+}
+
+func msgSetTimer(sender *Client, msg binary.RegularMsg) (Msg, error) {
+	name, d, err := binary.UnmarshalSetTimerPayload(msg.Payload())
+	if err != nil {
+		return nil, err
+	}
+	return &MsgSetTimer{
+		RegularMsg: msg,
+		Sender:     sender,
+		Name:       name,
+		Duration:   d,
+	}, nil
+}
+
+// MsgWatcherChat : 観戦者チャット
+// Hubが処理し、Gameサーバには送らない.
+type MsgWatcherChat struct {
+	binary.RegularMsg
+	Sender  *Client
+	Message string
+}
+
+func (*MsgWatcherChat) msg() {}
+
+func (m *MsgWatcherChat) SenderID() ClientID {
+	return m.Sender.ID()
+}
+
+func msgWatcherChat(sender *Client, msg binary.RegularMsg) (Msg, error) {
+	message, err := binary.UnmarshalWatcherChatPayload(msg.Payload())
+	if err != nil {
+		return nil, err
+	}
+	return &MsgWatcherChat{
+		RegularMsg: msg,
+		Sender:     sender,
+		Message:    message,
+	}, nil
+}
+
+// MsgWatcherReaction : 観戦者のリアクション
+// Hubが処理し、集計結果だけをGameサーバに送る.
+type MsgWatcherReaction struct {
+	binary.RegularMsg
+	Sender   *Client
+	Reaction string
+}
+
+func (*MsgWatcherReaction) msg() {}
+
+func (m *MsgWatcherReaction) SenderID() ClientID {
+	return m.Sender.ID()
+}
+
+func msgWatcherReaction(sender *Client, msg binary.RegularMsg) (Msg, error) {
+	reaction, err := binary.UnmarshalWatcherReactionPayload(msg.Payload())
+	if err != nil {
+		return nil, err
+	}
+	return &MsgWatcherReaction{
+		RegularMsg: msg,
+		Sender:     sender,
+		Reaction:   reaction,
+	}, nil
+}
+
+// MsgReactionCounts : Hubで集計した観戦者のリアクション
+// Hubからのみ受け付ける.
+type MsgReactionCounts struct {
+	binary.RegularMsg
+	Sender *Client
+	Counts map[string]uint32
+}
+
+func (*MsgReactionCounts) msg() {}
+
+func (m *MsgReactionCounts) SenderID() ClientID {
+	return m.Sender.ID()
+}
+
+func msgReactionCounts(sender *Client, msg binary.RegularMsg) (Msg, error) {
+	counts, err := binary.UnmarshalReactionCountsPayload(msg.Payload())
+	if err != nil {
+		return nil, err
+	}
+	return &MsgReactionCounts{
+		RegularMsg: msg,
+		Sender:     sender,
+		Counts:     counts,
+	}, nil
+}
+
+// MsgSetWatcherChat : 観戦者チャットの有効/無効の切り替え
+// MasterClientからのみ受け付ける.
+type MsgSetWatcherChat struct {
+	binary.RegularMsg
+	Sender  *Client
+	Enabled bool
+}
+
+func (*MsgSetWatcherChat) msg() {}
+
+func (m *MsgSetWatcherChat) SenderID() ClientID {
+	return m.Sender.ID()
+}
+
+func msgSetWatcherChat(sender *Client, msg binary.RegularMsg) (Msg, error) {
+	enabled, err := binary.UnmarshalSetWatcherChatPayload(msg.Payload())
+	if err != nil {
+		return nil, err
+	}
+	return &MsgSetWatcherChat{
+		RegularMsg: msg,
+		Sender:     sender,
+		Enabled:    enabled,
+	}, nil
+}
+
 // MsgClientError : Client内部エラー（内部で発生）
 type MsgClientError struct {
 	Sender *Client
@@ -366,6 +648,18 @@ func (m *MsgClientError) SenderID() ClientID {
 	return m.Sender.ID()
 }
 
+// MsgRateExceeded : max_msg_rateを超えて破棄したメッセージ（内部で発生）
+type MsgRateExceeded struct {
+	Sender *Client
+	Msg    binary.RegularMsg
+}
+
+func (*MsgRateExceeded) msg() {}
+
+func (m *MsgRateExceeded) SenderID() ClientID {
+	return m.Sender.ID()
+}
+
 // MsgClientTimeout : タイムアウトによるClientの退室
 type MsgClientTimeout struct {
 	Sender *Client
@@ -399,6 +693,22 @@ func ConstructMsg(cli *Client, m binary.Msg) (msg Msg, err error) {
 		return msgSwitchMaster(cli, m.(binary.RegularMsg))
 	case binary.MsgTypeKick:
 		return msgKick(cli, m.(binary.RegularMsg))
+	case binary.MsgTypeSubmitResult:
+		return msgSubmitResult(cli, m.(binary.RegularMsg))
+	case binary.MsgTypeEndTurn:
+		return msgEndTurn(cli, m.(binary.RegularMsg))
+	case binary.MsgTypeFrameInput:
+		return msgFrameInput(cli, m.(binary.RegularMsg))
+	case binary.MsgTypeSetTimer:
+		return msgSetTimer(cli, m.(binary.RegularMsg))
+	case binary.MsgTypeWatcherChat:
+		return msgWatcherChat(cli, m.(binary.RegularMsg))
+	case binary.MsgTypeWatcherReaction:
+		return msgWatcherReaction(cli, m.(binary.RegularMsg))
+	case binary.MsgTypeReactionCounts:
+		return msgReactionCounts(cli, m.(binary.RegularMsg))
+	case binary.MsgTypeSetWatcherChat:
+		return msgSetWatcherChat(cli, m.(binary.RegularMsg))
 	}
 	return nil, xerrors.Errorf("unknown msg type: %T %v", m, m)
 }
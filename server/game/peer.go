@@ -2,16 +2,18 @@ package game
 
 import (
 	"context"
+	ebinary "encoding/binary"
 	"errors"
+	"hash"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/shiguredo/websocket"
 	"golang.org/x/xerrors"
 
 	"wsnet2/binary"
-	"wsnet2/common"
 	"wsnet2/metrics"
 )
 
@@ -30,6 +32,7 @@ type Peer struct {
 	client *Client
 	conn   *websocket.Conn
 	msgCh  chan binary.Msg
+	hmac   hash.Hash
 
 	done     chan struct{}
 	detached chan struct{}
@@ -38,6 +41,9 @@ type Peer struct {
 	closed  bool
 
 	evSeqNum int
+
+	// pingSent : 応答待ちのwebsocket pingの送信時刻 (unix nano). 0なら応答待ちなし
+	pingSent atomic.Int64
 }
 
 func NewPeer(ctx context.Context, cli *Client, conn *websocket.Conn, lastEvSeq int) (*Peer, error) {
@@ -45,6 +51,7 @@ func NewPeer(ctx context.Context, cli *Client, conn *websocket.Conn, lastEvSeq i
 		client: cli,
 		conn:   conn,
 		msgCh:  make(chan binary.Msg),
+		hmac:   cli.macHash(),
 
 		done:     make(chan struct{}),
 		detached: make(chan struct{}),
@@ -52,6 +59,7 @@ func NewPeer(ctx context.Context, cli *Client, conn *websocket.Conn, lastEvSeq i
 		evSeqNum: lastEvSeq,
 	}
 	conn.SetCloseHandler(func(code int, text string) error { return nil }) // CloseMessageの返送はこちらで制御する
+	conn.SetPongHandler(p.onPong)
 	err := cli.AttachPeer(p, lastEvSeq)
 	if err != nil {
 		p.closeWithMessage(websocket.CloseGoingAway, err.Error())
@@ -104,16 +112,19 @@ func (p *Peer) SendSystemEvent(ev *binary.SystemEvent) {
 }
 
 // SendEvents : evbufに蓄積されてるイベントを送信
+// evbufが溢れていた場合はスナップショットを先に送信する.
 // 送信失敗時はPeerを閉じて再接続できるようにする. errorは返さない.
 // 再接続しても復帰不能な場合はerrorを返す（Client.EventLoopを止める）.
-func (p *Peer) SendEvents(evbuf *common.RingBuf[*binary.RegularEvent]) error {
+func (p *Peer) SendEvents() error {
+	defer metrics.SendEventsLatency.ObserveSince(time.Now())
 	p.muWrite.Lock()
 	defer p.muWrite.Unlock()
 	if p.closed {
 		return nil
 	}
 
-	evs, err := evbuf.Read(p.evSeqNum)
+	rseq := p.client.evbuf.ReadSeq()
+	snapshot, seqNum, evs, err := p.client.readEvents(p.evSeqNum)
 	if err != nil {
 		// evSeqNumが古すぎるため. 復帰不能.
 		// 頻発するようならevbufのサイズ(ClientConf.EventBufSize)を拡張したほうがよいかも
@@ -128,8 +139,21 @@ func (p *Peer) SendEvents(evbuf *common.RingBuf[*binary.RegularEvent]) error {
 			err.Error())
 		return err
 	}
+	if snapshot != nil {
+		err := writeMessage(p.conn, websocket.BinaryMessage, snapshot.Marshal())
+		if err != nil {
+			// 新しいpeerで送り直す
+			p.client.logger.Warnf("peer send %v (%v, %p): %+v", snapshot.Type(), p.client.Id, p, err)
+			p.client.requeueSnapshot(snapshot, seqNum)
+			p.sendCloseAndCloseConn(websocket.CloseInternalServerErr, err.Error())
+			return nil
+		}
+		metrics.Resyncs.Inc()
+	} else if p.evSeqNum < rseq {
+		// 送信済みだがクライアントに届かなかったイベントを再送する
+		p.client.resendCount.Add(uint32(rseq - p.evSeqNum))
+	}
 
-	seqNum := p.evSeqNum
 	for _, ev := range evs {
 		seqNum++
 		buf := ev.Marshal(seqNum)
@@ -145,6 +169,37 @@ func (p *Peer) SendEvents(evbuf *common.RingBuf[*binary.RegularEvent]) error {
 	return nil
 }
 
+// sendPing : RTTを計測するためにwebsocketのpingを送信する.
+// クライアントのPing毎に送るので、クライアントが報告するRTTは使わずにサーバ側で計測できる.
+func (p *Peer) sendPing() {
+	p.muWrite.Lock()
+	defer p.muWrite.Unlock()
+	if p.closed {
+		return
+	}
+	now := time.Now()
+	data := ebinary.BigEndian.AppendUint64(nil, uint64(now.UnixNano()))
+	p.pingSent.Store(now.UnixNano())
+	if err := p.conn.WriteControl(websocket.PingMessage, data, now.Add(writeTimeout)); err != nil {
+		p.client.logger.Debugf("peer send ping (%v, %p): %v", p.client.Id, p, err)
+	}
+}
+
+// onPong : 直前に送ったpingへの応答ならRTTを記録する.
+// 応答待ちのpingと一致しないpongは無視するので、クライアントはRTTを小さく偽れない.
+func (p *Peer) onPong(data string) error {
+	if len(data) != 8 {
+		return nil
+	}
+	sent := int64(ebinary.BigEndian.Uint64([]byte(data)))
+	if sent == 0 || !p.pingSent.CompareAndSwap(sent, 0) {
+		return nil
+	}
+	rtt := time.Since(time.Unix(0, sent))
+	p.client.rtt.Store(uint32(rtt.Milliseconds()))
+	return nil
+}
+
 func (p *Peer) Close(msg string) {
 	if p == nil {
 		return
@@ -223,12 +278,16 @@ loop:
 		}
 		metrics.MessageRecv.Add(1)
 
-		msg, err := binary.UnmarshalMsg(p.client.hmac, data)
+		msg, err := binary.UnmarshalMsg(p.hmac, data)
 		if err != nil {
 			p.client.logger.Errorf("peer UnmarshalMsg (%v, %p): %+v", p.client.Id, p, err)
 			p.closeWithMessage(websocket.CloseInvalidFramePayloadData, err.Error())
 			break loop
 		}
+		metrics.MessageRecvByType.With(msg.Type().String()).Inc()
+		if msg.Type() == binary.MsgTypePing {
+			p.sendPing()
+		}
 
 		select {
 		case <-ctx.Done():
@@ -0,0 +1,34 @@
+package game
+
+import (
+	ebinary "encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestPeerOnPong(t *testing.T) {
+	c := &Client{}
+	p := &Peer{client: c}
+
+	sent := time.Now().Add(-50 * time.Millisecond).UnixNano()
+	data := string(ebinary.BigEndian.AppendUint64(nil, uint64(sent)))
+
+	// 送っていないpingへの応答は無視する
+	p.onPong(data)
+	if rtt := c.rtt.Load(); rtt != 0 {
+		t.Fatalf("rtt updated by unexpected pong: %v", rtt)
+	}
+
+	p.pingSent.Store(sent)
+	p.onPong(data)
+	if rtt := c.rtt.Load(); rtt < 50 {
+		t.Fatalf("rtt = %v, wants >= 50", rtt)
+	}
+
+	// 同じpongの再送は無視する
+	c.rtt.Store(0)
+	p.onPong(data)
+	if rtt := c.rtt.Load(); rtt != 0 {
+		t.Fatalf("rtt updated by replayed pong: %v", rtt)
+	}
+}
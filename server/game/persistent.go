@@ -0,0 +1,189 @@
+package game
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/xerrors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+
+	"wsnet2/log"
+	"wsnet2/metrics"
+	"wsnet2/pb"
+)
+
+// persistentEmptyGrace : 永続部屋にempty_graceが指定されていないとき、全員退室してから読み込みを解除するまでの時間
+const persistentEmptyGrace = time.Minute
+
+// persistentRoom : persistent_room テーブルの行.
+// host_idは読み込んでいるGameサーバで、0なら読み込まれていない.
+type persistentRoom struct {
+	Id           string    `db:"id"`
+	AppId        string    `db:"app_id"`
+	HostId       uint32    `db:"host_id"`
+	Visible      bool      `db:"visible"`
+	Joinable     bool      `db:"joinable"`
+	Watchable    bool      `db:"watchable"`
+	SearchGroup  uint32    `db:"search_group"`
+	MaxPlayers   uint32    `db:"max_players"`
+	PublicProps  []byte    `db:"props"`
+	PrivateProps []byte    `db:"private_props"`
+	RoomOption   []byte    `db:"room_option"`
+	Created      time.Time `db:"created"`
+	Updated      time.Time `db:"updated"`
+}
+
+func newPersistentRoom(info *pb.RoomInfo, op *pb.RoomOption, deadline time.Duration) (*persistentRoom, error) {
+	op = proto.Clone(op).(*pb.RoomOption)
+	op.ClientDeadline = uint32(deadline / time.Second)
+	op.SearchGroup = info.SearchGroup
+	op.MaxPlayers = info.MaxPlayers
+	op.PublicProps = nil
+	op.PrivateProps = nil
+	opbytes, err := proto.Marshal(op)
+	if err != nil {
+		return nil, xerrors.Errorf("marshal room option: %w", err)
+	}
+	now := time.Now()
+	return &persistentRoom{
+		Id:           info.Id,
+		AppId:        info.AppId,
+		HostId:       info.HostId,
+		Visible:      op.Visible,
+		Joinable:     op.Joinable,
+		Watchable:    op.Watchable,
+		SearchGroup:  info.SearchGroup,
+		MaxPlayers:   info.MaxPlayers,
+		PublicProps:  info.PublicProps,
+		PrivateProps: info.PrivateProps,
+		RoomOption:   opbytes,
+		Created:      now,
+		Updated:      now,
+	}, nil
+}
+
+// roomInfo : 読み込み時のRoomInfoとRoomOption
+func (pr *persistentRoom) roomInfo(hostId uint32) (*pb.RoomInfo, *pb.RoomOption, error) {
+	op := &pb.RoomOption{}
+	if err := proto.Unmarshal(pr.RoomOption, op); err != nil {
+		return nil, nil, xerrors.Errorf("unmarshal room option: %w", err)
+	}
+	info := &pb.RoomInfo{
+		Id:           pr.Id,
+		AppId:        pr.AppId,
+		HostId:       hostId,
+		Visible:      pr.Visible,
+		Joinable:     pr.Joinable,
+		Watchable:    pr.Watchable,
+		Number:       &pb.RoomNumber{},
+		SearchGroup:  pr.SearchGroup,
+		MaxPlayers:   pr.MaxPlayers,
+		PublicProps:  pr.PublicProps,
+		PrivateProps: pr.PrivateProps,
+	}
+	info.SetCreated(time.Now())
+	return info, op, nil
+}
+
+// loadPersistentRoom : 読み込まれていない永続部屋をDBから読み込み、Masterのいない部屋として開始する
+func (repo *Repository) loadPersistentRoom(ctx context.Context, id string) (*Room, ErrorWithCode) {
+	repo.muLoad.Lock()
+	defer repo.muLoad.Unlock()
+
+	if room, err := repo.GetRoom(id); err == nil {
+		return room, nil // 待っている間に読み込まれた
+	}
+	if repo.GetRoomCount() >= repo.conf.MaxRooms {
+		return nil, WithCode(
+			xerrors.Errorf("reached to the max_rooms"), codes.ResourceExhausted)
+	}
+
+	tx, err := repo.db.Beginx()
+	if err != nil {
+		return nil, WithCode(xerrors.Errorf("db.Beginx: %w", err), codes.Internal)
+	}
+
+	// 他のGameサーバが同時に読み込まないよう、host_idを書き換えられたときだけ読み込む
+	start := time.Now()
+	res, err := tx.ExecContext(ctx,
+		"UPDATE persistent_room SET host_id=? WHERE id=? AND app_id=? AND host_id=0", repo.hostId, id, repo.app.Id)
+	metrics.DBQueryLatency.With("persistent_room_load").ObserveSince(start)
+	if err != nil {
+		tx.Rollback()
+		return nil, WithCode(xerrors.Errorf("update persistent_room: %w", err), codes.Internal)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return nil, NormalWithCode(
+			xerrors.Errorf("persistent room not found or already loaded: room=%v", id), codes.NotFound)
+	}
+
+	var pr persistentRoom
+	if err := tx.GetContext(ctx, &pr, "SELECT * FROM persistent_room WHERE id=?", id); err != nil {
+		tx.Rollback()
+		return nil, WithCode(xerrors.Errorf("select persistent_room: %w", err), codes.Internal)
+	}
+	info, op, err := pr.roomInfo(repo.hostId)
+	if err != nil {
+		tx.Rollback()
+		return nil, WithCode(xerrors.Errorf("persistent room %v: %w", id, err), codes.Internal)
+	}
+	// 読み込みも部屋の作成と同じくアプリ毎の上限に含める
+	if ewc := repo.checkRoomQuota(repo.GetRoomCount(), info.MaxPlayers, len(info.PublicProps)+len(info.PrivateProps)); ewc != nil {
+		tx.Rollback()
+		return nil, ewc
+	}
+	if _, err := tx.NamedExecContext(ctx, roomInsertQuery, info); err != nil {
+		tx.Rollback()
+		return nil, WithCode(xerrors.Errorf("insert room: %w", err), codes.Internal)
+	}
+
+	loglevel := log.CurrentLevel()
+	if op.LogLevel > 0 {
+		loglevel = log.Level(op.LogLevel)
+	}
+	logger := log.Get(loglevel).With(log.KeyApp, repo.app.Id, log.KeyRoom, info.Id)
+
+	room, ewc := newRoom(repo, info, op, repo.conf, logger)
+	if ewc != nil {
+		tx.Rollback()
+		return nil, WithCode(xerrors.Errorf("newRoom: %w", ewc), ewc.Code())
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, WithCode(xerrors.Errorf("commit persistent room: %w", err), codes.Internal)
+	}
+	logger.Infof("persistent room loaded: %v", info.Id)
+
+	// 入室がなければ猶予の後に読み込みを解除する
+	room.emptySince = time.Now()
+	go room.MsgLoop()
+	go room.roomInfoUpdater()
+
+	repo.mu.Lock()
+	repo.rooms[room.ID()] = room
+	repo.mu.Unlock()
+
+	return room, nil
+}
+
+// savePersistentRoom : 永続部屋の現在の状態を書き戻し、読み込みを解除する
+func (repo *Repository) savePersistentRoom(room *Room) {
+	pr, err := newPersistentRoom(room.RoomInfo, room.persistent, room.deadline)
+	if err != nil {
+		room.logger.Errorf("save persistent room: %+v", err)
+		return
+	}
+
+	start := time.Now()
+	_, err = repo.db.Exec("UPDATE persistent_room SET host_id=0, visible=?, joinable=?, watchable=?, search_group=?, max_players=?, "+
+		"props=?, private_props=?, room_option=?, updated=? WHERE id=? AND host_id=?",
+		pr.Visible, pr.Joinable, pr.Watchable, pr.SearchGroup, pr.MaxPlayers,
+		pr.PublicProps, pr.PrivateProps, pr.RoomOption, pr.Updated, pr.Id, repo.hostId)
+	metrics.DBQueryLatency.With("persistent_room_save").ObserveSince(start)
+	if err != nil {
+		room.logger.Errorf("save persistent room: %+v", err)
+		return
+	}
+	room.logger.Infof("persistent room saved: %v", room.Id)
+}
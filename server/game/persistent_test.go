@@ -0,0 +1,141 @@
+package game
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+
+	"wsnet2/common"
+	"wsnet2/config"
+	"wsnet2/pb"
+)
+
+func TestPersistentRoomInfo(t *testing.T) {
+	op := &pb.RoomOption{
+		Visible:        true,
+		Joinable:       true,
+		SearchGroup:    1,
+		MaxPlayers:     4,
+		ClientDeadline: 10,
+		PublicProps:    []byte{1},
+		TurnBased:      true,
+		Persistent:     true,
+	}
+	info := &pb.RoomInfo{
+		Id:           "0123456789abcdef0123456789abcdef",
+		AppId:        "app",
+		HostId:       1,
+		Visible:      true,
+		Joinable:     true,
+		SearchGroup:  2, // 作成後に変更された
+		MaxPlayers:   8,
+		PublicProps:  []byte{2},
+		PrivateProps: []byte{3},
+	}
+
+	pr, err := newPersistentRoom(info, op, 30*time.Second)
+	if err != nil {
+		t.Fatalf("newPersistentRoom: %v", err)
+	}
+	ri, rop, err := pr.roomInfo(5)
+	if err != nil {
+		t.Fatalf("roomInfo: %v", err)
+	}
+
+	if ri.Id != info.Id || ri.HostId != 5 || ri.SearchGroup != 2 || ri.MaxPlayers != 8 || ri.Players != 0 {
+		t.Fatalf("room info = %v", ri)
+	}
+	if string(ri.PublicProps) != string(info.PublicProps) || string(ri.PrivateProps) != string(info.PrivateProps) {
+		t.Fatalf("props = %v %v", ri.PublicProps, ri.PrivateProps)
+	}
+	wants := &pb.RoomOption{
+		Visible:        true,
+		Joinable:       true,
+		SearchGroup:    2,
+		MaxPlayers:     8,
+		ClientDeadline: 30,
+		TurnBased:      true,
+		Persistent:     true,
+	}
+	if !proto.Equal(rop, wants) {
+		t.Fatalf("room option = %v, wants %v", rop, wants)
+	}
+}
+
+// 読み込んだばかりの永続部屋はMasterが居ないまま観戦できる
+func TestWatchLoadedPersistentRoom(t *testing.T) {
+	conf := &config.GameConf{ClientConf: config.ClientConf{EventBufSize: 8}}
+	repo := &Repository{
+		app:     &pb.App{Id: "app"},
+		conf:    conf,
+		rooms:   make(map[RoomID]*Room),
+		clients: make(map[ClientID]map[RoomID]*Client),
+	}
+	info := &pb.RoomInfo{Id: "0123456789abcdef0123456789abcdef", AppId: "app", Watchable: true}
+	op := &pb.RoomOption{Watchable: true, Persistent: true}
+	room, err := newRoom(repo, info, op, conf, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("newRoom: %v", err)
+	}
+
+	joined := make(chan *JoinedInfo, 1)
+	errch := make(chan ErrorWithCode, 1)
+	room.msgWatch(&MsgWatch{
+		Info:   &pb.ClientInfo{Id: "watcher1"},
+		Joined: joined,
+		Err:    errch,
+	})
+	select {
+	case ji := <-joined:
+		if ji.MasterId != "" {
+			t.Fatalf("MasterId = %q, wants empty", ji.MasterId)
+		}
+	case err := <-errch:
+		t.Fatalf("msgWatch: %v", err)
+	}
+
+	res := make(chan *pb.GetRoomInfoRes, 1)
+	room.msgGetRoomInfo(&MsgGetRoomInfo{Res: res})
+	if r := <-res; r.MasterId != "" {
+		t.Fatalf("GetRoomInfo MasterId = %q, wants empty", r.MasterId)
+	}
+
+	room.muClients.RLock()
+	room.newEvSnapshot(room.watchers["watcher1"], 0)
+	room.muClients.RUnlock()
+}
+
+// 永続部屋の読み込みもアプリ毎の部屋数上限に含める
+func TestLoadPersistentRoomQuota(t *testing.T) {
+	db, mock := newDbMock(t)
+	repo := &Repository{
+		app:     &pb.App{Id: "app", MaxRooms: 1},
+		conf:    &config.GameConf{MaxRooms: 10},
+		db:      db,
+		hostId:  1,
+		rooms:   map[RoomID]*Room{"loaded": nil},
+		clients: make(map[ClientID]map[RoomID]*Client),
+	}
+	pr, err := newPersistentRoom(&pb.RoomInfo{Id: "0123456789abcdef0123456789abcdef", AppId: "app"}, &pb.RoomOption{Persistent: true}, 0)
+	if err != nil {
+		t.Fatalf("newPersistentRoom: %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE persistent_room SET host_id").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT \\* FROM persistent_room").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "app_id", "host_id", "room_option"}).AddRow(pr.Id, pr.AppId, 1, pr.RoomOption))
+	mock.ExpectRollback()
+
+	_, ewc := repo.loadPersistentRoom(context.Background(), pr.Id)
+	if ewc == nil || ewc.Code() != common.CodeQuotaExceeded {
+		t.Fatalf("loadPersistentRoom = %v, wants code %v", ewc, common.CodeQuotaExceeded)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("ExpectationsWereMet: %v", err)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"wsnet2/common"
 	"wsnet2/config"
 	"wsnet2/log"
+	"wsnet2/metrics"
 	"wsnet2/pb"
 )
 
@@ -28,6 +29,8 @@ var (
 	roomUpdateQuery        string
 	roomHistoryInsertQuery string
 
+	persistentRoomInsertQuery string
+
 	randsrc *rand.Rand
 	murand  sync.Mutex
 
@@ -78,6 +81,13 @@ func initQueries() {
 		roomHistoryInsertQuery = fmt.Sprintf("INSERT INTO room_history (%s) VALUES (:%s)",
 			strings.Join(cols, ","), strings.Join(cols, ",:"))
 	}
+
+	// persistent_room
+	{
+		cols := dbCols(reflect.TypeOf(persistentRoom{}))
+		persistentRoomInsertQuery = fmt.Sprintf("INSERT INTO persistent_room (%s) VALUES (:%s)",
+			strings.Join(cols, ","), strings.Join(cols, ",:"))
+	}
 }
 
 func RandomHex(n int) string {
@@ -101,26 +111,39 @@ type Repository struct {
 	conf *config.GameConf
 	db   *sqlx.DB
 
+	resultSinks []ResultSink
+
 	mu      sync.RWMutex
 	rooms   map[RoomID]*Room
 	clients map[ClientID]map[RoomID]*Client
+
+	// muLoad : 永続部屋の読み込みを直列化する
+	muLoad sync.Mutex
 }
 
 func NewRepos(db *sqlx.DB, conf *config.GameConf, hostId uint32) (map[pb.AppId]*Repository, error) {
-	if _, err := db.Exec("INSERT INTO room_history (room_id, app_id, host_id, number, search_group, max_players, public_props, created, closed) "+
-		"SELECT id, app_id, host_id, number, search_group, max_players, props, created, now() FROM room WHERE host_id=?", hostId); err != nil {
+	if _, err := db.Exec("INSERT INTO room_history (room_id, app_id, host_id, number, search_group, max_players, public_props, created, closed, close_reason) "+
+		"SELECT id, app_id, host_id, number, search_group, max_players, props, created, now(), 'server restarted' FROM room WHERE host_id=?", hostId); err != nil {
 		return nil, xerrors.Errorf("room to history: %w", err)
 	}
 	if _, err := db.Exec("DELETE FROM `room` WHERE host_id=?", hostId); err != nil {
 		return nil, xerrors.Errorf("delete rooms: %w", err)
 	}
-	query := "SELECT id, `key` FROM app"
+	// 前回読み込んでいた永続部屋は最後に書き戻した状態で読み込み直せるようにする
+	if _, err := db.Exec("UPDATE `persistent_room` SET host_id=0 WHERE host_id=?", hostId); err != nil {
+		return nil, xerrors.Errorf("release persistent rooms: %w", err)
+	}
+	query := "SELECT id, `key`, max_rooms, max_players, max_watchers, max_props_bytes, max_msg_rate, max_lifetime, idle_timeout, empty_grace FROM app"
 	var apps []*pb.App
 	err := db.Select(&apps, query)
 	if err != nil {
 		return nil, xerrors.Errorf("select apps: %w", err)
 	}
 	log.Debugf("new repos: apps=%v", apps)
+	resultSinks, err := NewResultSinks(conf, db)
+	if err != nil {
+		return nil, err
+	}
 	repos := make(map[pb.AppId]*Repository, len(apps))
 	for _, app := range apps {
 		repos[app.Id] = &Repository{
@@ -129,6 +152,8 @@ func NewRepos(db *sqlx.DB, conf *config.GameConf, hostId uint32) (map[pb.AppId]*
 			conf:   conf,
 			db:     db,
 
+			resultSinks: resultSinks,
+
 			rooms:   make(map[RoomID]*Room),
 			clients: make(map[ClientID]map[RoomID]*Client),
 		}
@@ -152,6 +177,13 @@ func (repo *Repository) CreateRoom(ctx context.Context, op *pb.RoomOption, maste
 		return nil, WithCode(
 			xerrors.Errorf("reached to the max_clients"), codes.ResourceExhausted)
 	}
+	if ewc := repo.checkCreateQuota(rooms, op, master); ewc != nil {
+		return nil, ewc
+	}
+	if op.Persistent && op.WithNumber {
+		return nil, WithCode(
+			xerrors.Errorf("persistent room cannot have a room number"), codes.InvalidArgument)
+	}
 
 	tx, err := repo.db.Beginx()
 	if err != nil {
@@ -171,7 +203,19 @@ func (repo *Repository) CreateRoom(ctx context.Context, op *pb.RoomOption, maste
 	logger := log.Get(loglevel).With(log.KeyApp, repo.app.Id, log.KeyRoom, info.Id)
 	logger.Infof("new room: %v, num=%v, master=%v", info.Id, info.Number.Number, master.Id)
 
-	room, joined, ewc := NewRoom(ctx, repo, info, master, macKey, op.ClientDeadline, repo.conf, logger)
+	if op.Persistent {
+		pr, err := newPersistentRoom(info, op, time.Duration(op.ClientDeadline)*time.Second)
+		if err != nil {
+			tx.Rollback()
+			return nil, WithCode(xerrors.Errorf("newPersistentRoom: %w", err), codes.InvalidArgument)
+		}
+		if _, err := tx.NamedExecContext(ctx, persistentRoomInsertQuery, pr); err != nil {
+			tx.Rollback()
+			return nil, WithCode(xerrors.Errorf("insert persistent_room: %w", err), codes.Internal)
+		}
+	}
+
+	room, joined, ewc := NewRoom(ctx, repo, info, master, macKey, op, repo.conf, logger)
 	if ewc != nil {
 		tx.Rollback()
 		return nil, WithCode(xerrors.Errorf("NewRoom: %w", ewc), ewc.Code())
@@ -194,6 +238,12 @@ func (repo *Repository) CreateRoom(ctx context.Context, op *pb.RoomOption, maste
 		if err != nil {
 			logger.Errorf("delete room (%v): %+v", room.Id, err)
 		}
+		if room.persistent != nil {
+			// 永続部屋は作成済みなので、次の入室で読み込めるようにしておく
+			if _, err := repo.db.Exec("UPDATE persistent_room SET host_id=0 WHERE id=?", room.Id); err != nil {
+				logger.Errorf("release persistent room (%v): %+v", room.Id, err)
+			}
+		}
 		return nil, WithCode(
 			xerrors.Errorf("reached to the max_rooms"), codes.ResourceExhausted)
 	}
@@ -205,11 +255,15 @@ func (repo *Repository) CreateRoom(ctx context.Context, op *pb.RoomOption, maste
 	repo.clients[cli.ID()][room.ID()] = cli
 
 	return &pb.JoinedRoomRes{
-		RoomInfo: joined.Room,
-		Players:  joined.Players,
-		AuthKey:  cli.authKey,
-		MasterId: string(joined.MasterId),
-		Deadline: uint32(joined.Deadline / time.Second),
+		RoomInfo:   joined.Room,
+		Players:    joined.Players,
+		AuthKey:    cli.AuthKey(),
+		MasterId:   string(joined.MasterId),
+		Deadline:   uint32(joined.Deadline / time.Second),
+		Turn:       joined.Turn,
+		Lockstep:   joined.Lockstep,
+		Timers:     joined.Timers,
+		ServerTime: uint64(joined.ServerTime.UnixMilli()),
 	}, nil
 }
 
@@ -232,10 +286,21 @@ func (repo *Repository) joinRoom(ctx context.Context, id string, client *pb.Clie
 		return nil, WithCode(
 			xerrors.Errorf("reached to the max_clients"), codes.ResourceExhausted)
 	}
+	if ewc := repo.checkJoinQuota(client, isPlayer); ewc != nil {
+		return nil, ewc
+	}
 
 	room, err := repo.GetRoom(id)
 	if err != nil {
-		return nil, NormalWithCode(xerrors.Errorf("repo.GetRoom: %w", err), codes.NotFound)
+		if !isPlayer {
+			return nil, NormalWithCode(xerrors.Errorf("repo.GetRoom: %w", err), codes.NotFound)
+		}
+		// 読み込まれていない永続部屋なら読み込む
+		var ewc ErrorWithCode
+		room, ewc = repo.loadPersistentRoom(ctx, id)
+		if ewc != nil {
+			return nil, ewc
+		}
 	}
 
 	jch := make(chan *JoinedInfo, 1)
@@ -276,14 +341,127 @@ func (repo *Repository) joinRoom(ctx context.Context, id string, client *pb.Clie
 	repo.clients[cli.ID()][room.ID()] = cli
 
 	return &pb.JoinedRoomRes{
-		RoomInfo: joined.Room,
-		Players:  joined.Players,
-		AuthKey:  cli.authKey,
-		MasterId: string(joined.MasterId),
-		Deadline: uint32(joined.Deadline / time.Second),
+		RoomInfo:   joined.Room,
+		Players:    joined.Players,
+		AuthKey:    cli.AuthKey(),
+		MasterId:   string(joined.MasterId),
+		Deadline:   uint32(joined.Deadline / time.Second),
+		Turn:       joined.Turn,
+		Lockstep:   joined.Lockstep,
+		Timers:     joined.Timers,
+		ServerTime: uint64(joined.ServerTime.UnixMilli()),
 	}, nil
 }
 
+// RejoinRoom : 入室中のPlayerとして再入室する.
+// Clientを引き継ぐので、返された通番で接続すれば未読Eventが再送される
+func (repo *Repository) RejoinRoom(ctx context.Context, id, clientId, macKey string) (*pb.JoinedRoomRes, ErrorWithCode) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	room, err := repo.GetRoom(id)
+	if err != nil {
+		return nil, NormalWithCode(xerrors.Errorf("repo.GetRoom: %w", err), codes.NotFound)
+	}
+
+	rch := make(chan *RejoinedInfo, 1)
+	errch := make(chan ErrorWithCode, 1)
+	msg := &MsgRejoin{ClientID(clientId), macKey, rch, errch}
+
+	select {
+	case <-ctx.Done():
+		return nil, WithCode(
+			xerrors.Errorf("context done: room=%v", room.Id),
+			codes.DeadlineExceeded)
+	case room.msgCh <- msg:
+	}
+
+	var rejoined *RejoinedInfo
+	select {
+	case <-ctx.Done():
+		return nil, WithCode(
+			xerrors.Errorf("context done: room=%v", room.Id),
+			codes.DeadlineExceeded)
+	case ewc := <-errch:
+		return nil, ewc
+	case rejoined = <-rch:
+	}
+
+	return &pb.JoinedRoomRes{
+		RoomInfo:     rejoined.Room,
+		Players:      rejoined.Players,
+		AuthKey:      rejoined.AuthKey,
+		MasterId:     string(rejoined.MasterId),
+		Deadline:     uint32(rejoined.Deadline / time.Second),
+		LastEventSeq: uint32(rejoined.LastEventSeq),
+		LastMsgSeq:   uint32(rejoined.LastMsgSeq),
+		Turn:         rejoined.Turn,
+		Lockstep:     rejoined.Lockstep,
+		Timers:       rejoined.Timers,
+		ServerTime:   uint64(rejoined.ServerTime.UnixMilli()),
+	}, nil
+}
+
+// checkCreateQuota : アプリ毎の上限を確認する
+func (repo *Repository) checkCreateQuota(rooms int, op *pb.RoomOption, master *pb.ClientInfo) ErrorWithCode {
+	if ewc := repo.checkRoomQuota(rooms, op.MaxPlayers, len(op.PublicProps)+len(op.PrivateProps)); ewc != nil {
+		return ewc
+	}
+	return repo.checkClientQuota(master)
+}
+
+// checkRoomQuota : 部屋の作成・読み込み時にアプリ毎の上限を確認する
+func (repo *Repository) checkRoomQuota(rooms int, maxPlayers uint32, propsBytes int) ErrorWithCode {
+	app := repo.app
+	if app.MaxRooms > 0 && rooms >= int(app.MaxRooms) {
+		return NormalWithCode(
+			xerrors.Errorf("reached to the app max_rooms: %v", app.MaxRooms), common.CodeQuotaExceeded)
+	}
+	if app.MaxPlayers > 0 && maxPlayers > app.MaxPlayers {
+		return NormalWithCode(
+			xerrors.Errorf("max_players exceeds the app limit: %v > %v", maxPlayers, app.MaxPlayers), common.CodeQuotaExceeded)
+	}
+	if app.MaxPropsBytes > 0 && propsBytes > int(app.MaxPropsBytes) {
+		return NormalWithCode(
+			xerrors.Errorf("room props exceeds the app limit: %v > %v", propsBytes, app.MaxPropsBytes), common.CodeQuotaExceeded)
+	}
+	return nil
+}
+
+// checkJoinQuota : アプリ毎の上限を確認する
+func (repo *Repository) checkJoinQuota(client *pb.ClientInfo, isPlayer bool) ErrorWithCode {
+	if client.IsHub {
+		return nil
+	}
+	if !isPlayer && repo.app.MaxWatchers > 0 {
+		repo.mu.RLock()
+		watchers := 0
+		for _, cs := range repo.clients {
+			for _, c := range cs {
+				if !c.isPlayer && !c.IsHub {
+					watchers++
+				}
+			}
+		}
+		repo.mu.RUnlock()
+		if watchers >= int(repo.app.MaxWatchers) {
+			return NormalWithCode(
+				xerrors.Errorf("reached to the app max_watchers: %v", repo.app.MaxWatchers), common.CodeQuotaExceeded)
+		}
+	}
+	return repo.checkClientQuota(client)
+}
+
+func (repo *Repository) checkClientQuota(client *pb.ClientInfo) ErrorWithCode {
+	if max := repo.app.MaxPropsBytes; max > 0 {
+		if n := len(client.Props) + len(client.PrivateProps); n > int(max) {
+			return NormalWithCode(
+				xerrors.Errorf("client props exceeds the app limit: %v > %v", n, max), common.CodeQuotaExceeded)
+		}
+	}
+	return nil
+}
+
 func (repo *Repository) newRoomInfo(ctx context.Context, tx *sqlx.Tx, op *pb.RoomOption) (*pb.RoomInfo, ErrorWithCode) {
 	ri := &pb.RoomInfo{
 		AppId:        repo.app.Id,
@@ -317,7 +495,9 @@ func (repo *Repository) newRoomInfo(ctx context.Context, tx *sqlx.Tx, op *pb.Roo
 			murand.Unlock()
 		}
 
+		start := time.Now()
 		_, err = tx.NamedExecContext(ctx, roomInsertQuery, ri)
+		metrics.DBQueryLatency.With("room_insert").ObserveSince(start)
 		if err == nil {
 			return ri, nil
 		}
@@ -334,6 +514,7 @@ func (repo *Repository) updateRoomInfo(ri *pb.RoomInfo, conn *sqlx.Conn, logger
 		return
 	}
 
+	defer metrics.DBQueryLatency.With("room_update").ObserveSince(time.Now())
 	if _, err := conn.ExecContext(context.Background(), q, args...); err != nil {
 		logger.Errorf("update roominfo: %v %+v", ri.Id, err)
 	}
@@ -350,11 +531,14 @@ type roomHistory struct {
 	PrivateProps []byte        `db:"private_props"`
 	Created      time.Time     `db:"created"`
 	Closed       time.Time     `db:"closed"`
+	CloseReason  string        `db:"close_reason"`
 }
 
 func (repo *Repository) deleteRoom(room *Room) {
 	var err error
+	start := time.Now()
 	_, err = repo.db.Exec("DELETE FROM room WHERE id=?", room.Id)
+	metrics.DBQueryLatency.With("room_delete").ObserveSince(start)
 	if err != nil {
 		room.logger.Errorf("delete room record (%v): %+v", room.Id, err)
 		return
@@ -378,9 +562,12 @@ func (repo *Repository) deleteRoom(room *Room) {
 		PrivateProps: room.PrivateProps,
 		Created:      room.Created.Time(),
 		Closed:       time.Now(),
+		CloseReason:  room.closeReason,
 	}
 
+	start = time.Now()
 	_, err = repo.db.NamedExec(roomHistoryInsertQuery, history)
+	metrics.DBQueryLatency.With("room_history_insert").ObserveSince(start)
 	if err != nil {
 		room.logger.Errorf("insert to room_history: %+v", err)
 	}
@@ -393,6 +580,9 @@ func (repo *Repository) RemoveRoom(room *Room) {
 	delete(repo.rooms, rid)
 
 	repo.deleteRoom(room)
+	if room.persistent != nil {
+		repo.savePersistentRoom(room)
+	}
 	room.logger.Debugf("room removed from repository: %v", rid)
 }
 
@@ -441,6 +631,23 @@ func (repo *Repository) GetRoomCount() int {
 	return len(repo.rooms)
 }
 
+func (repo *Repository) GetClientCount() int {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	return len(repo.clients)
+}
+
+// GetLoad : 観戦者数の合計と、部屋のmsgChに滞留しているメッセージ数の最大値
+func (repo *Repository) GetLoad() (watchers, backlog int) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	for _, room := range repo.rooms {
+		watchers += int(room.numWatchers())
+		backlog = max(backlog, len(room.msgCh))
+	}
+	return watchers, backlog
+}
+
 func (repo *Repository) GetRoomInfo(ctx context.Context, id string) (*pb.GetRoomInfoRes, error) {
 	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
@@ -544,6 +751,76 @@ func (repo *Repository) adminKickRoom(room *Room, userID string) error {
 	}
 }
 
+// AdminClose : 部屋を強制終了する
+func (repo *Repository) AdminClose(ctx context.Context, roomID, reason string) error {
+	room, err := repo.GetRoom(roomID)
+	if err != nil {
+		return NormalWithCode(xerrors.Errorf("AdminClose: can not find room %q; %w", roomID, err), codes.NotFound)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	ch := make(chan error, 1)
+	return repo.sendAdminMsg(ctx, room, &MsgAdminClose{Reason: reason, Res: ch}, ch)
+}
+
+// AdminNotice : 部屋にお知らせを送る. roomIDが空ならappの全ての部屋に送る.
+func (repo *Repository) AdminNotice(ctx context.Context, roomID, message string, logger log.Logger) error {
+	if roomID != "" {
+		room, err := repo.GetRoom(roomID)
+		if err != nil {
+			return NormalWithCode(xerrors.Errorf("AdminNotice: can not find room %q; %w", roomID, err), codes.NotFound)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+		defer cancel()
+
+		ch := make(chan error, 1)
+		return repo.sendAdminMsg(ctx, room, &MsgAdminNotice{Message: message, Res: ch}, ch)
+	}
+
+	repo.mu.RLock()
+	rooms := make([]*Room, 0, len(repo.rooms))
+	for _, room := range repo.rooms {
+		rooms = append(rooms, room)
+	}
+	repo.mu.RUnlock()
+
+	for _, room := range rooms {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		ch := make(chan error, 1)
+		err := repo.sendAdminMsg(ctx, room, &MsgAdminNotice{Message: message, Res: ch}, ch)
+		cancel()
+		if err != nil {
+			logger.Errorf("Repository.AdminNotice: room=%q err=%+v", room.Id, err)
+		}
+	}
+	return nil
+}
+
+// sendAdminMsg : 管理用Msgを送り、結果を待つ
+func (repo *Repository) sendAdminMsg(ctx context.Context, room *Room, msg Msg, res <-chan error) error {
+	select {
+	case <-ctx.Done():
+		return WithCode(
+			xerrors.Errorf("%T write msg timeout or context done: room=%q", msg, room.Id),
+			codes.DeadlineExceeded)
+	case <-room.Done():
+		return NormalWithCode(xerrors.Errorf("room closed: room=%q", room.Id), codes.NotFound)
+	case room.msgCh <- msg:
+	}
+
+	select {
+	case <-ctx.Done():
+		return WithCode(
+			xerrors.Errorf("%T response timeout or context done: room=%q", msg, room.Id),
+			codes.DeadlineExceeded)
+	case err := <-res:
+		return err
+	}
+}
+
 type PlayerLogMsg string
 
 const (
@@ -556,6 +833,7 @@ const (
 	PlayerLogError   PlayerLogMsg = "Error"
 	PlayerLogAttach  PlayerLogMsg = "Attach"
 	PlayerLogDetach  PlayerLogMsg = "Detach"
+	PlayerLogClose   PlayerLogMsg = "Close"
 )
 
 func (repo *Repository) PlayerLog(c *Client, msg PlayerLogMsg) {
@@ -569,6 +847,7 @@ func (repo *Repository) PlayerLog(c *Client, msg PlayerLogMsg) {
 	}
 
 	go func() {
+		defer metrics.DBQueryLatency.With("player_log_insert").ObserveSince(time.Now())
 		_, err := repo.db.NamedExec(q, param)
 		if err != nil {
 			c.logger.Errorf("Repository.PlayerLog(%v, %v, %v): %+v", c.RoomID(), c.ID(), msg, err)
@@ -154,3 +154,39 @@ func TestRandomHexRoomId(t *testing.T) {
 		t.Errorf("room id pattern missmatch: %v", rid)
 	}
 }
+
+func TestCheckCreateQuota(t *testing.T) {
+	repo := &Repository{
+		app: &pb.App{
+			Id:            "testing",
+			MaxRooms:      2,
+			MaxPlayers:    4,
+			MaxPropsBytes: 8,
+		},
+	}
+	master := &pb.ClientInfo{Id: "master"}
+
+	tests := map[string]struct {
+		rooms int
+		op    *pb.RoomOption
+		ok    bool
+	}{
+		"ok":          {1, &pb.RoomOption{MaxPlayers: 4, PublicProps: make([]byte, 4), PrivateProps: make([]byte, 4)}, true},
+		"max_rooms":   {2, &pb.RoomOption{MaxPlayers: 4}, false},
+		"max_players": {1, &pb.RoomOption{MaxPlayers: 5}, false},
+		"props_bytes": {1, &pb.RoomOption{MaxPlayers: 4, PublicProps: make([]byte, 4), PrivateProps: make([]byte, 5)}, false},
+	}
+
+	for name, test := range tests {
+		err := repo.checkCreateQuota(test.rooms, test.op, master)
+		if test.ok {
+			if err != nil {
+				t.Errorf("%v: checkCreateQuota error: %v", name, err)
+			}
+			continue
+		}
+		if err == nil || err.Code() != common.CodeQuotaExceeded {
+			t.Errorf("%v: checkCreateQuota = %v, wants code %v", name, err, common.CodeQuotaExceeded)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package game
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/xerrors"
+
+	"wsnet2/binary"
+	"wsnet2/config"
+	"wsnet2/lifecycle"
+	"wsnet2/metrics"
+)
+
+// RoomResult : 各Playerが提出した試合結果を突き合わせたもの
+type RoomResult struct {
+	// Agreed : 提出者全員の内容が一致した
+	Agreed bool `json:"agreed"`
+	// Result : 最も多くのPlayerが提出した内容
+	Result any `json:"result"`
+	// Submitters : 提出したPlayer
+	Submitters []string `json:"submitters"`
+	// Dissenters : Resultと異なる内容を提出したPlayer
+	Dissenters []string `json:"dissenters"`
+	// Submissions : Player毎の提出内容
+	Submissions map[string]any `json:"submissions"`
+}
+
+type roomResultRow struct {
+	AppID       string    `db:"app_id"`
+	RoomID      string    `db:"room_id"`
+	Agreed      bool      `db:"agreed"`
+	Result      string    `db:"result"`
+	Submissions string    `db:"submissions"`
+	Created     time.Time `db:"created"`
+}
+
+const roomResultInsertQuery = "INSERT INTO room_result (app_id, room_id, agreed, result, submissions, created) " +
+	"VALUES (:app_id, :room_id, :agreed, :result, :submissions, :created)"
+
+func (r *Room) msgSubmitResult(msg *MsgSubmitResult) {
+	r.muClients.RLock()
+	defer r.muClients.RUnlock()
+
+	if !msg.Sender.isPlayer {
+		msg.Sender.logger.Warnf("sender %q is not a player", msg.Sender.Id)
+		r.sendTo(msg.Sender, binary.NewEvPermissionDenied(msg))
+		return
+	}
+	if r.players[msg.Sender.ID()] != msg.Sender {
+		return
+	}
+
+	// 再提出は上書きする
+	r.results[msg.Sender.ID()] = msg.Result
+	msg.Sender.logger.Infof("result submitted: %v", msg.Sender.Id)
+
+	r.sendTo(msg.Sender, binary.NewEvSucceeded(msg))
+}
+
+// consolidateResults : 提出内容を突き合わせる. 提出が無ければnil
+func consolidateResults(results map[ClientID]any) *RoomResult {
+	if len(results) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(results))
+	for id := range results {
+		ids = append(ids, string(id))
+	}
+	sort.Strings(ids)
+
+	// 同じ内容ごとにまとめる. 同数なら先に出てきた(ID順で若い)ものを採用
+	type group struct {
+		result  any
+		members []string
+	}
+	var groups []*group
+	for _, id := range ids {
+		res := results[ClientID(id)]
+		var g *group
+		for _, gg := range groups {
+			if reflect.DeepEqual(gg.result, res) {
+				g = gg
+				break
+			}
+		}
+		if g == nil {
+			g = &group{result: res}
+			groups = append(groups, g)
+		}
+		g.members = append(g.members, id)
+	}
+	major := groups[0]
+	for _, g := range groups[1:] {
+		if len(g.members) > len(major.members) {
+			major = g
+		}
+	}
+
+	rr := &RoomResult{
+		Agreed:      len(groups) == 1,
+		Result:      major.result,
+		Submitters:  ids,
+		Dissenters:  []string{},
+		Submissions: make(map[string]any, len(results)),
+	}
+	for _, g := range groups {
+		if g != major {
+			rr.Dissenters = append(rr.Dissenters, g.members...)
+		}
+	}
+	sort.Strings(rr.Dissenters)
+	for id, res := range results {
+		rr.Submissions[string(id)] = res
+	}
+	return rr
+}
+
+// reportResult : 部屋の終了時に試合結果を記録する
+func (r *Room) reportResult() {
+	rr := consolidateResults(r.results)
+	if rr == nil {
+		return
+	}
+	if !rr.Agreed {
+		r.logger.Warnf("results disagree: dissenters=%v", rr.Dissenters)
+	}
+
+	for _, s := range r.repo.resultSinks {
+		if err := s.WriteResult(r, rr); err != nil {
+			r.logger.Errorf("write result: %T: %+v", s, err)
+		}
+	}
+}
+
+// ResultSink : 試合結果の出力先
+type ResultSink interface {
+	WriteResult(room *Room, rr *RoomResult) error
+}
+
+// NewResultSinks : 設定(result_sinks)に従ってResultSinkを作る
+func NewResultSinks(conf *config.GameConf, db *sqlx.DB) ([]ResultSink, error) {
+	sinks := make([]ResultSink, 0, len(conf.ResultSinks))
+	for _, name := range conf.ResultSinks {
+		switch name {
+		case "db":
+			sinks = append(sinks, &dbResultSink{db})
+		case "lifecycle":
+			sinks = append(sinks, lifecycleResultSink{})
+		default:
+			return nil, xerrors.Errorf("unknown result sink: %q", name)
+		}
+	}
+	return sinks, nil
+}
+
+// lifecycleResultSink : ライフサイクルイベント(room_result)として出力する
+type lifecycleResultSink struct{}
+
+func (lifecycleResultSink) WriteResult(room *Room, rr *RoomResult) error {
+	room.emit(lifecycle.RoomResult, "", map[string]any{
+		"agreed":      rr.Agreed,
+		"result":      rr.Result,
+		"submitters":  rr.Submitters,
+		"dissenters":  rr.Dissenters,
+		"submissions": rr.Submissions,
+	})
+	return nil
+}
+
+// dbResultSink : room_resultテーブルに出力する
+type dbResultSink struct {
+	db *sqlx.DB
+}
+
+func (s *dbResultSink) WriteResult(room *Room, rr *RoomResult) error {
+	result, err := json.Marshal(rr.Result)
+	if err != nil {
+		return xerrors.Errorf("marshal result: %w", err)
+	}
+	submissions, err := json.Marshal(rr.Submissions)
+	if err != nil {
+		return xerrors.Errorf("marshal submissions: %w", err)
+	}
+	row := &roomResultRow{
+		AppID:       room.AppId,
+		RoomID:      room.Id,
+		Agreed:      rr.Agreed,
+		Result:      string(result),
+		Submissions: string(submissions),
+		Created:     time.Now(),
+	}
+
+	defer metrics.DBQueryLatency.With("room_result_insert").ObserveSince(time.Now())
+	if _, err := s.db.NamedExec(roomResultInsertQuery, row); err != nil {
+		return xerrors.Errorf("insert room_result: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConsolidateResults(t *testing.T) {
+	if rr := consolidateResults(map[ClientID]any{}); rr != nil {
+		t.Fatalf("no submission: %+v, wants nil", rr)
+	}
+
+	win := map[string]any{"user1": int64(10), "user2": int64(3)}
+	lose := map[string]any{"user1": int64(3), "user2": int64(10)}
+
+	rr := consolidateResults(map[ClientID]any{
+		"user1": win,
+		"user2": map[string]any{"user2": int64(3), "user1": int64(10)},
+	})
+	if !rr.Agreed || !reflect.DeepEqual(rr.Result, win) || len(rr.Dissenters) != 0 {
+		t.Fatalf("agreed: %+v", rr)
+	}
+
+	rr = consolidateResults(map[ClientID]any{
+		"user1": win,
+		"user2": lose,
+		"user3": win,
+	})
+	if rr.Agreed {
+		t.Fatalf("disagreed: Agreed=true")
+	}
+	if !reflect.DeepEqual(rr.Result, win) {
+		t.Fatalf("Result = %v, wants %v", rr.Result, win)
+	}
+	if !reflect.DeepEqual(rr.Submitters, []string{"user1", "user2", "user3"}) {
+		t.Fatalf("Submitters = %v", rr.Submitters)
+	}
+	if !reflect.DeepEqual(rr.Dissenters, []string{"user2"}) {
+		t.Fatalf("Dissenters = %v, wants [user2]", rr.Dissenters)
+	}
+}
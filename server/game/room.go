@@ -2,6 +2,7 @@ package game
 
 import (
 	"context"
+	"sort"
 	"sync"
 	"time"
 
@@ -11,6 +12,7 @@ import (
 	"wsnet2/binary"
 	"wsnet2/common"
 	"wsnet2/config"
+	"wsnet2/lifecycle"
 	"wsnet2/log"
 	"wsnet2/metrics"
 	"wsnet2/pb"
@@ -19,6 +21,12 @@ import (
 const (
 	// RoomMsgChSize : Msgチャネルのバッファサイズ
 	RoomMsgChSize = 10
+
+	// adminCloseWait : 強制終了や自動クローズ時、退室イベントを送ってから部屋を閉じるまでの猶予
+	adminCloseWait = time.Second
+
+	// masterCheckInterval : Master切替ポリシーの確認間隔
+	masterCheckInterval = time.Second
 )
 
 type Room struct {
@@ -27,8 +35,14 @@ type Room struct {
 
 	conf *config.GameConf
 
+	// spill : Clientの再送バッファから溢れたEventの保存先. 無効ならnil
+	spill SpillStore
+
 	deadline time.Duration
 
+	// Masterクライアントに接続品質を通知する
+	clientStats bool
+
 	publicProps  binary.Dict
 	privateProps binary.Dict
 
@@ -42,32 +56,117 @@ type Room struct {
 	masterOrder []ClientID
 	watchers    map[ClientID]*Client
 
+	// origMaster : 自動で切り替える前のMaster (MasterSwitchBack用)
+	origMaster ClientID
+
+	// turn : ターン制の手番. ターン制でなければnil
+	turn *turnState
+
+	// lockstep : ロックステップのフレーム. ロックステップでなければnil
+	lockstep *lockstep
+
+	// timers : Masterが設定した部屋のタイマー (MsgLoopからのみ触る)
+	timers *roomTimers
+
+	// results : Player毎に提出された試合結果 (MsgLoopからのみ触る)
+	results map[ClientID]any
+
+	// watcherChatDisabled : Masterが観戦者チャットを無効にした (MsgLoopからのみ触る)
+	watcherChatDisabled bool
+
 	lastMsg binary.Dict // map[clientID]unixtime_millisec
 
+	// closePolicy : 部屋の自動クローズの設定
+	closePolicy closePolicy
+	// lastActive : Playerが最後に入室またはRegularMsgを送った時刻 (MsgLoopからのみ触る)
+	lastActive time.Time
+	// emptySince : 全員退室した時刻. Playerがいればゼロ値 (muClientsで保護)
+	emptySince time.Time
+	// closing : 部屋を閉じる処理を始めた (muClientsで保護)
+	closing bool
+	// closeReason : 部屋を閉じた理由. room_historyに記録する
+	closeReason string
+
+	// persistent : 永続部屋のRoomOption. 永続部屋でなければnil.
+	// 部屋を閉じるとき、現在の状態と共にpersistent_roomに書き戻す.
+	persistent *pb.RoomOption
+
 	logger log.Logger
 
 	chRoomInfo   chan struct{}
 	mRoomInfo    sync.Mutex // used by updateRoomInfo
 	lastRoomInfo *pb.RoomInfo
+
+	// metricsに反映済みの人数 (mRoomInfoで保護)
+	reportedPlayers  uint32
+	reportedWatchers uint32
+}
+
+func NewRoom(ctx context.Context, repo *Repository, info *pb.RoomInfo, masterInfo *pb.ClientInfo, macKey string, op *pb.RoomOption, conf *config.GameConf, logger log.Logger) (*Room, *JoinedInfo, ErrorWithCode) {
+	r, ewc := newRoom(repo, info, op, conf, logger)
+	if ewc != nil {
+		return nil, nil, ewc
+	}
+
+	go r.MsgLoop()
+	go r.roomInfoUpdater()
+
+	jch := make(chan *JoinedInfo, 1)
+	ech := make(chan ErrorWithCode, 1)
+
+	select {
+	case <-ctx.Done():
+		return nil, nil, WithCode(
+			xerrors.Errorf("write msg timeout or context done: room=%v client=%v", r.Id, masterInfo.Id),
+			codes.DeadlineExceeded)
+	case r.msgCh <- &MsgCreate{masterInfo, macKey, jch, ech}:
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, nil, WithCode(
+			xerrors.Errorf("msgCreate timeout or context done: room=%v client=%v", r.Id, masterInfo.Id),
+			codes.DeadlineExceeded)
+	case ewc := <-ech:
+		return nil, nil, WithCode(
+			xerrors.Errorf("msgCreate: %w", ewc), ewc.Code())
+	case joined := <-jch:
+		return r, joined, nil
+	}
 }
 
-func NewRoom(ctx context.Context, repo *Repository, info *pb.RoomInfo, masterInfo *pb.ClientInfo, macKey string, deadlineSec uint32, conf *config.GameConf, logger log.Logger) (*Room, *JoinedInfo, ErrorWithCode) {
+// newRoom : Roomを生成する. MsgLoopなどのgoroutineは呼び出し側で起動する
+func newRoom(repo *Repository, info *pb.RoomInfo, op *pb.RoomOption, conf *config.GameConf, logger log.Logger) (*Room, ErrorWithCode) {
 	pubProps, iProps, err := common.InitProps(info.PublicProps)
 	if err != nil {
-		return nil, nil, WithCode(xerrors.Errorf("PublicProps unmarshal error: %w", err), codes.InvalidArgument)
+		return nil, WithCode(xerrors.Errorf("PublicProps unmarshal error: %w", err), codes.InvalidArgument)
 	}
 	info.PublicProps = iProps
 	privProps, iProps, err := common.InitProps(info.PrivateProps)
 	if err != nil {
-		return nil, nil, WithCode(xerrors.Errorf("PrivateProps unmarshal error: %w", err), codes.InvalidArgument)
+		return nil, WithCode(xerrors.Errorf("PrivateProps unmarshal error: %w", err), codes.InvalidArgument)
 	}
 	info.PrivateProps = iProps
 
+	spill, err := NewSpillStore(conf)
+	if err != nil {
+		// 再送できる範囲が狭まるだけなので部屋は作る
+		logger.Errorf("NewSpillStore: %+v", err)
+	}
+
 	r := &Room{
 		RoomInfo: info,
 		repo:     repo,
 		conf:     conf,
-		deadline: time.Duration(deadlineSec) * time.Second,
+		spill:    spill,
+		deadline: time.Duration(op.ClientDeadline) * time.Second,
+
+		clientStats: op.ClientStats,
+		turn:        newTurnState(op.TurnBased, op.TurnTimeout),
+		lockstep:    newLockstep(op.Lockstep, op.InputDelay, op.FrameTimeout),
+		timers:      newRoomTimers(),
+		closePolicy: newClosePolicy(repo.app, op),
+		lastActive:  time.Now(),
 
 		publicProps:  pubProps,
 		privateProps: privProps,
@@ -79,6 +178,7 @@ func NewRoom(ctx context.Context, repo *Repository, info *pb.RoomInfo, masterInf
 		masterOrder: []ClientID{},
 		watchers:    make(map[ClientID]*Client),
 		lastMsg:     make(binary.Dict),
+		results:     make(map[ClientID]any),
 
 		logger: logger,
 
@@ -86,31 +186,14 @@ func NewRoom(ctx context.Context, repo *Repository, info *pb.RoomInfo, masterInf
 		lastRoomInfo: info.Clone(),
 	}
 
-	go r.MsgLoop()
-	go r.roomInfoUpdater()
-
-	jch := make(chan *JoinedInfo, 1)
-	ech := make(chan ErrorWithCode, 1)
-
-	select {
-	case <-ctx.Done():
-		return nil, nil, WithCode(
-			xerrors.Errorf("write msg timeout or context done: room=%v client=%v", r.Id, masterInfo.Id),
-			codes.DeadlineExceeded)
-	case r.msgCh <- &MsgCreate{masterInfo, macKey, jch, ech}:
+	if op.Persistent {
+		r.persistent = op
+		if r.closePolicy.emptyGrace <= 0 {
+			r.closePolicy.emptyGrace = persistentEmptyGrace
+		}
 	}
 
-	select {
-	case <-ctx.Done():
-		return nil, nil, WithCode(
-			xerrors.Errorf("msgCreate timeout or context done: room=%v client=%v", r.Id, masterInfo.Id),
-			codes.DeadlineExceeded)
-	case ewc := <-ech:
-		return nil, nil, WithCode(
-			xerrors.Errorf("msgCreate: %w", ewc), ewc.Code())
-	case joined := <-jch:
-		return r, joined, nil
-	}
+	return r, nil
 }
 
 func (r *Room) ID() RoomID {
@@ -121,10 +204,38 @@ func (r *Room) ClientConf() *config.ClientConf {
 	return &r.conf.ClientConf
 }
 
+func (r *Room) EventSpill() SpillStore {
+	return r.spill
+}
+
+func (r *Room) App() *pb.App {
+	return r.repo.app
+}
+
 // MsgLoop goroutine dispatch messages.
 func (r *Room) MsgLoop() {
 	metrics.Rooms.Add(1)
 	defer metrics.Rooms.Add(-1)
+	metrics.AppRooms.With(r.AppId).Inc()
+	defer metrics.AppRooms.With(r.AppId).Dec()
+	defer func() {
+		r.mRoomInfo.Lock()
+		defer r.mRoomInfo.Unlock()
+		r.reportClients(0, 0)
+	}()
+
+	var masterCheck <-chan time.Time
+	if r.conf.MasterDetachedGrace > 0 || r.conf.MasterMaxRTT > 0 {
+		t := time.NewTicker(masterCheckInterval)
+		defer t.Stop()
+		masterCheck = t.C
+	}
+	var autoCloseCheck <-chan time.Time
+	if r.closePolicy.enabled() {
+		t := time.NewTicker(autoCloseCheckInterval)
+		defer t.Stop()
+		autoCloseCheck = t.C
+	}
 Loop:
 	for {
 		select {
@@ -133,11 +244,41 @@ Loop:
 			break Loop
 		case msg := <-r.msgCh:
 			r.updateLastMsg(msg.SenderID())
+			r.updateLastActive(msg)
 			r.dispatch(msg)
+		case <-masterCheck:
+			r.checkMaster()
+		case <-autoCloseCheck:
+			r.checkAutoClose()
+		case <-r.turn.timeoutC():
+			r.checkTurnTimeout()
+		case <-r.lockstep.timeoutC():
+			r.checkFrameTimeout()
+		case <-r.timers.C():
+			r.fireTimers()
 		}
 	}
+	r.timers.stop()
+	r.emit(lifecycle.RoomClosed, "", map[string]any{
+		"duration": time.Since(r.Created.Time()).Seconds(),
+		"reason":   r.closeReason,
+	})
+	r.reportResult()
 	r.repo.RemoveRoom(r)
 	r.drainMsg()
+	r.closeSpill()
+}
+
+// closeSpill : 退室したClientが溜まっているEventを読み終えるまで待ってから閉じる
+func (r *Room) closeSpill() {
+	if r.spill == nil {
+		return
+	}
+	time.AfterFunc(time.Duration(r.conf.WaitAfterClose), func() {
+		if err := r.spill.Close(); err != nil {
+			r.logger.Errorf("close event spill: %+v", err)
+		}
+	})
 }
 
 // drainMsg drain msgCh until all clients closed.
@@ -210,28 +351,114 @@ func (r *Room) removePlayer(c *Client, cause string, logmsg PlayerLogMsg) {
 	}
 
 	r.repo.PlayerLog(c, logmsg)
+	r.emit(playerLeftEventType(logmsg), cid, map[string]any{"cause": cause})
 
 	c.logger.Infof("player left: %v: %v", cid, cause)
 	c.Removed(cause)
 
+	switched := false
 	if len(r.players) == 0 {
-		close(r.done)
-		return
-	}
-
-	if r.master.ID() == cid {
+		if r.closePolicy.emptyGrace <= 0 || r.closing {
+			if r.closeReason == "" {
+				r.closeReason = closeReasonEmpty
+			}
+			r.turn.stop()
+			r.lockstep.stop()
+			close(r.done)
+			return
+		}
+		// 猶予の間に入室があればそのPlayerをMasterにする.
+		// それまでMasterは退室したPlayerのままにしておく.
+		r.emptySince = time.Now()
+		r.logger.Infof("room is empty: close after %v", r.closePolicy.emptyGrace)
+	} else if r.master.ID() == cid {
 		r.master = r.players[r.masterOrder[0]]
 		r.logger.Infof("master switched: %v -> %v", cid, r.master.ID())
+		r.emit(lifecycle.MasterSwitched, r.master.ID(), map[string]any{"from": string(cid), "cause": "master left"})
+		switched = true
 	}
 
 	r.RoomInfo.Players = uint32(len(r.players))
 	r.updateRoomInfo()
 
 	r.broadcast(binary.NewEvLeft(string(cid), r.master.Id, cause))
+	if switched {
+		r.sendPrivateProps(r.master)
+	}
+	r.removeTurnPlayer(cid)
+	r.sendFrames(false)
 
 	r.removeLastMsg(cid)
 }
 
+// checkMaster : Masterの接続状態を確認し、必要なら他のプレイヤーに切り替える
+func (r *Room) checkMaster() {
+	r.muClients.Lock()
+	defer r.muClients.Unlock()
+
+	if r.master == nil {
+		return
+	}
+	now := time.Now()
+
+	if r.origMaster != "" {
+		orig, ok := r.players[r.origMaster]
+		if !ok {
+			r.origMaster = ""
+		} else if orig != r.master && r.isHealthyMaster(orig) {
+			r.origMaster = ""
+			r.switchMaster(orig, "master reconnected")
+			return
+		}
+	}
+
+	var cause string
+	if grace := time.Duration(r.conf.MasterDetachedGrace); grace > 0 {
+		if t := r.master.DetachedSince(); !t.IsZero() && now.Sub(t) >= grace {
+			cause = "master detached"
+		}
+	}
+	if maxRTT := r.conf.MasterMaxRTT; maxRTT > 0 && r.master.rtt.Load() > maxRTT {
+		cause = "master rtt exceeded"
+	}
+	if cause == "" {
+		return
+	}
+
+	for _, id := range r.masterOrder {
+		c := r.players[id]
+		if c == r.master || !r.isHealthyMaster(c) {
+			continue
+		}
+		if r.conf.MasterSwitchBack && r.origMaster == "" {
+			r.origMaster = r.master.ID()
+		}
+		r.switchMaster(c, cause)
+		return
+	}
+}
+
+// isHealthyMaster : Masterを任せられる接続状態か
+func (r *Room) isHealthyMaster(c *Client) bool {
+	if !c.DetachedSince().IsZero() {
+		return false
+	}
+	if maxRTT := r.conf.MasterMaxRTT; maxRTT > 0 && c.rtt.Load() > maxRTT {
+		return false
+	}
+	return true
+}
+
+// switchMaster : Masterを切り替えて通知する. muClientsのロックを取得してから呼び出す.
+func (r *Room) switchMaster(c *Client, cause string) {
+	prev := r.master
+	r.master = c
+	r.logger.Infof("master switched: %v -> %v: %v", prev.ID(), c.ID(), cause)
+	r.emit(lifecycle.MasterSwitched, c.ID(), map[string]any{"from": prev.Id, "cause": cause})
+	r.broadcast(binary.NewEvMasterSwitched(prev.Id, c.Id, cause))
+	r.sendPrivateProps(c)
+}
+
 func (r *Room) roomInfoUpdater() {
 	for {
 		select {
@@ -272,12 +499,38 @@ func (r *Room) updateRoomInfo() {
 	defer r.mRoomInfo.Unlock()
 	r.lastRoomInfo = r.RoomInfo.Clone()
 
+	select {
+	case <-r.done:
+		// 終了後の変化はMsgLoopの終了時に打ち消しているので反映しない
+	default:
+		r.reportClients(r.RoomInfo.Players, r.RoomInfo.Watchers)
+	}
+
 	select {
 	case r.chRoomInfo <- struct{}{}:
 	default:
 	}
 }
 
+// reportClients : 人数の変化をmetricsに反映する. mRoomInfoをロックして呼ぶこと
+func (r *Room) reportClients(players, watchers uint32) {
+	if players != r.reportedPlayers {
+		metrics.AppPlayers.With(r.AppId).Add(float64(players) - float64(r.reportedPlayers))
+		r.reportedPlayers = players
+	}
+	if watchers != r.reportedWatchers {
+		metrics.AppWatchers.With(r.AppId).Add(float64(watchers) - float64(r.reportedWatchers))
+		r.reportedWatchers = watchers
+	}
+}
+
+// numWatchers : metricsに反映済みの観戦者数
+func (r *Room) numWatchers() uint32 {
+	r.mRoomInfo.Lock()
+	defer r.mRoomInfo.Unlock()
+	return r.reportedWatchers
+}
+
 func (r *Room) removeWatcher(c *Client, cause string) {
 	cid := c.ID()
 
@@ -302,6 +555,8 @@ func (r *Room) dispatch(msg Msg) {
 		r.msgJoin(m)
 	case *MsgWatch:
 		r.msgWatch(m)
+	case *MsgRejoin:
+		r.msgRejoin(m)
 	case *MsgPing:
 		r.msgPing(m)
 	case *MsgNodeCount:
@@ -322,12 +577,36 @@ func (r *Room) dispatch(msg Msg) {
 		r.msgSwitchMaster(m)
 	case *MsgKick:
 		r.msgKick(m)
+	case *MsgSubmitResult:
+		r.msgSubmitResult(m)
+	case *MsgEndTurn:
+		r.msgEndTurn(m)
+	case *MsgFrameInput:
+		r.msgFrameInput(m)
+	case *MsgSetTimer:
+		r.msgSetTimer(m)
+	case *MsgWatcherChat:
+		r.denyWatcherChat(m.Sender, m)
+	case *MsgWatcherReaction:
+		r.denyWatcherChat(m.Sender, m)
+	case *MsgReactionCounts:
+		r.msgReactionCounts(m)
+	case *MsgSetWatcherChat:
+		r.msgSetWatcherChat(m)
 	case *MsgAdminKick:
 		r.msgAdminKick(m)
+	case *MsgAdminClose:
+		r.msgAdminClose(m)
+	case *MsgAdminNotice:
+		r.msgAdminNotice(m)
+	case *msgCloseRoom:
+		r.msgCloseRoom(m)
 	case *MsgGetRoomInfo:
 		r.msgGetRoomInfo(m)
 	case *MsgClientError:
 		r.msgClientError(m)
+	case *MsgRateExceeded:
+		r.msgRateExceeded(m)
 	case *MsgClientTimeout:
 		r.msgClientTimeout(m)
 	default:
@@ -340,6 +619,12 @@ func (r *Room) dispatch(msg Msg) {
 // 送信できない場合続行不能なので退室させる.
 func (r *Room) sendTo(c *Client, ev *binary.RegularEvent) {
 	err := c.Send(ev)
+	if err != nil {
+		// evbufが溢れたら未読Eventを破棄してスナップショットから再開させる
+		c.logger.Infof("sendTo %v: resync: %v", c.Id, err.Error())
+		c.Resync(func(seq int) *binary.SystemEvent { return r.newEvSnapshot(c, seq) })
+		err = c.Send(ev)
+	}
 	if err != nil {
 		c.logger.Infof("sendTo %v: %v", c.Id, err.Error())
 		// players/watchersのループ内で呼ばれているため、removeClientは別goroutineで呼ぶ
@@ -351,6 +636,51 @@ func (r *Room) sendTo(c *Client, ev *binary.RegularEvent) {
 	}
 }
 
+// newEvSnapshot : viewerに送る部屋の現在の状態のスナップショット.
+// private propsはviewerが見られるものだけ含める.
+// muClients のロックを取得してから呼び出すこと
+func (r *Room) newEvSnapshot(viewer *Client, seq int) *binary.SystemEvent {
+	players := make(binary.Dict, len(r.players))
+	privates := make(binary.Dict)
+	for id, c := range r.players {
+		info := r.visibleClientInfo(c, viewer)
+		players[string(id)] = info.Props
+		if len(info.PrivateProps) > 0 {
+			privates[string(id)] = info.PrivateProps
+		}
+	}
+	roomProp := binary.MarshalRoomPropPayload(
+		r.Visible, r.Joinable, r.Watchable, r.SearchGroup, r.MaxPlayers,
+		uint32(r.deadline/time.Second), r.publicProps, r.privateProps)
+	return binary.NewEvSnapshot(seq, r.masterId(), players, privates, roomProp)
+}
+
+// masterId : MasterのId.
+// 読み込んだ永続部屋にまだ誰も入室していなければMasterが居ないので""
+func (r *Room) masterId() string {
+	if r.master == nil {
+		return ""
+	}
+	return r.master.Id
+}
+
+// joinedInfo : 入室したClientに返す部屋の情報.
+// muClients のロックを取得してから呼び出すこと
+func (r *Room) joinedInfo(rinfo *pb.RoomInfo, players []*pb.ClientInfo, c *Client) *JoinedInfo {
+	now := time.Now()
+	return &JoinedInfo{
+		Room:       rinfo,
+		Players:    players,
+		Client:     c,
+		MasterId:   ClientID(r.masterId()),
+		Deadline:   r.deadline,
+		Turn:       r.turn.info(),
+		Lockstep:   r.lockstep.info(),
+		Timers:     r.timers.info(now),
+		ServerTime: now,
+	}
+}
+
 // broadcast : 全員に送信.
 // muClients のロックを取得してから呼び出すこと
 func (r *Room) broadcast(ev *binary.RegularEvent) {
@@ -362,6 +692,69 @@ func (r *Room) broadcast(ev *binary.RegularEvent) {
 	}
 }
 
+// canSeePrivate : viewerがownerのprivate propsを見られるか. 本人とMasterのみ見られる.
+// muClients のロックを取得してから呼び出すこと
+func (r *Room) canSeePrivate(owner, viewer *Client) bool {
+	if !viewer.isPlayer {
+		return false
+	}
+	return viewer.Id == owner.Id || (r.master != nil && viewer.Id == r.master.Id)
+}
+
+// visibleClientInfo : viewerに見せるcのClientInfo.
+// muClients のロックを取得してから呼び出すこと
+func (r *Room) visibleClientInfo(c, viewer *Client) *pb.ClientInfo {
+	info := c.ClientInfo.Clone()
+	if !r.canSeePrivate(c, viewer) {
+		info.PrivateProps = nil
+	}
+	return info
+}
+
+// broadcastPrivate : ownerのprivate propsを含むEventを本人とMasterに、
+// 含まないpublicをそれ以外に送信する. publicがnilなら本人とMaster以外には送らない.
+// muClients のロックを取得してから呼び出すこと
+func (r *Room) broadcastPrivate(owner *Client, private, public *binary.RegularEvent) {
+	for _, c := range r.players {
+		if r.canSeePrivate(owner, c) {
+			r.sendTo(c, private)
+		} else if public != nil {
+			r.sendTo(c, public)
+		}
+	}
+	if public == nil {
+		return
+	}
+	for _, c := range r.watchers {
+		r.sendTo(c, public)
+	}
+}
+
+// broadcastClientInfo : EvJoined/EvRejoinedを送信する. private propsは本人とMasterにのみ含める.
+// muClients のロックを取得してから呼び出すこと
+func (r *Room) broadcastClientInfo(c *Client, cinfo *pb.ClientInfo, newEv func(*pb.ClientInfo) *binary.RegularEvent) {
+	if len(cinfo.PrivateProps) == 0 {
+		r.broadcast(newEv(cinfo))
+		return
+	}
+	public := cinfo.Clone()
+	public.PrivateProps = nil
+	r.broadcastPrivate(c, newEv(cinfo), newEv(public))
+}
+
+// sendPrivateProps : 新しいMasterに他のPlayerのprivate propsを送る.
+// 以前のMasterが受け取ったprivate propsは取り消せない.
+// muClients のロックを取得してから呼び出すこと
+func (r *Room) sendPrivateProps(master *Client) {
+	empty := binary.MarshalDict(nil)
+	for _, c := range r.players {
+		if c == master || len(c.ClientInfo.PrivateProps) == 0 {
+			continue
+		}
+		r.sendTo(master, binary.NewEvClientProp(c.Id, empty, c.ClientInfo.PrivateProps))
+	}
+}
+
 func (r *Room) msgCreate(msg *MsgCreate) {
 	r.muClients.Lock()
 	defer r.muClients.Unlock()
@@ -380,12 +773,20 @@ func (r *Room) msgCreate(msg *MsgCreate) {
 	r.players[master.ID()] = master
 	r.masterOrder = append(r.masterOrder, master.ID())
 	r.repo.PlayerLog(master, PlayerLogCreate)
+	r.emit(lifecycle.RoomCreated, master.ID(), map[string]any{
+		"number":       r.Number.GetNumber(),
+		"search_group": r.SearchGroup,
+		"max_players":  r.MaxPlayers,
+	})
+	r.RoomInfo.Players = uint32(len(r.players))
+	r.updateRoomInfo()
 
 	rinfo := r.RoomInfo.Clone()
 	cinfo := r.master.ClientInfo.Clone()
 	players := []*pb.ClientInfo{cinfo}
-	msg.Joined <- &JoinedInfo{rinfo, players, master, master.ID(), r.deadline}
-	r.broadcast(binary.NewEvJoined(cinfo))
+	r.addTurnPlayer(master)
+	msg.Joined <- r.joinedInfo(rinfo, players, master)
+	r.broadcastClientInfo(master, cinfo, binary.NewEvJoined)
 
 	r.writeLastMsg(master.ID())
 }
@@ -423,17 +824,26 @@ func (r *Room) msgJoin(msg *MsgJoin) {
 		msg.Err <- err
 		return
 	}
+	empty := len(r.players) == 0
 	r.players[client.ID()] = client
+	prevMaster := r.master
+	if empty {
+		r.master = client
+		r.emptySince = time.Time{}
+	}
 	if rejoin {
 		oldp.Removed("client rejoined as a new client")
 		if r.master == oldp {
 			r.master = client
 		}
 		r.repo.PlayerLog(client, PlayerLogRejoin)
+		r.emit(lifecycle.PlayerRejoined, client.ID(), nil)
 		client.logger.Infof("rejoin player: %v", client.Id)
 	} else {
 		r.masterOrder = append(r.masterOrder, client.ID())
+		r.addTurnPlayer(client)
 		r.repo.PlayerLog(client, PlayerLogJoin)
+		r.emit(lifecycle.PlayerJoined, client.ID(), nil)
 		r.RoomInfo.Players = uint32(len(r.players))
 		r.updateRoomInfo()
 		client.logger.Infof("new player: %v", client.Id)
@@ -443,18 +853,51 @@ func (r *Room) msgJoin(msg *MsgJoin) {
 	cinfo := client.ClientInfo.Clone()
 	players := make([]*pb.ClientInfo, 0, len(r.players))
 	for _, c := range r.players {
-		players = append(players, c.ClientInfo.Clone())
+		players = append(players, r.visibleClientInfo(c, client))
 	}
-	msg.Joined <- &JoinedInfo{rinfo, players, client, r.master.ID(), r.deadline}
+	msg.Joined <- r.joinedInfo(rinfo, players, client)
 	if rejoin {
-		r.broadcast(binary.NewEvRejoined(cinfo))
+		r.broadcastClientInfo(client, cinfo, binary.NewEvRejoined)
 	} else {
-		r.broadcast(binary.NewEvJoined(cinfo))
+		r.broadcastClientInfo(client, cinfo, binary.NewEvJoined)
+	}
+	if empty && prevMaster != nil { // 読み込んだばかりの永続部屋にはMasterがいない
+		r.logger.Infof("master switched: %v -> %v: joined empty room", prevMaster.ID(), client.ID())
+		r.emit(lifecycle.MasterSwitched, client.ID(), map[string]any{"from": prevMaster.Id, "cause": "joined empty room"})
+		r.broadcast(binary.NewEvMasterSwitched(prevMaster.Id, client.Id, "joined empty room"))
 	}
 
 	r.writeLastMsg(client.ID())
 }
 
+func (r *Room) msgRejoin(msg *MsgRejoin) {
+	r.muClients.RLock()
+	defer r.muClients.RUnlock()
+
+	client, ok := r.players[msg.SenderID()]
+	if !ok {
+		err := xerrors.Errorf("Player not found. room=%v, client=%v", r.ID(), msg.SenderID())
+		msg.Err <- NormalWithCode(err, codes.NotFound)
+		return
+	}
+
+	authKey, lastEvSeq, lastMsgSeq := client.Rejoin(msg.MACKey)
+	r.repo.PlayerLog(client, PlayerLogRejoin)
+	r.emit(lifecycle.PlayerRejoined, client.ID(), nil)
+	client.logger.Infof("rejoin player: %v lastEv=%v lastMsg=%v", client.Id, lastEvSeq, lastMsgSeq)
+
+	players := make([]*pb.ClientInfo, 0, len(r.players))
+	for _, c := range r.players {
+		players = append(players, r.visibleClientInfo(c, client))
+	}
+	msg.Rejoined <- &RejoinedInfo{
+		JoinedInfo:   *r.joinedInfo(r.RoomInfo.Clone(), players, client),
+		AuthKey:      authKey,
+		LastEventSeq: lastEvSeq,
+		LastMsgSeq:   lastMsgSeq,
+	}
+}
+
 func (r *Room) msgWatch(msg *MsgWatch) {
 	if !r.Watchable {
 		err := xerrors.Errorf("Room is not watchable. room=%v, client=%v", r.ID(), msg.Info.Id)
@@ -496,10 +939,14 @@ func (r *Room) msgWatch(msg *MsgWatch) {
 	rinfo := r.RoomInfo.Clone()
 	players := make([]*pb.ClientInfo, 0, len(r.players))
 	for _, c := range r.players {
-		players = append(players, c.ClientInfo.Clone())
+		players = append(players, r.visibleClientInfo(c, client))
 	}
 
-	msg.Joined <- &JoinedInfo{rinfo, players, client, r.master.ID(), r.deadline}
+	msg.Joined <- r.joinedInfo(rinfo, players, client)
+
+	if client.IsHub && r.watcherChatDisabled {
+		r.sendTo(client, binary.NewEvWatcherChatChanged(false))
+	}
 }
 
 func (r *Room) msgPing(msg *MsgPing) {
@@ -514,9 +961,26 @@ func (r *Room) msgPing(msg *MsgPing) {
 			return
 		}
 	}
-	msg.Sender.logger.Debugf("ping %v: %v", msg.Sender.Id, msg.Timestamp)
-	ev := binary.NewEvPong(msg.Timestamp, r.RoomInfo.Watchers, r.lastMsg)
+	// クライアントが報告するRTTは参考としてログに出すだけで、Masterの切替などにはサーバで計測したRTTを使う
+	msg.Sender.logger.Debugf("ping %v: %v rtt=%v", msg.Sender.Id, msg.Timestamp, msg.Sender.rtt.Load())
+	ev := binary.NewEvPong(msg.Timestamp, r.RoomInfo.Watchers, r.lastMsg, time.Now())
 	msg.Sender.SendSystemEvent(ev)
+
+	// Masterのping毎に接続品質を通知する
+	if r.clientStats && msg.Sender == r.master {
+		stats := make(map[string]binary.ClientStats, len(r.players))
+		for id, c := range r.players {
+			s := c.Stats()
+			stats[string(id)] = binary.ClientStats{
+				RTT:          s.Rtt,
+				ConnectCount: s.ConnectCount,
+				ResendCount:  s.ResendCount,
+				EvBufUsed:    s.EvbufUsed,
+				EvBufSize:    s.EvbufSize,
+			}
+		}
+		msg.Sender.SendSystemEvent(binary.NewEvClientStats(stats))
+	}
 }
 
 func (r *Room) msgNodeCount(msg *MsgNodeCount) {
@@ -547,7 +1011,7 @@ func (r *Room) msgRoomProp(msg *MsgRoomProp) {
 	defer r.muClients.RUnlock()
 
 	if msg.Sender != r.master {
-		r.logger.Warnf("msgRoomProp: sender %q is not master %q", msg.Sender.Id, r.master.Id)
+		r.logger.Warnf("msgRoomProp: sender %q is not master %q", msg.Sender.Id, r.masterId())
 		r.sendTo(msg.Sender, binary.NewEvPermissionDenied(msg))
 		return
 	}
@@ -555,6 +1019,26 @@ func (r *Room) msgRoomProp(msg *MsgRoomProp) {
 	msg.Sender.logger.Debugf("update room props: v=%v j=%v w=%v group=%v maxp=%v deadline=%v public=%v private=%v",
 		msg.Visible, msg.Joinable, msg.Watchable, msg.SearchGroup, msg.MaxPlayer, msg.ClientDeadline, msg.PublicProps, msg.PrivateProps)
 
+	app := r.repo.app
+	if app.MaxPlayers > 0 && msg.MaxPlayer > app.MaxPlayers {
+		msg.Sender.logger.Warnf("msgRoomProp: max_players exceeds the app limit: %v > %v", msg.MaxPlayer, app.MaxPlayers)
+		r.sendTo(msg.Sender, binary.NewEvPermissionDenied(msg))
+		return
+	}
+
+	publicProps, privateProps := r.RoomInfo.PublicProps, r.RoomInfo.PrivateProps
+	if len(msg.PublicProps) > 0 {
+		publicProps = binary.MarshalDict(mergeProps(r.publicProps, msg.PublicProps))
+	}
+	if len(msg.PrivateProps) > 0 {
+		privateProps = binary.MarshalDict(mergeProps(r.privateProps, msg.PrivateProps))
+	}
+	if app.MaxPropsBytes > 0 && len(publicProps)+len(privateProps) > int(app.MaxPropsBytes) {
+		msg.Sender.logger.Warnf("msgRoomProp: props exceeds the app limit: %v > %v", len(publicProps)+len(privateProps), app.MaxPropsBytes)
+		r.sendTo(msg.Sender, binary.NewEvPermissionDenied(msg))
+		return
+	}
+
 	outputlog := r.RoomInfo.Visible != msg.Visible ||
 		r.RoomInfo.Joinable != msg.Joinable ||
 		r.RoomInfo.Watchable != msg.Watchable ||
@@ -568,25 +1052,13 @@ func (r *Room) msgRoomProp(msg *MsgRoomProp) {
 	r.RoomInfo.MaxPlayers = msg.MaxPlayer
 
 	if len(msg.PublicProps) > 0 {
-		for k, v := range msg.PublicProps {
-			if _, ok := r.publicProps[k]; ok && len(v) == 0 {
-				delete(r.publicProps, k)
-			} else {
-				r.publicProps[k] = v
-			}
-		}
-		r.RoomInfo.PublicProps = binary.MarshalDict(r.publicProps)
+		r.publicProps = mergeProps(r.publicProps, msg.PublicProps)
+		r.RoomInfo.PublicProps = publicProps
 	}
 
 	if len(msg.PrivateProps) > 0 {
-		for k, v := range msg.PrivateProps {
-			if _, ok := r.privateProps[k]; ok && len(v) == 0 {
-				delete(r.privateProps, k)
-			} else {
-				r.privateProps[k] = v
-			}
-		}
-		r.RoomInfo.PrivateProps = binary.MarshalDict(r.privateProps)
+		r.privateProps = mergeProps(r.privateProps, msg.PrivateProps)
+		r.RoomInfo.PrivateProps = privateProps
 	}
 
 	r.updateRoomInfo()
@@ -606,6 +1078,16 @@ func (r *Room) msgRoomProp(msg *MsgRoomProp) {
 		msg.Sender.logger.Infof("room props: v=%v, j=%v, w=%v, group=%v, maxp=%v, deadline=%v",
 			r.Visible, r.Joinable, r.Watchable, r.SearchGroup, r.MaxPlayers, r.deadline)
 	}
+	r.emit(lifecycle.RoomPropsChanged, msg.Sender.ID(), map[string]any{
+		"visible":      r.Visible,
+		"joinable":     r.Joinable,
+		"watchable":    r.Watchable,
+		"search_group": r.SearchGroup,
+		"max_players":  r.MaxPlayers,
+		"deadline":     r.deadline.Seconds(),
+		"public_keys":  propKeys(msg.PublicProps),
+		"private_keys": propKeys(msg.PrivateProps),
+	})
 
 	r.sendTo(msg.Sender, binary.NewEvSucceeded(msg))
 	r.broadcast(binary.NewEvRoomProp(msg.Sender.Id, msg.MsgRoomPropPayload))
@@ -624,22 +1106,45 @@ func (r *Room) msgClientProp(msg *MsgClientProp) {
 		return
 	}
 
-	msg.Sender.logger.Debugf("update client prop: %v", msg.Props)
+	msg.Sender.logger.Debugf("update client prop: public=%v private=%v", msg.Props, msg.PrivateProps)
 
-	if len(msg.Props) > 0 {
-		c := msg.Sender
-		for k, v := range msg.Props {
-			if _, ok := c.props[k]; ok && len(v) == 0 {
-				delete(c.props, k)
-			} else {
-				c.props[k] = v
-			}
+	c := msg.Sender
+	if len(msg.Props) > 0 || len(msg.PrivateProps) > 0 {
+		props := mergeProps(c.props, msg.Props)
+		privateProps := mergeProps(c.privateProps, msg.PrivateProps)
+		marshaled := binary.MarshalDict(props)
+		var marshaledPrivate []byte
+		if len(privateProps) > 0 {
+			marshaledPrivate = binary.MarshalDict(privateProps)
+		}
+		if max := r.repo.app.MaxPropsBytes; max > 0 && len(marshaled)+len(marshaledPrivate) > int(max) {
+			c.logger.Warnf("msgClientProp: props exceeds the app limit: %v > %v", len(marshaled)+len(marshaledPrivate), max)
+			r.sendTo(c, binary.NewEvPermissionDenied(msg))
+			return
 		}
-		c.ClientInfo.Props = binary.MarshalDict(c.props)
+		c.props = props
+		c.privateProps = privateProps
+		c.ClientInfo.Props = marshaled
+		c.ClientInfo.PrivateProps = marshaledPrivate
+		r.emit(lifecycle.ClientPropsChanged, c.ID(), map[string]any{
+			"keys":         propKeys(msg.Props),
+			"private_keys": propKeys(msg.PrivateProps),
+		})
 	}
 
-	r.sendTo(msg.Sender, binary.NewEvSucceeded(msg))
-	r.broadcast(binary.NewEvClientProp(msg.Sender.Id, msg.Payload()))
+	r.sendTo(c, binary.NewEvSucceeded(msg))
+
+	public := binary.MarshalDict(msg.Props)
+	if len(msg.PrivateProps) == 0 {
+		r.broadcast(binary.NewEvClientProp(c.Id, public, nil))
+		return
+	}
+	// private propsだけの変更は本人とMaster以外には通知しない
+	var pubEv *binary.RegularEvent
+	if len(msg.Props) > 0 {
+		pubEv = binary.NewEvClientProp(c.Id, public, nil)
+	}
+	r.broadcastPrivate(c, binary.NewEvClientProp(c.Id, public, binary.MarshalDict(msg.PrivateProps)), pubEv)
 }
 
 func (r *Room) msgTargets(msg *MsgTargets) {
@@ -655,6 +1160,12 @@ func (r *Room) msgTargets(msg *MsgTargets) {
 		}
 	}
 
+	if !r.isTurnOf(msg.Sender) {
+		msg.Sender.logger.Infof("msgTargets: not the turn of %v", msg.Sender.Id)
+		r.sendTo(msg.Sender, binary.NewEvPermissionDenied(msg))
+		return
+	}
+
 	msg.Sender.logger.Debugf("message to targets: %v, %v", msg.Targets, msg.Data)
 
 	ev := binary.NewEvMessage(msg.Sender.Id, msg.Data)
@@ -690,6 +1201,17 @@ func (r *Room) msgToMaster(msg *MsgToMaster) {
 		}
 	}
 
+	if !r.isTurnOf(msg.Sender) {
+		msg.Sender.logger.Infof("msgToMaster: not the turn of %v", msg.Sender.Id)
+		r.sendTo(msg.Sender, binary.NewEvPermissionDenied(msg))
+		return
+	}
+
+	if r.master == nil {
+		r.sendTo(msg.Sender, binary.NewEvTargetNotFound(msg, []string{}))
+		return
+	}
+
 	msg.Sender.logger.Debugf("message to master: %v", msg.Data)
 
 	r.sendTo(r.master, binary.NewEvMessage(msg.Sender.Id, msg.Data))
@@ -708,6 +1230,12 @@ func (r *Room) msgBroadcast(msg *MsgBroadcast) {
 		}
 	}
 
+	if !r.isTurnOf(msg.Sender) {
+		msg.Sender.logger.Infof("msgBroadcast: not the turn of %v", msg.Sender.Id)
+		r.sendTo(msg.Sender, binary.NewEvPermissionDenied(msg))
+		return
+	}
+
 	msg.Sender.logger.Debugf("message to all: %v", msg.Data)
 
 	r.broadcast(binary.NewEvMessage(msg.Sender.Id, msg.Data))
@@ -718,7 +1246,7 @@ func (r *Room) msgSwitchMaster(msg *MsgSwitchMaster) {
 	defer r.muClients.RUnlock()
 
 	if msg.Sender != r.master {
-		msg.Sender.logger.Warnf("sender %q is not master %q", msg.Sender.Id, r.master.Id)
+		msg.Sender.logger.Warnf("sender %q is not master %q", msg.Sender.Id, r.masterId())
 		r.sendTo(msg.Sender, binary.NewEvPermissionDenied(msg))
 	}
 
@@ -730,11 +1258,14 @@ func (r *Room) msgSwitchMaster(msg *MsgSwitchMaster) {
 	}
 
 	r.master = target
+	r.origMaster = ""
+	r.emit(lifecycle.MasterSwitched, target.ID(), map[string]any{"from": msg.Sender.Id, "cause": "switched by master"})
 
 	msg.Sender.logger.Infof("master switched: %v -> %v", msg.Sender.ID(), r.master.Id)
 
 	r.sendTo(msg.Sender, binary.NewEvSucceeded(msg))
-	r.broadcast(binary.NewEvMasterSwitched(msg.Sender.Id, r.master.Id))
+	r.broadcast(binary.NewEvMasterSwitched(msg.Sender.Id, r.master.Id, "switched by master"))
+	r.sendPrivateProps(r.master)
 }
 
 func (r *Room) msgKick(msg *MsgKick) {
@@ -742,7 +1273,7 @@ func (r *Room) msgKick(msg *MsgKick) {
 	defer r.muClients.Unlock()
 
 	if msg.Sender != r.master {
-		msg.Sender.logger.Warnf("sender %q is not master %q", msg.Sender.Id, r.master.Id)
+		msg.Sender.logger.Warnf("sender %q is not master %q", msg.Sender.Id, r.masterId())
 		r.sendTo(msg.Sender, binary.NewEvPermissionDenied(msg))
 		return
 	}
@@ -773,14 +1304,89 @@ func (r *Room) msgAdminKick(msg *MsgAdminKick) {
 	msg.Res <- nil
 }
 
+func (r *Room) msgAdminClose(msg *MsgAdminClose) {
+	r.muClients.Lock()
+	defer r.muClients.Unlock()
+
+	r.logger.Infof("close room by admin: %v", msg.Reason)
+	r.startClosing(msg.Reason)
+	msg.Res <- nil
+}
+
+// startClosing : 新たな入室を止めて全員に退室イベントを送り、猶予をおいて部屋を閉じる.
+// muClients のロックを取得してから呼び出す.
+func (r *Room) startClosing(reason string) {
+	if r.closing {
+		return
+	}
+	r.closing = true
+	r.closeReason = reason
+
+	if r.persistent != nil {
+		// 入室を止める前のフラグを書き戻す
+		r.persistent.Visible = r.RoomInfo.Visible
+		r.persistent.Joinable = r.RoomInfo.Joinable
+		r.persistent.Watchable = r.RoomInfo.Watchable
+	}
+
+	r.RoomInfo.Joinable = false
+	r.RoomInfo.Watchable = false
+	r.updateRoomInfo()
+	for _, id := range r.masterOrder {
+		r.broadcast(binary.NewEvLeft(string(id), r.master.Id, reason))
+	}
+
+	// イベントが送信されるのを待ってから閉じる
+	time.AfterFunc(adminCloseWait, func() {
+		r.SendMessage(&msgCloseRoom{Reason: reason})
+	})
+}
+
+func (r *Room) msgCloseRoom(msg *msgCloseRoom) {
+	r.muClients.Lock()
+	defer r.muClients.Unlock()
+
+	select {
+	case <-r.done:
+		return // 既に全員退室している
+	default:
+	}
+
+	for _, c := range r.watchers {
+		r.removeWatcher(c, msg.Reason)
+	}
+	for cid, c := range r.players {
+		delete(r.players, cid)
+		r.repo.PlayerLog(c, PlayerLogClose)
+		r.emit(lifecycle.PlayerLeft, cid, map[string]any{"cause": msg.Reason})
+		c.logger.Infof("player left: %v: %v", cid, msg.Reason)
+		c.Removed(msg.Reason)
+	}
+	r.masterOrder = nil
+	r.turn.stop()
+	r.lockstep.stop()
+	close(r.done)
+}
+
+func (r *Room) msgAdminNotice(msg *MsgAdminNotice) {
+	r.muClients.RLock()
+	defer r.muClients.RUnlock()
+
+	r.logger.Infof("notice by admin: %v", msg.Message)
+	r.broadcast(binary.NewEvNotice(msg.Message))
+	msg.Res <- nil
+}
+
 func (r *Room) msgGetRoomInfo(msg *MsgGetRoomInfo) {
 	ri := r.RoomInfo.Clone()
 
 	r.muClients.RLock()
 	defer r.muClients.RUnlock()
 	cis := make([]*pb.ClientInfo, 0, len(r.masterOrder))
+	stats := make([]*pb.ClientStats, 0, len(r.masterOrder))
 	for _, id := range r.masterOrder {
 		cis = append(cis, r.players[id].ClientInfo.Clone())
+		stats = append(stats, r.players[id].Stats())
 	}
 	lmt := make(map[string]uint64)
 	for p, d := range r.lastMsg {
@@ -794,8 +1400,12 @@ func (r *Room) msgGetRoomInfo(msg *MsgGetRoomInfo) {
 	msg.Res <- &pb.GetRoomInfoRes{
 		RoomInfo:     ri,
 		ClientInfos:  cis,
-		MasterId:     r.master.Id,
+		MasterId:     r.masterId(),
 		LastMsgTimes: lmt,
+		ClientStats:  stats,
+		Turn:         r.turn.info(),
+		Lockstep:     r.lockstep.info(),
+		Timers:       r.timers.info(time.Now()),
 	}
 }
 
@@ -805,6 +1415,12 @@ func (r *Room) msgClientError(msg *MsgClientError) {
 	r.removeClient(msg.Sender, msg.ErrMsg, PlayerLogError)
 }
 
+func (r *Room) msgRateExceeded(msg *MsgRateExceeded) {
+	r.muClients.RLock()
+	defer r.muClients.RUnlock()
+	r.sendTo(msg.Sender, binary.NewEvPermissionDenied(msg.Msg))
+}
+
 func (r *Room) msgClientTimeout(msg *MsgClientTimeout) {
 	r.muClients.Lock()
 	defer r.muClients.Unlock()
@@ -835,3 +1451,54 @@ func (r *Room) SendMessage(msg Msg) {
 func (r *Room) Repo() IRepo {
 	return r.repo
 }
+
+// mergeProps : propsにdiffを適用した新しいDictを返す.
+// diffの値が空のkeyは既存なら削除される.
+func mergeProps(props, diff binary.Dict) binary.Dict {
+	merged := make(binary.Dict, len(props)+len(diff))
+	for k, v := range props {
+		merged[k] = v
+	}
+	for k, v := range diff {
+		if _, ok := merged[k]; ok && len(v) == 0 {
+			delete(merged, k)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// emit : ライフサイクルイベントを出力する
+func (r *Room) emit(typ lifecycle.EventType, cid ClientID, data map[string]any) {
+	lifecycle.Emit(&lifecycle.Event{
+		Type:     typ,
+		Time:     time.Now(),
+		AppId:    r.AppId,
+		RoomId:   r.Id,
+		HostId:   r.HostId,
+		ClientId: string(cid),
+		Data:     data,
+	})
+}
+
+func playerLeftEventType(logmsg PlayerLogMsg) lifecycle.EventType {
+	switch logmsg {
+	case PlayerLogKick:
+		return lifecycle.PlayerKicked
+	case PlayerLogTimeout:
+		return lifecycle.PlayerTimeout
+	case PlayerLogError:
+		return lifecycle.PlayerError
+	}
+	return lifecycle.PlayerLeft
+}
+
+func propKeys(props binary.Dict) []string {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"time"
@@ -14,6 +15,7 @@ import (
 	"wsnet2/game"
 	"wsnet2/log"
 	"wsnet2/pb"
+	"wsnet2/trace"
 )
 
 func (sv *GameService) serveGRPC(ctx context.Context) <-chan error {
@@ -30,7 +32,7 @@ func (sv *GameService) serveGRPC(ctx context.Context) <-chan error {
 			return
 		}
 
-		server := grpc.NewServer()
+		server := grpc.NewServer(grpc.ChainUnaryInterceptor(trace.UnaryServerInterceptor()))
 		pb.RegisterGameServer(server, sv)
 
 		c := make(chan error)
@@ -58,6 +60,7 @@ func (sv *GameService) Create(ctx context.Context, in *pb.CreateRoomReq) (*pb.Jo
 		log.KeyClient, in.MasterInfo.Id,
 		log.KeyRequestedAt, float64(time.Now().UnixMilli())/1000,
 	)
+	logger = trace.LoggerWith(ctx, logger)
 	sv.fillRoomOption(in.RoomOption)
 	logger.Debugf("gRPC Create: %v %v", in.RoomOption, in.MasterInfo)
 
@@ -100,6 +103,7 @@ func (sv *GameService) Join(ctx context.Context, in *pb.JoinRoomReq) (*pb.Joined
 		log.KeyRoom, in.RoomId,
 		log.KeyRequestedAt, float64(time.Now().UnixMilli())/1000,
 	)
+	logger = trace.LoggerWith(ctx, logger)
 	logger.Debugf("gRPC Join: %v %v", in.RoomId, in.ClientInfo)
 
 	repo, ok := sv.repos[in.AppId]
@@ -129,6 +133,7 @@ func (sv *GameService) Watch(ctx context.Context, in *pb.JoinRoomReq) (*pb.Joine
 		log.KeyRoom, in.RoomId,
 		log.KeyRequestedAt, float64(time.Now().UnixMilli())/1000,
 	)
+	logger = trace.LoggerWith(ctx, logger)
 	logger.Debugf("gRPC Watch: %v %v", in.RoomId, in.ClientInfo)
 
 	repo, ok := sv.repos[in.AppId]
@@ -150,6 +155,36 @@ func (sv *GameService) Watch(ctx context.Context, in *pb.JoinRoomReq) (*pb.Joine
 	return res, nil
 }
 
+func (sv *GameService) Rejoin(ctx context.Context, in *pb.RejoinRoomReq) (*pb.JoinedRoomRes, error) {
+	logger := log.GetLoggerWith(
+		log.KeyHandler, "grpc:Rejoin",
+		log.KeyApp, in.AppId,
+		log.KeyClient, in.ClientId,
+		log.KeyRoom, in.RoomId,
+		log.KeyRequestedAt, float64(time.Now().UnixMilli())/1000,
+	)
+	logger = trace.LoggerWith(ctx, logger)
+	logger.Debugf("gRPC Rejoin: %v %v", in.RoomId, in.ClientId)
+
+	repo, ok := sv.repos[in.AppId]
+	if !ok {
+		logger.Errorf("invalid app_id: %v", in.AppId)
+		return nil, status.Errorf(codes.Internal, "Invalid app_id: %v", in.AppId)
+	}
+
+	res, err := repo.RejoinRoom(ctx, in.RoomId, in.ClientId, in.MacKey)
+	if err != nil {
+		logEWC(logger, "repo.RejoinRoom", err)
+		return nil, status.Errorf(err.Code(), "RejoinRoom failed: %s", err)
+	}
+
+	res.Url = fmt.Sprintf(sv.wsURLFormat, res.RoomInfo.Id)
+
+	logger.Infof("gRPC Rejoin OK: room=%v user=%v", res.RoomInfo.Id, in.ClientId)
+
+	return res, nil
+}
+
 func (sv *GameService) GetRoomInfo(ctx context.Context, in *pb.GetRoomInfoReq) (*pb.GetRoomInfoRes, error) {
 	logger := log.GetLoggerWith(
 		log.KeyHandler, "grpc:GetRoomInfo",
@@ -157,6 +192,7 @@ func (sv *GameService) GetRoomInfo(ctx context.Context, in *pb.GetRoomInfoReq) (
 		log.KeyRoom, in.RoomId,
 		log.KeyRequestedAt, float64(time.Now().UnixMilli())/1000,
 	)
+	logger = trace.LoggerWith(ctx, logger)
 	logger.Debugf("gRPC GetRoomInfo: %v", in.RoomId)
 	repo, ok := sv.repos[in.AppId]
 	if !ok {
@@ -181,6 +217,7 @@ func (sv *GameService) CurrentRooms(ctx context.Context, in *pb.CurrentRoomsReq)
 		log.KeyClient, in.ClientId,
 		log.KeyRequestedAt, float64(time.Now().UnixMilli())/1000,
 	)
+	logger = trace.LoggerWith(ctx, logger)
 	logger.Debugf("gRPC CurrentRooms: %v", in.ClientId)
 	repo, ok := sv.repos[in.AppId]
 	if !ok {
@@ -206,6 +243,7 @@ func (sv *GameService) Kick(ctx context.Context, in *pb.KickReq) (*pb.Empty, err
 		log.KeyClient, in.ClientId,
 		log.KeyRequestedAt, float64(time.Now().UnixMilli())/1000,
 	)
+	logger = trace.LoggerWith(ctx, logger)
 	logger.Debugf("gRPC Kick: %v %v", in.RoomId, in.ClientId)
 	repo, ok := sv.repos[in.AppId]
 	if !ok {
@@ -223,6 +261,65 @@ func (sv *GameService) Kick(ctx context.Context, in *pb.KickReq) (*pb.Empty, err
 	return &pb.Empty{}, nil
 }
 
+func (sv *GameService) Close(ctx context.Context, in *pb.CloseReq) (*pb.Empty, error) {
+	logger := log.GetLoggerWith(
+		log.KeyHandler, "grpc:Close",
+		log.KeyApp, in.AppId,
+		log.KeyRoom, in.RoomId,
+		log.KeyRequestedAt, float64(time.Now().UnixMilli())/1000,
+	)
+	logger = trace.LoggerWith(ctx, logger)
+	logger.Debugf("gRPC Close: %v %q", in.RoomId, in.Reason)
+	repo, ok := sv.repos[in.AppId]
+	if !ok {
+		logger.Errorf("invalid app_id: %v", in.AppId)
+		return nil, status.Errorf(codes.NotFound, "Invalid app_id: %v", in.AppId)
+	}
+	err := repo.AdminClose(ctx, in.RoomId, in.Reason)
+	if err != nil {
+		return nil, adminError(logger, "repo.AdminClose", err)
+	}
+
+	logger.Infof("gRPC Close OK: room=%q reason=%q", in.RoomId, in.Reason)
+
+	return &pb.Empty{}, nil
+}
+
+func (sv *GameService) Notice(ctx context.Context, in *pb.NoticeReq) (*pb.Empty, error) {
+	logger := log.GetLoggerWith(
+		log.KeyHandler, "grpc:Notice",
+		log.KeyApp, in.AppId,
+		log.KeyRoom, in.RoomId,
+		log.KeyRequestedAt, float64(time.Now().UnixMilli())/1000,
+	)
+	logger = trace.LoggerWith(ctx, logger)
+	logger.Debugf("gRPC Notice: %v %q", in.RoomId, in.Message)
+	repo, ok := sv.repos[in.AppId]
+	if !ok {
+		logger.Errorf("invalid app_id: %v", in.AppId)
+		return nil, status.Errorf(codes.NotFound, "Invalid app_id: %v", in.AppId)
+	}
+	err := repo.AdminNotice(ctx, in.RoomId, in.Message, logger)
+	if err != nil {
+		return nil, adminError(logger, "repo.AdminNotice", err)
+	}
+
+	logger.Infof("gRPC Notice OK: room=%q message=%q", in.RoomId, in.Message)
+
+	return &pb.Empty{}, nil
+}
+
+// adminError : 管理操作のエラーをgRPCのstatusに変換する
+func adminError(logger log.Logger, msg string, err error) error {
+	var ewc game.ErrorWithCode
+	if errors.As(err, &ewc) {
+		logEWC(logger, msg, ewc)
+		return status.Errorf(ewc.Code(), "%s: %s", msg, ewc)
+	}
+	logger.Errorf("%s: %+v", msg, err)
+	return status.Errorf(codes.Internal, "%s: %s", msg, err)
+}
+
 func logEWC(logger log.Logger, msg string, err game.ErrorWithCode) {
 	if err.IsNormal() {
 		logger.Infof("%s: %v", msg, err)
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"wsnet2/log"
+	"wsnet2/metrics"
 )
 
 func (sv *GameService) servePprof(ctx context.Context) <-chan error {
@@ -51,6 +52,9 @@ func (sv *GameService) servePprof(ctx context.Context) <-chan error {
 		_, _ = w.Write([]byte(fmt.Sprintf("%+v\n", sv.db.Stats())))
 	})
 
+	// Prometheus形式のメトリクス
+	http.Handle("/metrics", metrics.Handler())
+
 	errCh := make(chan error)
 
 	sv.preparation.Add(1)
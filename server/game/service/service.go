@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"runtime"
 	"sync"
 	"time"
 
@@ -11,15 +12,17 @@ import (
 	"wsnet2/config"
 	"wsnet2/game"
 	"wsnet2/log"
+	"wsnet2/metrics"
 	"wsnet2/pb"
 )
 
 const (
 	registerQuery = "" +
-		"INSERT INTO `game_server` (`hostname`, `public_name`, `grpc_port`, `ws_port`, `status`) VALUES (:hostname, :public_name, :grpc_port, :ws_port, :status) " +
-		"ON DUPLICATE KEY UPDATE `public_name`=:public_name, `grpc_port`=:grpc_port, `ws_port`=:ws_port, `status`=:status, id=last_insert_id(id)"
+		"INSERT INTO `game_server` (`hostname`, `public_name`, `grpc_port`, `ws_port`, `region`, `status`) VALUES (:hostname, :public_name, :grpc_port, :ws_port, :region, :status) " +
+		"ON DUPLICATE KEY UPDATE `public_name`=:public_name, `grpc_port`=:grpc_port, `ws_port`=:ws_port, `region`=:region, `status`=:status, id=last_insert_id(id)"
+	// 管理者が設定したdrainingはrunningで上書きしない (closingへの遷移は許可する)
 	heartbeatQuery = "" +
-		"UPDATE `game_server` SET `status`=:status, heartbeat=:now WHERE `id`=:hostid"
+		"UPDATE `game_server` SET `status`=IF(`status`=3 AND :status=1, `status`, :status), heartbeat=:now, `rooms`=:rooms, `clients`=:clients, `capacity`=:capacity, `watchers`=:watchers, `goroutines`=:goroutines, `msg_backlog`=:msg_backlog WHERE `id`=:hostid"
 )
 
 type GameService struct {
@@ -81,6 +84,7 @@ func registerHost(db *sqlx.DB, conf *config.GameConf) (int64, error) {
 		"public_name": conf.PublicName,
 		"grpc_port":   conf.GRPCPort,
 		"ws_port":     conf.WebsocketPort,
+		"region":      conf.Region,
 		"status":      common.HostStatusRunning,
 	}
 	res, err := sqlx.NamedExec(db, registerQuery, bind)
@@ -128,14 +132,18 @@ func (s *GameService) heartbeat(ctx context.Context) <-chan error {
 			case <-t.C:
 			}
 
-			bind["now"] = time.Now().Unix()
+			now := time.Now()
+			bind["now"] = now.Unix()
 
+			s.bindLoad(bind)
 			if s.shutdownRequested() {
 				bind["status"] = common.HostStatusClosing
 				log.Infof("the host is shutting down and waiting for %v rooms to be closed", s.numRooms())
 			}
 
-			if _, err := sqlx.NamedExec(s.db, heartbeatQuery, bind); err != nil {
+			_, err := sqlx.NamedExec(s.db, heartbeatQuery, bind)
+			metrics.DBQueryLatency.With("game_heartbeat").ObserveSince(now)
+			if err != nil {
 				errCh <- err
 				return
 			}
@@ -161,6 +169,7 @@ func (s *GameService) Shutdown(ctx context.Context) {
 		"hostid": s.HostId,
 		"status": common.HostStatusClosing,
 	}
+	s.bindLoad(bind)
 	if _, err := sqlx.NamedExec(s.db, heartbeatQuery, bind); err != nil {
 		s.done <- err
 		return
@@ -185,6 +194,29 @@ func (s *GameService) Shutdown(ctx context.Context) {
 	}
 }
 
+// bindLoad : heartbeatで報告する負荷を設定する.
+// 空き容量(capacity)は、各アプリの部屋数とクライアント数の上限に対する使用率のうち最大のものを1から引いた値.
+// msg_backlogは各部屋のmsgChに滞留しているメッセージ数の最大値で、MsgLoopの処理が追いついていないことを示す.
+func (s *GameService) bindLoad(bind map[string]interface{}) {
+	rooms, clients, watchers, backlog := 0, 0, 0, 0
+	usage := 0.0
+	for _, repo := range s.repos {
+		r, c := repo.GetRoomCount(), repo.GetClientCount()
+		w, b := repo.GetLoad()
+		rooms += r
+		clients += c
+		watchers += w
+		backlog = max(backlog, b)
+		usage = max(usage, float64(r)/float64(s.conf.MaxRooms), float64(c)/float64(s.conf.MaxClients))
+	}
+	bind["rooms"] = rooms
+	bind["clients"] = clients
+	bind["capacity"] = max(1-usage, 0)
+	bind["watchers"] = watchers
+	bind["goroutines"] = runtime.NumGoroutine()
+	bind["msg_backlog"] = backlog
+}
+
 func (s *GameService) numRooms() int {
 	numRooms := 0
 	for _, repo := range s.repos {
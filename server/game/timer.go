@@ -0,0 +1,130 @@
+package game
+
+import (
+	"sort"
+	"time"
+
+	"wsnet2/binary"
+	"wsnet2/pb"
+)
+
+// maxRoomTimers : 部屋毎のタイマー数の上限
+const maxRoomTimers = 32
+
+// roomTimers : Masterが設定する名前付きのタイマー.
+// Room.MsgLoopからのみ触るのでロックしない.
+type roomTimers struct {
+	expires map[string]time.Time
+	timer   *time.Timer
+}
+
+func newRoomTimers() *roomTimers {
+	t := &roomTimers{
+		expires: make(map[string]time.Time),
+		timer:   time.NewTimer(time.Hour),
+	}
+	t.timer.Stop()
+	return t
+}
+
+// C : 最も早く満了するタイマーを通知するchannel
+func (t *roomTimers) C() <-chan time.Time {
+	return t.timer.C
+}
+
+// set : タイマーを設定する. dが0なら取り消す
+func (t *roomTimers) set(name string, d time.Duration, now time.Time) {
+	if d <= 0 {
+		delete(t.expires, name)
+	} else {
+		t.expires[name] = now.Add(d)
+	}
+	t.reset(now)
+}
+
+// reset : 次に満了するタイマーに合わせてtimerを設定し直す
+func (t *roomTimers) reset(now time.Time) {
+	t.timer.Stop()
+	var next time.Time
+	for _, exp := range t.expires {
+		if next.IsZero() || exp.Before(next) {
+			next = exp
+		}
+	}
+	if !next.IsZero() {
+		t.timer.Reset(next.Sub(now))
+	}
+}
+
+// expired : 満了したタイマーを満了時刻順に取り出す
+func (t *roomTimers) expired(now time.Time) []string {
+	var names []string
+	for name, exp := range t.expires {
+		if !exp.After(now) {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ei, ej := t.expires[names[i]], t.expires[names[j]]
+		if ei.Equal(ej) {
+			return names[i] < names[j]
+		}
+		return ei.Before(ej)
+	})
+	for _, name := range names {
+		delete(t.expires, name)
+	}
+	t.reset(now)
+	return names
+}
+
+func (t *roomTimers) info(now time.Time) []*pb.RoomTimer {
+	timers := make([]*pb.RoomTimer, 0, len(t.expires))
+	for name, exp := range t.expires {
+		timers = append(timers, &pb.RoomTimer{
+			Name:      name,
+			Remaining: uint32(max(exp.Sub(now), 0) / time.Millisecond),
+			ExpireAt:  uint64(exp.UnixMilli()),
+		})
+	}
+	sort.Slice(timers, func(i, j int) bool { return timers[i].ExpireAt < timers[j].ExpireAt })
+	return timers
+}
+
+func (t *roomTimers) stop() {
+	t.timer.Stop()
+}
+
+// fireTimers : 満了したタイマーを全員に通知する
+func (r *Room) fireTimers() {
+	r.muClients.RLock()
+	defer r.muClients.RUnlock()
+
+	for _, name := range r.timers.expired(time.Now()) {
+		r.logger.Debugf("timer expired: %v", name)
+		r.broadcast(binary.NewEvTimerExpired(name))
+	}
+}
+
+func (r *Room) msgSetTimer(msg *MsgSetTimer) {
+	r.muClients.RLock()
+	defer r.muClients.RUnlock()
+
+	if msg.Sender != r.master {
+		msg.Sender.logger.Warnf("msgSetTimer: sender %q is not master %q", msg.Sender.Id, r.masterId())
+		r.sendTo(msg.Sender, binary.NewEvPermissionDenied(msg))
+		return
+	}
+	if _, ok := r.timers.expires[msg.Name]; !ok && msg.Duration > 0 && len(r.timers.expires) >= maxRoomTimers {
+		msg.Sender.logger.Warnf("msgSetTimer: too many timers: %v", len(r.timers.expires))
+		r.sendTo(msg.Sender, binary.NewEvPermissionDenied(msg))
+		return
+	}
+
+	now := time.Now()
+	r.timers.set(msg.Name, msg.Duration, now)
+	msg.Sender.logger.Debugf("set timer: %v %v", msg.Name, msg.Duration)
+
+	r.sendTo(msg.Sender, binary.NewEvSucceeded(msg))
+	r.broadcast(binary.NewEvTimer(msg.Name, msg.Duration, now))
+}
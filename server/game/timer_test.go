@@ -0,0 +1,34 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRoomTimers(t *testing.T) {
+	timers := newRoomTimers()
+	defer timers.stop()
+
+	now := time.Now()
+	timers.set("round", 3*time.Second, now)
+	timers.set("start", time.Second, now)
+	timers.set("bonus", 2*time.Second, now)
+	timers.set("bonus", 0, now) // 取り消し
+
+	info := timers.info(now)
+	if len(info) != 2 || info[0].Name != "start" || info[0].Remaining != 1000 || info[1].Name != "round" {
+		t.Fatalf("info = %v", info)
+	}
+
+	if names := timers.expired(now.Add(500 * time.Millisecond)); len(names) != 0 {
+		t.Fatalf("expired too early: %v", names)
+	}
+	names := timers.expired(now.Add(5 * time.Second))
+	if wants := []string{"start", "round"}; !reflect.DeepEqual(names, wants) {
+		t.Fatalf("expired = %v, wants %v", names, wants)
+	}
+	if len(timers.expires) != 0 {
+		t.Fatalf("timers remain: %v", timers.expires)
+	}
+}
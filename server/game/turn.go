@@ -0,0 +1,183 @@
+package game
+
+import (
+	"time"
+
+	"wsnet2/binary"
+	"wsnet2/pb"
+)
+
+const (
+	turnCauseStart   = "start"
+	turnCauseEnd     = "end"
+	turnCauseTimeout = "timeout"
+	turnCauseLeft    = "player left"
+)
+
+// turnState : ターン制の部屋の手番.
+// muClients で保護する.
+type turnState struct {
+	// order : 手番の順序. 入室順で、退室したPlayerは除かれる
+	order  []ClientID
+	active int
+	num    uint32
+
+	timeout  time.Duration
+	deadline time.Time
+	timer    *time.Timer
+}
+
+// newTurnState : ターン制でなければnil
+func newTurnState(turnBased bool, timeoutSec uint32) *turnState {
+	if !turnBased {
+		return nil
+	}
+	t := &turnState{
+		timeout: time.Duration(timeoutSec) * time.Second,
+	}
+	if t.timeout > 0 {
+		t.timer = time.NewTimer(t.timeout)
+		t.timer.Stop()
+	}
+	return t
+}
+
+// timeoutC : 手番の制限時間を通知するchannel. 無制限ならnil
+func (t *turnState) timeoutC() <-chan time.Time {
+	if t == nil || t.timer == nil {
+		return nil
+	}
+	return t.timer.C
+}
+
+func (t *turnState) activeID() ClientID {
+	if len(t.order) == 0 {
+		return ""
+	}
+	return t.order[t.active]
+}
+
+// next : 手番をidxのPlayerに移す
+func (t *turnState) next(idx int) {
+	if len(t.order) == 0 {
+		t.active = 0
+	} else {
+		t.active = idx % len(t.order)
+	}
+	t.num++
+	if t.timer != nil {
+		t.deadline = time.Now().Add(t.timeout)
+		t.timer.Reset(t.timeout)
+	}
+}
+
+func (t *turnState) info() *pb.TurnInfo {
+	if t == nil {
+		return nil
+	}
+	order := make([]string, len(t.order))
+	for i, id := range t.order {
+		order[i] = string(id)
+	}
+	return &pb.TurnInfo{
+		Order:    order,
+		ActiveId: string(t.activeID()),
+		Turn:     t.num,
+		Timeout:  uint32(t.timeout / time.Second),
+	}
+}
+
+func (t *turnState) stop() {
+	if t != nil && t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+// isTurnOf : cの手番か判定する.
+// ターン制でない部屋や、手番を持たないWatcherは常にtrue.
+// muClients のロックを取得してから呼び出すこと
+func (r *Room) isTurnOf(c *Client) bool {
+	if r.turn == nil || !c.isPlayer {
+		return true
+	}
+	return r.turn.activeID() == c.ID()
+}
+
+// changeTurn : 手番をidx番目のPlayerに移して通知する.
+// muClients のロックを取得してから呼び出すこと
+func (r *Room) changeTurn(idx int, cause string) {
+	r.turn.next(idx)
+	active := r.turn.activeID()
+	r.logger.Infof("turn changed: %v turn=%v cause=%v", active, r.turn.num, cause)
+	r.broadcast(binary.NewEvTurnChanged(string(active), r.turn.num, cause))
+}
+
+// addTurnPlayer : 新しいPlayerを手番の最後に加える.
+// 最初のPlayerなら手番を開始する. 全員が退室した後に入室した場合も開始し直す.
+// muClients のロックを取得してから呼び出すこと
+func (r *Room) addTurnPlayer(c *Client) {
+	if r.turn == nil {
+		return
+	}
+	r.turn.order = append(r.turn.order, c.ID())
+	if len(r.turn.order) == 1 {
+		r.changeTurn(0, turnCauseStart)
+	}
+}
+
+// removeTurnPlayer : 退室したPlayerを手番から除く.
+// 手番のPlayerだった場合は次のPlayerに手番を移す.
+// muClients のロックを取得してから呼び出すこと
+func (r *Room) removeTurnPlayer(cid ClientID) {
+	if r.turn == nil {
+		return
+	}
+	t := r.turn
+	for i, id := range t.order {
+		if id != cid {
+			continue
+		}
+		t.order = append(t.order[:i], t.order[i+1:]...)
+		switch {
+		case len(t.order) == 0:
+			t.stop()
+		case i == t.active:
+			// 次のPlayerが詰めてi番目に来ている
+			r.changeTurn(i, turnCauseLeft)
+		case i < t.active:
+			t.active--
+		}
+		return
+	}
+}
+
+// checkTurnTimeout : 手番の制限時間を超えていたら次のPlayerに手番を移す
+func (r *Room) checkTurnTimeout() {
+	r.muClients.Lock()
+	defer r.muClients.Unlock()
+
+	t := r.turn
+	if len(t.order) == 0 || time.Now().Before(t.deadline) {
+		// 待っている間に手番が移った
+		return
+	}
+	r.logger.Infof("turn timeout: %v turn=%v", t.activeID(), t.num)
+	r.changeTurn(t.active+1, turnCauseTimeout)
+}
+
+func (r *Room) msgEndTurn(msg *MsgEndTurn) {
+	r.muClients.Lock()
+	defer r.muClients.Unlock()
+
+	if r.turn == nil || !msg.Sender.isPlayer || !r.isTurnOf(msg.Sender) {
+		msg.Sender.logger.Warnf("msgEndTurn: sender %q is not the active player", msg.Sender.Id)
+		r.sendTo(msg.Sender, binary.NewEvPermissionDenied(msg))
+		return
+	}
+	if r.players[msg.Sender.ID()] != msg.Sender {
+		return
+	}
+
+	r.sendTo(msg.Sender, binary.NewEvSucceeded(msg))
+	r.changeTurn(r.turn.active+1, turnCauseEnd)
+}
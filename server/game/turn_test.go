@@ -0,0 +1,52 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wsnet2/pb"
+)
+
+func TestRemoveTurnPlayer(t *testing.T) {
+	r := &Room{
+		turn:   newTurnState(true, 60),
+		logger: zap.NewNop().Sugar(),
+	}
+	for _, id := range []ClientID{"p1", "p2", "p3", "p4"} {
+		r.addTurnPlayer(&Client{ClientInfo: &pb.ClientInfo{Id: string(id)}, isPlayer: true})
+	}
+	r.changeTurn(2, turnCauseEnd) // p3
+
+	tests := []struct {
+		remove ClientID
+		active ClientID
+		turn   uint32
+	}{
+		{"p1", "p3", 2}, // 手番より前が抜けても手番は変わらない
+		{"p3", "p4", 3}, // 手番のPlayerが抜けたら次へ
+		{"p4", "p2", 4}, // 最後のPlayerからは先頭へ
+		{"p2", "", 4},
+	}
+	for _, tc := range tests {
+		r.removeTurnPlayer(tc.remove)
+		if a := r.turn.activeID(); a != tc.active {
+			t.Fatalf("remove %v: active=%q, wants %q", tc.remove, a, tc.active)
+		}
+		if r.turn.num != tc.turn {
+			t.Fatalf("remove %v: turn=%v, wants %v", tc.remove, r.turn.num, tc.turn)
+		}
+	}
+
+	// 全員が退室した後に入室したら手番を開始し直す
+	r.turn.deadline = time.Time{}
+	r.addTurnPlayer(&Client{ClientInfo: &pb.ClientInfo{Id: "p5"}, isPlayer: true})
+	if a := r.turn.activeID(); a != "p5" || r.turn.num != 5 {
+		t.Fatalf("refill: active=%q turn=%v, wants p5 5", a, r.turn.num)
+	}
+	if !r.turn.deadline.After(time.Now()) {
+		t.Fatalf("refill: deadline not reset: %v", r.turn.deadline)
+	}
+	r.turn.stop()
+}
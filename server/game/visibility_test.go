@@ -0,0 +1,55 @@
+package game
+
+import (
+	"testing"
+
+	"wsnet2/binary"
+	"wsnet2/pb"
+)
+
+func TestVisibleClientInfo(t *testing.T) {
+	private := binary.MarshalDict(binary.Dict{"secret": binary.MarshalInt(1)})
+	newClient := func(id string, isPlayer bool) *Client {
+		return &Client{
+			ClientInfo: &pb.ClientInfo{Id: id, Props: binary.MarshalDict(nil), PrivateProps: private},
+			isPlayer:   isPlayer,
+		}
+	}
+	master := newClient("master", true)
+	owner := newClient("owner", true)
+	other := newClient("other", true)
+	watcher := newClient("watcher", false)
+	r := &Room{master: master}
+
+	tests := map[string]struct {
+		viewer *Client
+		wants  bool
+	}{
+		"owner":   {owner, true},
+		"master":  {master, true},
+		"other":   {other, false},
+		"watcher": {watcher, false},
+	}
+	for name, tc := range tests {
+		info := r.visibleClientInfo(owner, tc.viewer)
+		if got := len(info.PrivateProps) > 0; got != tc.wants {
+			t.Errorf("%v: private props visible = %v, wants %v", name, got, tc.wants)
+		}
+	}
+	if len(owner.ClientInfo.PrivateProps) == 0 {
+		t.Fatalf("original ClientInfo modified")
+	}
+
+	// スナップショットにも見られるprivate propsだけ含める
+	r.RoomInfo = &pb.RoomInfo{}
+	r.players = map[ClientID]*Client{"master": master, "owner": owner, "other": other}
+	for name, tc := range tests {
+		sp, err := binary.UnmarshalEvSnapshotPayload(r.newEvSnapshot(tc.viewer, 0).Payload())
+		if err != nil {
+			t.Fatalf("%v: UnmarshalEvSnapshotPayload: %v", name, err)
+		}
+		if _, got := sp.PrivateProps["owner"]; got != tc.wants {
+			t.Errorf("%v: private props in snapshot = %v, wants %v", name, got, tc.wants)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package game
+
+import (
+	"wsnet2/binary"
+)
+
+// denyWatcherChat : Hubで処理するメッセージがGameサーバに直接届いた.
+// 観戦者チャットとリアクションはHub経由の観戦者のみ利用できる
+func (r *Room) denyWatcherChat(sender *Client, msg binary.RegularMsg) {
+	r.muClients.RLock()
+	defer r.muClients.RUnlock()
+
+	if r.players[sender.ID()] != sender && r.watchers[sender.ID()] != sender {
+		return
+	}
+	sender.logger.Warnf("%v is only available via hub: %v", msg.Type(), sender.Id)
+	r.sendTo(sender, binary.NewEvPermissionDenied(msg))
+}
+
+// msgReactionCounts : Hubで集計した観戦者のリアクションをPlayerに送る
+func (r *Room) msgReactionCounts(msg *MsgReactionCounts) {
+	r.muClients.RLock()
+	defer r.muClients.RUnlock()
+
+	if !msg.Sender.IsHub || r.watchers[msg.SenderID()] != msg.Sender {
+		msg.Sender.logger.Warnf("msgReactionCounts: sender %q is not a hub", msg.Sender.Id)
+		r.sendTo(msg.Sender, binary.NewEvPermissionDenied(msg))
+		return
+	}
+	if r.watcherChatDisabled || len(msg.Counts) == 0 {
+		return
+	}
+
+	ev := binary.NewEvReactionCounts(msg.Counts)
+	for _, c := range r.players {
+		r.sendTo(c, ev)
+	}
+}
+
+// msgSetWatcherChat : 観戦者チャットの有効/無効を切り替えて観戦者(Hub)に通知する
+func (r *Room) msgSetWatcherChat(msg *MsgSetWatcherChat) {
+	r.muClients.RLock()
+	defer r.muClients.RUnlock()
+
+	if msg.Sender != r.master {
+		msg.Sender.logger.Warnf("msgSetWatcherChat: sender %q is not master", msg.Sender.Id)
+		r.sendTo(msg.Sender, binary.NewEvPermissionDenied(msg))
+		return
+	}
+
+	changed := r.watcherChatDisabled == msg.Enabled
+	r.watcherChatDisabled = !msg.Enabled
+	msg.Sender.logger.Infof("watcher chat enabled: %v", msg.Enabled)
+
+	r.sendTo(msg.Sender, binary.NewEvSucceeded(msg))
+	if !changed {
+		return
+	}
+	ev := binary.NewEvWatcherChatChanged(msg.Enabled)
+	for _, c := range r.watchers {
+		r.sendTo(c, ev)
+	}
+}
@@ -0,0 +1,107 @@
+package hub
+
+import (
+	"time"
+
+	"wsnet2/binary"
+	"wsnet2/game"
+)
+
+const (
+	// maxWatcherChatBytes : 観戦者チャットの最大長
+	maxWatcherChatBytes = 256
+	// maxReactionKinds : 1回の集計で送るリアクションの種類の上限
+	maxReactionKinds = 32
+)
+
+// chatRate : 観戦者毎のチャットとリアクションの送信数 (1秒毎)
+type chatRate struct {
+	window time.Time
+	count  int
+}
+
+// allowChat : 観戦者がチャットやリアクションを送れるか判定し、送信数を数える
+func (h *Hub) allowChat(cid game.ClientID, now time.Time) bool {
+	limit := h.repo.conf.WatcherChatRate
+	if limit <= 0 {
+		return true
+	}
+	r, ok := h.chatRates[cid]
+	if !ok {
+		r = &chatRate{}
+		h.chatRates[cid] = r
+	}
+	if now.Sub(r.window) >= time.Second {
+		r.window = now
+		r.count = 0
+	}
+	r.count++
+	return r.count <= limit
+}
+
+// checkChat : 観戦者チャットとリアクションを受け付けるか確認し、受け付けなければ拒否を通知する
+func (h *Hub) checkChat(sender *game.Client, msg binary.RegularMsg) bool {
+	if h.watchers[sender.ID()] != sender {
+		return false
+	}
+	if h.room.WatcherChatDisabled {
+		sender.Logger().Debugf("watcher chat is disabled by master: %v", sender.Id)
+		h.sendTo(sender, binary.NewEvPermissionDenied(msg))
+		return false
+	}
+	if !h.allowChat(sender.ID(), time.Now()) {
+		sender.Logger().Infof("watcher chat rate exceeded: %v", sender.Id)
+		h.sendTo(sender, binary.NewEvPermissionDenied(msg))
+		return false
+	}
+	return true
+}
+
+// msgWatcherChat : 同じHubの観戦者にチャットを送る. Gameサーバには送らない
+func (h *Hub) msgWatcherChat(msg *game.MsgWatcherChat) {
+	if len(msg.Message) > maxWatcherChatBytes {
+		msg.Sender.Logger().Infof("watcher chat too long: %v bytes", len(msg.Message))
+		h.sendTo(msg.Sender, binary.NewEvPermissionDenied(msg))
+		return
+	}
+	if !h.checkChat(msg.Sender, msg) {
+		return
+	}
+	msg.Sender.Logger().Debugf("watcher chat: %v", msg.Message)
+	h.broadcast(binary.NewEvWatcherChat(msg.Sender.Id, msg.Message))
+}
+
+// msgWatcherReaction : 同じHubの観戦者にリアクションを送り、Playerに送るために集計する
+func (h *Hub) msgWatcherReaction(msg *game.MsgWatcherReaction) {
+	if !h.checkChat(msg.Sender, msg) {
+		return
+	}
+	msg.Sender.Logger().Debugf("watcher reaction: %v", msg.Reaction)
+	h.broadcast(binary.NewEvWatcherReaction(msg.Sender.Id, msg.Reaction))
+
+	if h.repo.conf.ReactionReportInterval <= 0 {
+		return
+	}
+	if _, ok := h.reactions[msg.Reaction]; ok || len(h.reactions) < maxReactionKinds {
+		h.reactions[msg.Reaction]++
+	}
+}
+
+// reportReactions : 集計したリアクションをGameサーバ経由でPlayerに送る
+func (h *Hub) reportReactions() {
+	if len(h.reactions) == 0 {
+		return
+	}
+	err := h.conn.Send(binary.MsgTypeReactionCounts, binary.MarshalReactionCountsPayload(h.reactions))
+	if err != nil {
+		h.logger.Errorf("send reaction counts: %+v", err)
+	}
+	h.reactions = make(map[string]uint32)
+}
+
+// sendTo : 特定の観戦者に送信. 送信できなければ退室させる
+func (h *Hub) sendTo(c *game.Client, ev *binary.RegularEvent) {
+	if err := c.Send(ev); err != nil {
+		h.removeWatcher(c.ID(), err.Error())
+	}
+}
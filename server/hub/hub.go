@@ -17,7 +17,9 @@ import (
 	"wsnet2/config"
 	"wsnet2/game"
 	"wsnet2/log"
+	"wsnet2/metrics"
 	"wsnet2/pb"
+	"wsnet2/trace"
 )
 
 type Hub struct {
@@ -36,6 +38,10 @@ type Hub struct {
 	watchers map[ClientID]*game.Client
 	wgClient sync.WaitGroup
 
+	// 観戦者チャット (ProcessLoopからのみ触る)
+	chatRates map[ClientID]*chatRate
+	reactions map[string]uint32 // 未送信のリアクションの集計
+
 	// game に通知した直近の nodeCount
 	lastNodeCount    uint32
 	nodeCount        atomic.Uint32
@@ -46,7 +52,7 @@ type Hub struct {
 
 var _ game.IRoom = &Hub{}
 
-func NewHub(repo *Repository, pk int64, appid AppID, roomid RoomID, grpc *grpc.ClientConn, wsHost string, logger log.Logger) (*Hub, error) {
+func NewHub(ctx context.Context, repo *Repository, pk int64, appid AppID, roomid RoomID, grpc *grpc.ClientConn, wsHost string, logger log.Logger) (*Hub, error) {
 	// hub->game 接続に使うclientId. このhubを作成するトリガーになったclientIdは使わない
 	// roomIdもhostIdもユニークなので hostId:roomId はユニークになるはず。
 	clientid := fmt.Sprintf("hub:%d:%s", repo.hostId, roomid)
@@ -55,13 +61,20 @@ func NewHub(repo *Repository, pk int64, appid AppID, roomid RoomID, grpc *grpc.C
 		IsHub: true,
 	}
 
-	ctx := context.Background() // hubの寿命はリクエストなどに紐付かない
+	// hubの寿命は作成のきっかけになったリクエストに紐付かないので新しいトレースで開始し、
+	// リクエストのSpanはリンクとして記録する
+	link := trace.SpanContextFromContext(ctx)
+	ctx, span := trace.Start(context.Background(), "NewHub")
+	span.AddLink(link)
+	span.SetAttr("room", string(roomid))
+	defer span.End()
 
 	lg := logger.WithOptions(zap.AddCallerSkip(1))
 	room, conn, err := client.WatchDirect(
 		ctx, grpc, wsHost, appid, string(roomid), clinfo,
 		func(err error) { lg.Warnf("%v: %v", clientid, err) })
 	if err != nil {
+		span.SetError(err)
 		return nil, xerrors.Errorf("client.WatchDirect: %w", err)
 	}
 
@@ -80,6 +93,7 @@ func NewHub(repo *Repository, pk int64, appid AppID, roomid RoomID, grpc *grpc.C
 		repo:     repo,
 		hubPK:    pk,
 		roomId:   roomid,
+		appId:    appid,
 		clientId: clientid,
 		room:     room,
 		conn:     conn,
@@ -87,6 +101,9 @@ func NewHub(repo *Repository, pk int64, appid AppID, roomid RoomID, grpc *grpc.C
 		done:     done,
 		watchers: make(map[ClientID]*game.Client),
 
+		chatRates: make(map[ClientID]*chatRate),
+		reactions: make(map[string]uint32),
+
 		nodeCountUpdated: make(chan struct{}, 1),
 
 		logger: logger,
@@ -106,6 +123,15 @@ func (h *Hub) ClientConf() *config.ClientConf {
 	return &h.repo.conf.ClientConf
 }
 
+// EventSpill : Hubは溢れたEventを保持しない
+func (h *Hub) EventSpill() game.SpillStore {
+	return nil
+}
+
+func (h *Hub) App() *pb.App {
+	return h.repo.apps[h.appId]
+}
+
 func (h *Hub) Repo() game.IRepo {
 	return h.repo
 }
@@ -142,6 +168,7 @@ func (h *Hub) removeWatcher(cid game.ClientID, cause string) {
 
 	h.logger.Infof("Watcher removed: client=%v %v", cid, cause)
 	delete(h.watchers, cid)
+	delete(h.chatRates, cid)
 	h.storeNodeCount()
 
 	c.Removed(cause)
@@ -152,7 +179,8 @@ func (h *Hub) storeNodeCount() {
 	for _, c := range h.watchers {
 		count += c.NodeCount()
 	}
-	h.nodeCount.Store(count)
+	old := h.nodeCount.Swap(count)
+	metrics.AppWatchers.With(h.appId).Add(float64(count) - float64(old))
 	select {
 	case h.nodeCountUpdated <- struct{}{}:
 	default:
@@ -197,11 +225,19 @@ func (h *Hub) nodeCountUpdater() {
 
 // ProcessLoop goroutine dispatch messages and events.
 func (h *Hub) ProcessLoop() {
+	var reportReactions <-chan time.Time
+	if interval := time.Duration(h.repo.conf.ReactionReportInterval); interval > 0 {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		reportReactions = t.C
+	}
 Loop:
 	for {
 		select {
 		case msg := <-h.msgCh:
 			h.dispatchMsg(msg)
+		case <-reportReactions:
+			h.reportReactions()
 		case ev, ok := <-h.conn.Events():
 			if !ok {
 				h.logger.Debugf("connection events closed")
@@ -217,6 +253,7 @@ Loop:
 		}
 	}
 	h.drainMsg()
+	metrics.AppWatchers.With(h.appId).Add(-float64(h.nodeCount.Swap(0)))
 	h.logger.Debug("Hub.ProcessLoop() finish")
 }
 
@@ -263,6 +300,12 @@ func (h *Hub) dispatchMsg(msg game.Msg) {
 		m.Sender.Logger().Debugf("message to all: %v", m.Data)
 		h.proxyMessage(m.RegularMsg)
 
+	// 観戦者チャットはHub内で完結させる
+	case *game.MsgWatcherChat:
+		h.msgWatcherChat(m)
+	case *game.MsgWatcherReaction:
+		h.msgWatcherReaction(m)
+
 	default:
 		h.logger.Errorf("unknown msg type: %T %v", m, m)
 	}
@@ -331,6 +374,7 @@ func (h *Hub) msgWatch(msg *game.MsgWatch) {
 	}
 	rinfo.SetCreated(h.room.Created)
 
+	// Hubは観戦者として接続しているのでprivate propsを受け取らず、配下の観戦者にも渡らない
 	players := make([]*pb.ClientInfo, 0, len(h.room.Players))
 	for _, p := range h.room.Players {
 		players = append(players, &pb.ClientInfo{
@@ -357,7 +401,7 @@ func (h *Hub) msgPing(msg *game.MsgPing) {
 		return
 	}
 	msg.Sender.Logger().Debugf("ping %v: %v", msg.Sender.Id, msg.Timestamp)
-	ev := binary.NewEvPong(msg.Timestamp, h.room.Watchers, h.room.LastMsgTimes)
+	ev := binary.NewEvPong(msg.Timestamp, h.room.Watchers, h.room.LastMsgTimes, time.Now())
 	msg.Sender.SendSystemEvent(ev)
 }
 
@@ -30,6 +30,8 @@ type Repository struct {
 	db       *sqlx.DB
 	grpcPool *common.GrpcPool
 
+	apps map[AppID]*pb.App
+
 	muhubs sync.RWMutex
 	hubs   map[RoomID]*Hub
 
@@ -43,19 +45,30 @@ func NewRepository(db *sqlx.DB, conf *config.HubConf, hostId uint32) (*Repositor
 		return nil, xerrors.Errorf("delete rooms: %w", err)
 	}
 
+	query := "SELECT id, `key`, max_rooms, max_players, max_watchers, max_props_bytes, max_msg_rate, max_lifetime, idle_timeout, empty_grace FROM app"
+	var apps []*pb.App
+	if err := db.Select(&apps, query); err != nil {
+		return nil, xerrors.Errorf("select apps: %w", err)
+	}
+
 	repo := &Repository{
 		hostId:   hostId,
 		conf:     conf,
 		db:       db,
 		grpcPool: common.NewGrpcPool(grpc.WithTransportCredentials(insecure.NewCredentials())),
+		apps:     make(map[AppID]*pb.App, len(apps)),
 
 		hubs:    make(map[RoomID]*Hub),
 		clients: make(map[ClientID]map[RoomID]*game.Client),
 	}
+	for _, app := range apps {
+		repo.apps[app.Id] = app
+	}
 	return repo, nil
 }
 
 func (r *Repository) insertHub(ctx context.Context, tx sqlx.ExecerContext, roomId RoomID) (int64, error) {
+	defer metrics.DBQueryLatency.With("hub_insert").ObserveSince(time.Now())
 	res, err := tx.ExecContext(ctx,
 		"INSERT INTO `hub` (`host_id`, `room_id`, `watchers`, `created`) VALUES (?,?,?,?)",
 		r.hostId, string(roomId), 0, time.Now().UTC())
@@ -66,6 +79,7 @@ func (r *Repository) insertHub(ctx context.Context, tx sqlx.ExecerContext, roomI
 }
 
 func (r *Repository) deleteHub(hub *Hub) {
+	defer metrics.DBQueryLatency.With("hub_delete").ObserveSince(time.Now())
 	_, err := r.db.Exec("DELETE FROM `hub` WHERE `id` = ?", hub.hubPK)
 	if err != nil {
 		hub.logger.Errorf("delete from db: %v", err)
@@ -73,6 +87,7 @@ func (r *Repository) deleteHub(hub *Hub) {
 }
 
 func (r *Repository) updateHubWatchers(hub *Hub, watchers int) {
+	defer metrics.DBQueryLatency.With("hub_update").ObserveSince(time.Now())
 	_, err := r.db.Exec("UPDATE `hub` SET `watchers`= ? WHERE `id` = ?", watchers, hub.hubPK)
 	if err != nil {
 		hub.logger.Errorf("update hub.watchers: %v", err)
@@ -102,7 +117,7 @@ func (r *Repository) getOrCreateHub(ctx context.Context, appId AppID, roomId Roo
 			return nil, xerrors.Errorf("insert into hub: %w", err)
 		}
 
-		hub, err = NewHub(r, pk, appId, roomId, grpc, wsHost, logger)
+		hub, err = NewHub(ctx, r, pk, appId, roomId, grpc, wsHost, logger)
 		if err != nil {
 			tx.Rollback()
 			return nil, xerrors.Errorf("new hub: %w", err)
@@ -139,6 +154,14 @@ func (r *Repository) WatchRoom(ctx context.Context, appId AppID, roomId RoomID,
 		return nil, game.WithCode(
 			xerrors.Errorf("reached to the max_clients"), codes.ResourceExhausted)
 	}
+	app, ok := r.apps[appId]
+	if !ok {
+		return nil, game.WithCode(
+			xerrors.Errorf("unknown app: %v", appId), codes.NotFound)
+	}
+	if ewc := r.checkWatchQuota(app, client); ewc != nil {
+		return nil, ewc
+	}
 
 	hub, err := r.getOrCreateHub(ctx, appId, roomId, grpcHost, wsHost)
 	if err != nil {
@@ -198,6 +221,29 @@ func (r *Repository) WatchRoom(ctx context.Context, appId AppID, roomId RoomID,
 	}, nil
 }
 
+// checkWatchQuota : アプリ毎の上限を確認する
+func (r *Repository) checkWatchQuota(app *pb.App, client *pb.ClientInfo) game.ErrorWithCode {
+	if app.MaxWatchers > 0 {
+		watchers := uint32(0)
+		r.muhubs.RLock()
+		for _, h := range r.hubs {
+			if h.appId == app.Id {
+				watchers += h.nodeCount.Load()
+			}
+		}
+		r.muhubs.RUnlock()
+		if watchers >= app.MaxWatchers {
+			return game.NormalWithCode(
+				xerrors.Errorf("reached to the app max_watchers: %v", app.MaxWatchers), common.CodeQuotaExceeded)
+		}
+	}
+	if app.MaxPropsBytes > 0 && len(client.Props) > int(app.MaxPropsBytes) {
+		return game.NormalWithCode(
+			xerrors.Errorf("client props exceeds the app limit: %v > %v", len(client.Props), app.MaxPropsBytes), common.CodeQuotaExceeded)
+	}
+	return nil
+}
+
 func (r *Repository) RemoveClient(cli *game.Client) {
 	r.muclients.Lock()
 	defer r.muclients.Unlock()
@@ -233,4 +279,15 @@ func (r *Repository) GetHubCount() int {
 	return len(r.hubs)
 }
 
+// GetLoad : 観戦者数の合計と、HubのmsgChに滞留しているメッセージ数の最大値
+func (r *Repository) GetLoad() (watchers, backlog int) {
+	r.muhubs.RLock()
+	defer r.muhubs.RUnlock()
+	for _, h := range r.hubs {
+		watchers += int(h.nodeCount.Load())
+		backlog = max(backlog, len(h.msgCh))
+	}
+	return watchers, backlog
+}
+
 func (r *Repository) PlayerLog(c *game.Client, msg game.PlayerLogMsg) {}
@@ -14,6 +14,7 @@ import (
 	"wsnet2/hub"
 	"wsnet2/log"
 	"wsnet2/pb"
+	"wsnet2/trace"
 )
 
 func (sv *HubService) serveGRPC(ctx context.Context) <-chan error {
@@ -30,7 +31,7 @@ func (sv *HubService) serveGRPC(ctx context.Context) <-chan error {
 			return
 		}
 
-		server := grpc.NewServer()
+		server := grpc.NewServer(grpc.ChainUnaryInterceptor(trace.UnaryServerInterceptor()))
 		pb.RegisterGameServer(server, sv)
 
 		c := make(chan error)
@@ -59,6 +60,7 @@ func (sv *HubService) Watch(ctx context.Context, in *pb.JoinRoomReq) (*pb.Joined
 		log.KeyRoom, in.RoomId,
 		log.KeyRequestedAt, float64(time.Now().UnixMilli())/1000,
 	)
+	logger = trace.LoggerWith(ctx, logger)
 	logger.Debugf("gRPC Watch: %v %v", in.RoomId, in.ClientInfo)
 
 	res, err := sv.repo.WatchRoom(ctx, in.AppId, hub.RoomID(in.RoomId), in.ClientInfo, in.GrpcHost, in.WsHost, in.MacKey)
@@ -8,6 +8,7 @@ import (
 	_ "net/http/pprof"
 
 	"wsnet2/log"
+	"wsnet2/metrics"
 )
 
 func (sv *HubService) servePprof(ctx context.Context) <-chan error {
@@ -15,6 +16,9 @@ func (sv *HubService) servePprof(ctx context.Context) <-chan error {
 		return nil
 	}
 
+	// Prometheus形式のメトリクス
+	http.Handle("/metrics", metrics.Handler())
+
 	errCh := make(chan error)
 
 	sv.preparation.Add(1)
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"runtime"
 	"sync"
 	"time"
 
@@ -11,15 +12,17 @@ import (
 	"wsnet2/config"
 	"wsnet2/hub"
 	"wsnet2/log"
+	"wsnet2/metrics"
 	"wsnet2/pb"
 )
 
 const (
 	registerQuery = "" +
-		"INSERT INTO `hub_server` (`hostname`, `public_name`, `grpc_port`, `ws_port`, `status`) VALUES (:hostname, :public_name, :grpc_port, :ws_port, :status) " +
-		"ON DUPLICATE KEY UPDATE `public_name`=:public_name, `grpc_port`=:grpc_port, `ws_port`=:ws_port, `status`=:status, id=last_insert_id(id)"
+		"INSERT INTO `hub_server` (`hostname`, `public_name`, `grpc_port`, `ws_port`, `region`, `status`) VALUES (:hostname, :public_name, :grpc_port, :ws_port, :region, :status) " +
+		"ON DUPLICATE KEY UPDATE `public_name`=:public_name, `grpc_port`=:grpc_port, `ws_port`=:ws_port, `region`=:region, `status`=:status, id=last_insert_id(id)"
+	// 管理者が設定したdrainingはrunningで上書きしない (closingへの遷移は許可する)
 	heartbeatQuery = "" +
-		"UPDATE `hub_server` SET `status`=:status, heartbeat=:now WHERE `id`=:hostid"
+		"UPDATE `hub_server` SET `status`=IF(`status`=3 AND :status=1, `status`, :status), heartbeat=:now, `rooms`=:rooms, `watchers`=:watchers, `goroutines`=:goroutines, `msg_backlog`=:msg_backlog WHERE `id`=:hostid"
 )
 
 type HubService struct {
@@ -67,6 +70,7 @@ func registerHost(db *sqlx.DB, conf *config.HubConf) (int64, error) {
 		"public_name": conf.PublicName,
 		"grpc_port":   conf.GRPCPort,
 		"ws_port":     conf.WebsocketPort,
+		"region":      conf.Region,
 		"status":      common.HostStatusRunning,
 	}
 	res, err := sqlx.NamedExec(db, registerQuery, bind)
@@ -130,11 +134,15 @@ func (s *HubService) heartbeat(ctx context.Context) <-chan error {
 			case <-t.C:
 			}
 
-			bind["now"] = time.Now().Unix()
+			now := time.Now()
+			bind["now"] = now.Unix()
+			s.bindLoad(bind)
 			if s.shutdownRequested() {
 				bind["status"] = common.HostStatusClosing
 			}
-			if _, err := sqlx.NamedExec(s.db, heartbeatQuery, bind); err != nil {
+			_, err := sqlx.NamedExec(s.db, heartbeatQuery, bind)
+			metrics.DBQueryLatency.With("hub_heartbeat").ObserveSince(now)
+			if err != nil {
 				errCh <- err
 				return
 			}
@@ -160,6 +168,7 @@ func (s *HubService) Shutdown(ctx context.Context) {
 		"hostid": s.HostId,
 		"status": common.HostStatusClosing,
 	}
+	s.bindLoad(bind)
 	if _, err := sqlx.NamedExec(s.db, heartbeatQuery, bind); err != nil {
 		s.done <- err
 		return
@@ -183,3 +192,12 @@ func (s *HubService) Shutdown(ctx context.Context) {
 		}
 	}
 }
+
+// bindLoad : heartbeatで報告する負荷を設定する. roomsは中継している部屋の数
+func (s *HubService) bindLoad(bind map[string]interface{}) {
+	watchers, backlog := s.repo.GetLoad()
+	bind["rooms"] = s.repo.GetHubCount()
+	bind["watchers"] = watchers
+	bind["goroutines"] = runtime.NumGoroutine()
+	bind["msg_backlog"] = backlog
+}
@@ -17,6 +17,7 @@ import (
 	"wsnet2/game"
 	"wsnet2/log"
 	"wsnet2/metrics"
+	"wsnet2/trace"
 )
 
 const (
@@ -101,6 +102,14 @@ func (s *WSHandler) HandleRoom(w http.ResponseWriter, r *http.Request) {
 		log.KeyClient, clientId,
 		log.KeyRequestedAt, float64(time.Now().UnixNano()/1000000)/1000,
 	)
+
+	// 接続確立(NewPeer)までをSpanとして記録する
+	tctx, span := trace.Start(trace.Extract(r.Context(), r.Header.Get(trace.Header)), "ws:room")
+	defer span.End()
+	span.SetAttr("room", roomId)
+	span.SetAttr("client", clientId)
+	logger = trace.LoggerWith(tctx, logger)
+
 	lastEvSeq, err := strconv.Atoi(r.Header.Get("Wsnet2-LastEventSeq"))
 	if err != nil {
 		logger.Infof("websocket: invalid header: LastEventSeq=%v, %+v", r.Header.Get("Wsnet2-LastEventSeq"), err)
@@ -141,8 +150,10 @@ func (s *WSHandler) HandleRoom(w http.ResponseWriter, r *http.Request) {
 	peer, err := game.NewPeer(ctx, cli, conn, lastEvSeq)
 	if err != nil {
 		logger.Warnf("websocket: new peer: %+v", err)
+		span.SetError(err)
 		return
 	}
+	span.End()
 	<-peer.Done()
 	logger.Debugf("websocket: finish: room=%v client=%v peer=%p", roomId, clientId, peer)
 }
@@ -0,0 +1,156 @@
+package lifecycle
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"wsnet2/log"
+)
+
+const (
+	// queueSize : Sink毎の未出力イベントの上限. 溢れたイベントは捨てる
+	queueSize = 4096
+
+	defaultBatchSize     = 100
+	defaultFlushInterval = time.Second
+)
+
+// closeTimeout : Closeで残りのイベントの出力を待つ時間. 過ぎたらリトライを打ち切る
+var closeTimeout = 5 * time.Second
+
+// Emitter : イベントをSink毎にまとめて非同期に出力する
+type Emitter struct {
+	workers []*worker
+	wg      sync.WaitGroup
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+type worker struct {
+	sink      Sink
+	ch        chan *Event
+	batchSize int
+	interval  time.Duration
+	dropped   int
+	muDropped sync.Mutex
+}
+
+func NewEmitter(sinks []Sink, batchSize int, interval time.Duration) *Emitter {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	e := &Emitter{}
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+	for _, s := range sinks {
+		w := &worker{
+			sink:      s,
+			ch:        make(chan *Event, queueSize),
+			batchSize: batchSize,
+			interval:  interval,
+		}
+		e.workers = append(e.workers, w)
+		e.wg.Add(1)
+		go func() {
+			defer e.wg.Done()
+			w.loop(e.ctx)
+		}()
+	}
+	return e
+}
+
+// Emit : イベントを各Sinkのキューに積む. キューが一杯またはClose後なら捨てる
+func (e *Emitter) Emit(ev *Event) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return
+	}
+	for _, w := range e.workers {
+		select {
+		case w.ch <- ev:
+		default:
+			w.muDropped.Lock()
+			w.dropped++
+			w.muDropped.Unlock()
+		}
+	}
+}
+
+// Close : キューに残ったイベントを出力してSinkを閉じる.
+// closeTimeoutを過ぎても出力が終わらなければリトライを打ち切る.
+func (e *Emitter) Close() {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return
+	}
+	e.closed = true
+	for _, w := range e.workers {
+		close(w.ch)
+	}
+	e.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(closeTimeout):
+		log.Errorf("lifecycle: close timeout: cancel writing")
+		e.cancel()
+		<-done
+	}
+	e.cancel()
+}
+
+func (w *worker) loop(ctx context.Context) {
+	defer w.sink.Close()
+
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+
+	batch := make([]*Event, 0, w.batchSize)
+	for {
+		select {
+		case ev, ok := <-w.ch:
+			if !ok {
+				w.flush(ctx, batch)
+				return
+			}
+			batch = append(batch, ev)
+			if len(batch) < w.batchSize {
+				continue
+			}
+		case <-t.C:
+		}
+		w.flush(ctx, batch)
+		batch = batch[:0]
+	}
+}
+
+func (w *worker) flush(ctx context.Context, batch []*Event) {
+	w.muDropped.Lock()
+	dropped := w.dropped
+	w.dropped = 0
+	w.muDropped.Unlock()
+	if dropped > 0 {
+		log.Errorf("lifecycle: %T: %v events dropped", w.sink, dropped)
+	}
+
+	if len(batch) == 0 {
+		return
+	}
+	if err := w.sink.Write(ctx, batch); err != nil {
+		log.Errorf("lifecycle: %T: write %v events: %+v", w.sink, len(batch), err)
+	}
+}
@@ -0,0 +1,102 @@
+// Package lifecycle : 部屋のライフサイクルイベントの記録.
+//
+// 部屋の作成・入退室・Master交代・プロパティ変更・終了などのイベントを
+// 設定されたSink(DB, JSON Linesファイル, webhook)に非同期で出力する.
+package lifecycle
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/xerrors"
+
+	"wsnet2/config"
+)
+
+type EventType string
+
+const (
+	RoomCreated        EventType = "room_created"
+	RoomClosed         EventType = "room_closed"
+	RoomPropsChanged   EventType = "room_props_changed"
+	RoomResult         EventType = "room_result"
+	PlayerJoined       EventType = "player_joined"
+	PlayerRejoined     EventType = "player_rejoined"
+	PlayerLeft         EventType = "player_left"
+	PlayerKicked       EventType = "player_kicked"
+	PlayerTimeout      EventType = "player_timeout"
+	PlayerError        EventType = "player_error"
+	ClientPropsChanged EventType = "client_props_changed"
+	MasterSwitched     EventType = "master_switched"
+)
+
+// Event : ライフサイクルイベント
+type Event struct {
+	Type     EventType      `json:"type"`
+	Time     time.Time      `json:"time"`
+	AppId    string         `json:"app_id"`
+	RoomId   string         `json:"room_id"`
+	HostId   uint32         `json:"host_id"`
+	ClientId string         `json:"client_id,omitempty"`
+	Data     map[string]any `json:"data,omitempty"`
+}
+
+var emitter atomic.Pointer[Emitter]
+
+// Emit : イベントを出力する. Initされていなければ何もしない.
+// 呼び出し元をブロックしない.
+func Emit(ev *Event) {
+	if e := emitter.Load(); e != nil {
+		e.Emit(ev)
+	}
+}
+
+// SetEmitter : Emitで使うEmitterを設定する. nilなら出力しない
+func SetEmitter(e *Emitter) {
+	emitter.Store(e)
+}
+
+// Init : 設定に従ってSinkを初期化する. 戻り値の関数で未出力のイベントを書き出して閉じる
+func Init(conf *config.LifecycleConf, db *sqlx.DB) (func(), error) {
+	if len(conf.LifecycleSinks) == 0 {
+		SetEmitter(nil)
+		return func() {}, nil
+	}
+
+	sinks := make([]Sink, 0, len(conf.LifecycleSinks))
+	closeSinks := func() {
+		for _, s := range sinks {
+			s.Close()
+		}
+	}
+	for _, name := range conf.LifecycleSinks {
+		switch name {
+		case "db":
+			sinks = append(sinks, NewDBSink(db))
+		case "file":
+			s, err := NewFileSink(conf.LifecyclePath)
+			if err != nil {
+				closeSinks()
+				return nil, err
+			}
+			sinks = append(sinks, s)
+		case "webhook":
+			if conf.LifecycleWebhook == "" {
+				closeSinks()
+				return nil, xerrors.Errorf("lifecycle_webhook is not specified")
+			}
+			sinks = append(sinks, NewWebhookSink(conf.LifecycleWebhook, conf.LifecycleWebhookRetry))
+		default:
+			closeSinks()
+			return nil, xerrors.Errorf("unknown lifecycle sink: %q", name)
+		}
+	}
+
+	e := NewEmitter(sinks, conf.LifecycleBatchSize, time.Duration(conf.LifecycleFlushInterval))
+	SetEmitter(e)
+	return func() {
+		SetEmitter(nil)
+		e.Close()
+	}, nil
+}
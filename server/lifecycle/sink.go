@@ -0,0 +1,176 @@
+package lifecycle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/xerrors"
+
+	"wsnet2/metrics"
+)
+
+// Sink : イベントの出力先.
+// Writeは単一のgoroutineから呼ばれる.
+type Sink interface {
+	Write(ctx context.Context, evs []*Event) error
+	Close() error
+}
+
+// FileSink : JSON Lines形式でファイルに出力する
+type FileSink struct {
+	f *os.File
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, xerrors.Errorf("open lifecycle file: %w", err)
+	}
+	return &FileSink{f}, nil
+}
+
+func (s *FileSink) Write(_ context.Context, evs []*Event) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, ev := range evs {
+		if err := enc.Encode(ev); err != nil {
+			return xerrors.Errorf("encode: %w", err)
+		}
+	}
+	if _, err := s.f.Write(buf.Bytes()); err != nil {
+		return xerrors.Errorf("write: %w", err)
+	}
+	return nil
+}
+
+func (s *FileSink) Close() error {
+	return s.f.Close()
+}
+
+// DBSink : room_eventテーブルに出力する
+type DBSink struct {
+	db *sqlx.DB
+}
+
+type eventRow struct {
+	Type     EventType `db:"type"`
+	Datetime time.Time `db:"datetime"`
+	AppId    string    `db:"app_id"`
+	RoomId   string    `db:"room_id"`
+	HostId   uint32    `db:"host_id"`
+	ClientId string    `db:"client_id"`
+	Data     string    `db:"data"`
+}
+
+const insertEventQuery = "INSERT INTO `room_event` (`type`, `datetime`, `app_id`, `room_id`, `host_id`, `client_id`, `data`) " +
+	"VALUES (:type, :datetime, :app_id, :room_id, :host_id, :client_id, :data)"
+
+func NewDBSink(db *sqlx.DB) *DBSink {
+	return &DBSink{db}
+}
+
+func (s *DBSink) Write(ctx context.Context, evs []*Event) error {
+	rows := make([]*eventRow, 0, len(evs))
+	for _, ev := range evs {
+		var data string
+		if len(ev.Data) > 0 {
+			b, err := json.Marshal(ev.Data)
+			if err != nil {
+				return xerrors.Errorf("marshal data: %w", err)
+			}
+			data = string(b)
+		}
+		rows = append(rows, &eventRow{
+			Type:     ev.Type,
+			Datetime: ev.Time,
+			AppId:    ev.AppId,
+			RoomId:   ev.RoomId,
+			HostId:   ev.HostId,
+			ClientId: ev.ClientId,
+			Data:     data,
+		})
+	}
+
+	defer metrics.DBQueryLatency.With("room_event_insert").ObserveSince(time.Now())
+	if _, err := s.db.NamedExecContext(ctx, insertEventQuery, rows); err != nil {
+		return xerrors.Errorf("insert room_event: %w", err)
+	}
+	return nil
+}
+
+func (s *DBSink) Close() error {
+	return nil
+}
+
+// WebhookSink : JSON配列をHTTP POSTする.
+// 通信エラーと5xx, 429のレスポンスはリトライする.
+type WebhookSink struct {
+	url    string
+	retry  int
+	client *http.Client
+
+	// RetryInterval : リトライ間隔. 回数に比例して延ばす
+	RetryInterval time.Duration
+}
+
+func NewWebhookSink(url string, retry int) *WebhookSink {
+	return &WebhookSink{
+		url:           url,
+		retry:         retry,
+		client:        &http.Client{Timeout: 10 * time.Second},
+		RetryInterval: time.Second,
+	}
+}
+
+func (s *WebhookSink) Write(ctx context.Context, evs []*Event) error {
+	body, err := json.Marshal(evs)
+	if err != nil {
+		return xerrors.Errorf("marshal: %w", err)
+	}
+
+	for i := 0; ; i++ {
+		retryable, err := s.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retryable || i >= s.retry {
+			return xerrors.Errorf("webhook (tried %v times): %w", i+1, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.RetryInterval * time.Duration(i+1)):
+		}
+	}
+}
+
+func (s *WebhookSink) post(ctx context.Context, body []byte) (retryable bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, xerrors.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return true, xerrors.Errorf("post: %w", err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode >= 300 {
+		retryable = res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests
+		return retryable, xerrors.Errorf("status: %v", res.Status)
+	}
+	return false, nil
+}
+
+func (s *WebhookSink) Close() error {
+	return nil
+}
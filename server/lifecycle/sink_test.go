@@ -0,0 +1,113 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"wsnet2/log"
+)
+
+type receiver struct {
+	mu      sync.Mutex
+	fails   int
+	batches [][]*Event
+	calls   int
+}
+
+func (rv *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	rv.calls++
+	if rv.fails > 0 {
+		rv.fails--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var evs []*Event
+	if err := json.NewDecoder(r.Body).Decode(&evs); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rv.batches = append(rv.batches, evs)
+}
+
+func TestWebhookSinkRetry(t *testing.T) {
+	rv := &receiver{fails: 2}
+	sv := httptest.NewServer(rv)
+	defer sv.Close()
+
+	s := NewWebhookSink(sv.URL, 3)
+	s.RetryInterval = time.Millisecond
+
+	evs := []*Event{{Type: RoomCreated, RoomId: "room1", ClientId: "user1"}}
+	if err := s.Write(context.Background(), evs); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if rv.calls != 3 {
+		t.Errorf("calls = %v, wants 3", rv.calls)
+	}
+	if len(rv.batches) != 1 || rv.batches[0][0].RoomId != "room1" {
+		t.Errorf("batches = %v", rv.batches)
+	}
+
+	rv.fails = 10
+	rv.calls = 0
+	if err := s.Write(context.Background(), evs); err == nil {
+		t.Errorf("Write wants error")
+	}
+	if rv.calls != 4 {
+		t.Errorf("calls = %v, wants 4", rv.calls)
+	}
+}
+
+func TestEmitterBatch(t *testing.T) {
+	rv := &receiver{}
+	sv := httptest.NewServer(rv)
+	defer sv.Close()
+
+	e := NewEmitter([]Sink{NewWebhookSink(sv.URL, 0)}, 2, time.Hour)
+	for _, id := range []string{"user1", "user2", "user3"} {
+		e.Emit(&Event{Type: PlayerJoined, RoomId: "room1", ClientId: id})
+	}
+	e.Close() // 残りの1件もCloseで出力される
+
+	if len(rv.batches) != 2 {
+		t.Fatalf("batches = %v, wants 2", len(rv.batches))
+	}
+	if len(rv.batches[0]) != 2 || len(rv.batches[1]) != 1 {
+		t.Errorf("batch sizes = %v, %v", len(rv.batches[0]), len(rv.batches[1]))
+	}
+	if rv.batches[1][0].ClientId != "user3" {
+		t.Errorf("last event = %+v", rv.batches[1][0])
+	}
+}
+
+func TestEmitterCloseTimeout(t *testing.T) {
+	rv := &receiver{fails: 100}
+	sv := httptest.NewServer(rv)
+	defer sv.Close()
+
+	defer log.SetLevel(log.SetLevel(log.NOLOG))
+	orig := closeTimeout
+	closeTimeout = 100 * time.Millisecond
+	defer func() { closeTimeout = orig }()
+
+	s := NewWebhookSink(sv.URL, 10)
+	s.RetryInterval = time.Second
+	e := NewEmitter([]Sink{s}, 10, time.Hour)
+	e.Emit(&Event{Type: PlayerJoined, RoomId: "room1", ClientId: "user1"})
+
+	start := time.Now()
+	e.Close() // リトライ中でもcloseTimeoutで打ち切られる
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Close took %v", d)
+	}
+
+	e.Emit(&Event{Type: PlayerLeft, RoomId: "room1", ClientId: "user1"}) // Close後のEmitはpanicしない
+	e.Close()
+}
@@ -0,0 +1,303 @@
+package lobby
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"golang.org/x/xerrors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"wsnet2/common"
+	"wsnet2/log"
+	"wsnet2/pb"
+)
+
+const adminRoomsLimit = 1000
+
+// AdminKick : targetIDのclientをkickする.
+// roomIdが空なら全game serverの全部屋から非同期でkickする.
+func (rs *RoomService) AdminKick(ctx context.Context, appId, roomId, targetID string, logger log.Logger) error {
+	if _, found := rs.apps[appId]; !found {
+		return xerrors.Errorf("Unknown appId: %v", appId)
+	}
+
+	if roomId == "" {
+		go rs.adminKick(appId, targetID, logger)
+		return nil
+	}
+
+	client, err := rs.adminGameClient(ctx, appId, roomId)
+	if err != nil {
+		return err
+	}
+	req := &pb.KickReq{
+		AppId:    appId,
+		RoomId:   roomId,
+		ClientId: targetID,
+	}
+	if _, err := client.Kick(ctx, req); err != nil {
+		return adminGRPCError("gRPC Kick", err)
+	}
+	return nil
+}
+
+func (rs *RoomService) adminKick(appID, targetID string, logger log.Logger) {
+	allGameServers, err := rs.gameCache.All()
+	if err != nil {
+		logger.Errorf("adminKick: get all game servers: %+v", err)
+		return
+	}
+
+	for _, game := range allGameServers {
+		client, err := rs.newGameClient(game.Hostname, game.GRPCPort)
+		if err != nil {
+			logger.Errorf("adminKick: newGameClient: %+v", err)
+			continue
+		}
+
+		req := &pb.KickReq{
+			AppId:    appID,
+			RoomId:   "",
+			ClientId: targetID,
+		}
+		_, err = client.Kick(context.Background(), req)
+		if err != nil {
+			logger.Errorf("adminKick: app=%q target=%q host=%q err=%+v", appID, targetID, game.Hostname, err)
+			continue
+		}
+	}
+
+}
+
+// AdminClose : 部屋を強制終了する
+func (rs *RoomService) AdminClose(ctx context.Context, appId, roomId, reason string) error {
+	if _, found := rs.apps[appId]; !found {
+		return xerrors.Errorf("Unknown appId: %v", appId)
+	}
+
+	client, err := rs.adminGameClient(ctx, appId, roomId)
+	if err != nil {
+		return err
+	}
+	req := &pb.CloseReq{
+		AppId:  appId,
+		RoomId: roomId,
+		Reason: reason,
+	}
+	if _, err := client.Close(ctx, req); err != nil {
+		return adminGRPCError("gRPC Close", err)
+	}
+	return nil
+}
+
+// AdminNotice : 部屋にお知らせを送る.
+// roomIdが空なら全game serverのappの全ての部屋に送る.
+func (rs *RoomService) AdminNotice(ctx context.Context, appId, roomId, message string, logger log.Logger) error {
+	if _, found := rs.apps[appId]; !found {
+		return xerrors.Errorf("Unknown appId: %v", appId)
+	}
+
+	req := &pb.NoticeReq{
+		AppId:   appId,
+		RoomId:  roomId,
+		Message: message,
+	}
+
+	if roomId != "" {
+		client, err := rs.adminGameClient(ctx, appId, roomId)
+		if err != nil {
+			return err
+		}
+		if _, err := client.Notice(ctx, req); err != nil {
+			return adminGRPCError("gRPC Notice", err)
+		}
+		return nil
+	}
+
+	allGameServers, err := rs.gameCache.All()
+	if err != nil {
+		return xerrors.Errorf("get all game servers: %w", err)
+	}
+	for _, game := range allGameServers {
+		client, err := rs.newGameClient(game.Hostname, game.GRPCPort)
+		if err != nil {
+			logger.Errorf("AdminNotice: newGameClient: %+v", err)
+			continue
+		}
+		if _, err := client.Notice(ctx, req); err != nil {
+			logger.Errorf("AdminNotice: app=%q host=%q err=%+v", appId, game.Hostname, err)
+		}
+	}
+	return nil
+}
+
+// AdminDrain : game/hub serverのdrain状態を切り替える.
+// drain中のサーバーには新しい部屋や観戦hubが割り当てられないが、既存の部屋はそのまま継続する.
+func (rs *RoomService) AdminDrain(ctx context.Context, hostType string, hostId uint32, drain bool) error {
+	var table string
+	switch hostType {
+	case "game":
+		table = "game_server"
+	case "hub":
+		table = "hub_server"
+	default:
+		return WithType(xerrors.Errorf("unknown host type: %q", hostType), ErrArgument)
+	}
+
+	from, to := common.HostStatusRunning, common.HostStatusDraining
+	if !drain {
+		from, to = to, from
+	}
+
+	query := fmt.Sprintf("UPDATE `%s` SET `status`=? WHERE `id`=? AND `status`=?", table)
+	res, err := rs.db.ExecContext(ctx, query, to, hostId, from)
+	if err != nil {
+		return xerrors.Errorf("update %s: %w", table, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return xerrors.Errorf("rows affected: %w", err)
+	}
+	if n == 0 {
+		return WithType(
+			xerrors.Errorf("%s server %v is not found or not in status %v", hostType, hostId, from),
+			ErrArgument)
+	}
+	return nil
+}
+
+// AdminMaintenance : appのメンテナンス期間を設定する.
+// endが0なら設定を削除する.
+func (rs *RoomService) AdminMaintenance(ctx context.Context, appId string, start, end time.Time, message string) error {
+	if _, found := rs.apps[appId]; !found {
+		return xerrors.Errorf("Unknown appId: %v", appId)
+	}
+
+	if end.IsZero() {
+		if _, err := rs.db.ExecContext(ctx, "DELETE FROM maintenance WHERE app_id = ?", appId); err != nil {
+			return xerrors.Errorf("delete maintenance: %w", err)
+		}
+		return nil
+	}
+
+	if !start.Before(end) {
+		return WithType(xerrors.Errorf("invalid maintenance window: %v - %v", start, end), ErrArgument)
+	}
+
+	const q = "INSERT INTO maintenance (`app_id`, `start_at`, `end_at`, `message`) VALUES (?, ?, ?, ?) " +
+		"ON DUPLICATE KEY UPDATE `start_at`=VALUES(`start_at`), `end_at`=VALUES(`end_at`), `message`=VALUES(`message`)"
+	if _, err := rs.db.ExecContext(ctx, q, appId, start, end, message); err != nil {
+		return xerrors.Errorf("insert maintenance: %w", err)
+	}
+	return nil
+}
+
+// AdminRooms : 部屋一覧 (非公開の部屋も含む)
+func (rs *RoomService) AdminRooms(ctx context.Context, appId string, searchGroup uint32, limit int) ([]*pb.RoomInfo, error) {
+	if _, found := rs.apps[appId]; !found {
+		return nil, xerrors.Errorf("Unknown appId: %v", appId)
+	}
+	if limit <= 0 || limit > adminRoomsLimit {
+		limit = adminRoomsLimit
+	}
+
+	query := "SELECT * FROM room WHERE app_id = ? ORDER BY created LIMIT ?"
+	args := []any{appId, limit}
+	if searchGroup != 0 {
+		query = "SELECT * FROM room WHERE app_id = ? AND search_group = ? ORDER BY created LIMIT ?"
+		args = []any{appId, searchGroup, limit}
+	}
+
+	rooms := []*pb.RoomInfo{}
+	if err := rs.db.SelectContext(ctx, &rooms, query, args...); err != nil {
+		return nil, xerrors.Errorf("select rooms: %w", err)
+	}
+	return rooms, nil
+}
+
+// AdminRoomInfo : game serverから部屋の詳細を取得する
+func (rs *RoomService) AdminRoomInfo(ctx context.Context, appId, roomId string) (*pb.GetRoomInfoRes, error) {
+	if _, found := rs.apps[appId]; !found {
+		return nil, xerrors.Errorf("Unknown appId: %v", appId)
+	}
+
+	client, err := rs.adminGameClient(ctx, appId, roomId)
+	if err != nil {
+		return nil, err
+	}
+	req := &pb.GetRoomInfoReq{
+		AppId:  appId,
+		RoomId: roomId,
+	}
+	res, err := client.GetRoomInfo(ctx, req)
+	if err != nil {
+		return nil, adminGRPCError("gRPC GetRoomInfo", err)
+	}
+	return res, nil
+}
+
+// adminGameClient : 部屋のあるgame serverのクライアント
+func (rs *RoomService) adminGameClient(ctx context.Context, appId, roomId string) (pb.GameClient, error) {
+	var hostId uint32
+	err := rs.db.GetContext(ctx, &hostId, "SELECT host_id FROM room WHERE app_id = ? AND id = ?", appId, roomId)
+	if err != nil {
+		return nil, WithType(
+			xerrors.Errorf("select room (id=%v): %w", roomId, err),
+			ErrNoJoinableRoom)
+	}
+
+	game, err := rs.gameCache.Get(hostId)
+	if err != nil {
+		return nil, xerrors.Errorf("get game server(%v): %w", hostId, err)
+	}
+
+	return rs.newGameClient(game.Hostname, game.GRPCPort)
+}
+
+func adminGRPCError(msg string, err error) error {
+	st, ok := status.FromError(err)
+	err = xerrors.Errorf("%s: %w", msg, err)
+	if ok && st.Code() == codes.NotFound {
+		err = WithType(err, ErrNoJoinableRoom)
+	}
+	return err
+}
+
+// AdminLog : 管理APIの監査ログをDBに記録する
+func (rs *RoomService) AdminLog(subject, appId, action string, param any, remoteAddr string, result error, logger log.Logger) {
+	const q = "INSERT INTO admin_log (`subject`, `app_id`, `action`, `param`, `remote_addr`, `result`, `datetime`) " +
+		"VALUES (:subject, :app_id, :action, :param, :remote_addr, :result, :datetime)"
+
+	p, err := json.Marshal(param)
+	if err != nil {
+		logger.Errorf("AdminLog: marshal param: %+v", err)
+	}
+	res := "ok"
+	if result != nil {
+		res = result.Error()
+		if len(res) > 191 {
+			res = res[:191]
+		}
+	}
+
+	args := map[string]any{
+		"subject":     subject,
+		"app_id":      appId,
+		"action":      action,
+		"param":       string(p),
+		"remote_addr": remoteAddr,
+		"result":      res,
+		"datetime":    time.Now(),
+	}
+
+	logger.Infof("admin audit: subject=%q app=%q action=%q param=%s result=%q", subject, appId, action, p, res)
+
+	go func() {
+		if _, err := rs.db.NamedExec(q, args); err != nil {
+			logger.Errorf("AdminLog: insert admin_log: %+v", err)
+		}
+	}()
+}
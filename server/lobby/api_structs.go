@@ -10,6 +10,7 @@ type CreateParam struct {
 	RoomOption *pb.RoomOption `json:"room"`
 	ClientInfo *pb.ClientInfo `json:"client"`
 	EncMACKey  string         `json:"emk"`
+	Regions    []string       `json:"regions"` // 部屋を作成したい地域 (優先順). 省略可
 }
 
 type JoinParam struct {
@@ -18,6 +19,11 @@ type JoinParam struct {
 	EncMACKey  string         `json:"emk"`
 }
 
+type RejoinParam struct {
+	Queries   []PropQueries `json:"query"`
+	EncMACKey string        `json:"emk"`
+}
+
 type SearchParam struct {
 	SearchGroup    uint32        `json:"group"`
 	Queries        []PropQueries `json:"query"`
@@ -42,6 +48,55 @@ type SearchCurrentRoomsParam struct {
 
 type AdminKickParam struct {
 	TargetID string `json:"target_id"`
+	RoomID   string `json:"room_id,omitempty"`
+}
+
+type AdminRoomsParam struct {
+	SearchGroup uint32 `json:"search_group,omitempty"`
+	Limit       int    `json:"limit,omitempty"`
+}
+
+type AdminRoomParam struct {
+	RoomID string `json:"room_id"`
+}
+
+type AdminCloseParam struct {
+	RoomID string `json:"room_id"`
+	Reason string `json:"reason"`
+}
+
+type AdminNoticeParam struct {
+	RoomID  string `json:"room_id,omitempty"`
+	Message string `json:"message"`
+}
+
+type AdminDrainParam struct {
+	Type   string `json:"type"` // "game" or "hub"
+	HostID uint32 `json:"host_id"`
+	Drain  bool   `json:"drain"`
+}
+
+type AdminMaintenanceParam struct {
+	StartAt int64  `json:"start_at"` // unix time
+	EndAt   int64  `json:"end_at"`   // unix time. 0ならメンテナンス予定を削除
+	Message string `json:"message,omitempty"`
+}
+
+type AdminTokenParam struct {
+	UserID string `json:"user_id"`
+	TTL    int64  `json:"ttl,omitempty"` // 秒. 0ならtoken_ttl
+}
+
+type AdminRevokeParam struct {
+	UserID string `json:"user_id"`
+}
+
+// AdminResponse : 管理APIのレスポンス (JSON)
+type AdminResponse struct {
+	Msg   string             `json:"msg"`
+	Rooms []*pb.RoomInfo     `json:"rooms,omitempty"`
+	Room  *pb.GetRoomInfoRes `json:"room,omitempty"`
+	Token *AccessToken       `json:"token,omitempty"`
 }
 
 type Response struct {
@@ -58,6 +113,8 @@ const (
 	ResponseTypeRoomLimit
 	ResponseTypeNoRoomFound
 	ResponseTypeRoomFull
+	ResponseTypeQuotaExceeded
+	ResponseTypeMaintenance
 )
 
 func (r ResponseType) String() string {
@@ -70,6 +127,10 @@ func (r ResponseType) String() string {
 		return "NoRoomFound"
 	case ResponseTypeRoomFull:
 		return "RoomFull"
+	case ResponseTypeQuotaExceeded:
+		return "QuotaExceeded"
+	case ResponseTypeMaintenance:
+		return "Maintenance"
 	default:
 		return fmt.Sprintf("UnknownType(%v)", byte(r))
 	}
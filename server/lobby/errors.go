@@ -16,6 +16,8 @@ const (
 	ErrAlreadyJoined
 	ErrNoWatchableRoom
 	ErrAuthDataExpired
+	ErrQuotaExceeded
+	ErrMaintenance
 )
 
 // ErrorWithErrType : ErrTypeとerrorの組
@@ -57,6 +59,10 @@ func (e *errorWithType) Message() string {
 		return "No watchable room found"
 	case ErrAuthDataExpired:
 		return "AuthData expired"
+	case ErrQuotaExceeded:
+		return "Reached to the app quota"
+	case ErrMaintenance:
+		return "Under maintenance"
 	}
 	return ""
 }
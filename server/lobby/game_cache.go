@@ -2,6 +2,7 @@ package lobby
 
 import (
 	"math/rand/v2"
+	"slices"
 	"sync"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 
 	"wsnet2/common"
 	"wsnet2/log"
+	"wsnet2/metrics"
 )
 
 type hostInfo struct {
@@ -18,11 +20,41 @@ type hostInfo struct {
 	PublicName    string `db:"public_name"`
 	GRPCPort      int    `db:"grpc_port"`
 	WebSocketPort int    `db:"ws_port"`
+	Region        string `db:"region"`
+}
+
+// inRegion : regionが空ならどのサーバも一致する
+func (h *hostInfo) inRegion(region string) bool {
+	return region == "" || h.Region == region
+}
+
+// hostLoad : heartbeatで報告されるGame/Hubの負荷
+type hostLoad struct {
+	Rooms      int
+	Watchers   int
+	Goroutines int
+	MsgBacklog int `db:"msg_backlog"`
+}
+
+// overloadLimit : 新しい部屋を割り当てない負荷の閾値. 0なら制限しない
+type overloadLimit struct {
+	goroutines int
+	msgBacklog int
+	// fallback : 全てのサーバが閾値を超えているときは閾値を無視して選ぶ
+	fallback bool
+}
+
+func (l overloadLimit) exceeded(h *hostLoad) bool {
+	return (l.goroutines > 0 && h.Goroutines > l.goroutines) ||
+		(l.msgBacklog > 0 && h.MsgBacklog > l.msgBacklog)
 }
 
 type gameServer struct {
 	hostInfo
-	Status int32
+	hostLoad
+	Status   int32
+	Clients  int
+	Capacity float64 // 空き容量 (0:満杯 - 1:空)
 }
 
 type gameCache struct {
@@ -30,28 +62,33 @@ type gameCache struct {
 	db     *sqlx.DB
 	expire time.Duration
 	valid  time.Duration
+	limit  overloadLimit
 
 	servers     map[uint32]*gameServer
 	order       []uint32
 	lastUpdated time.Time
 }
 
-func newGameCache(db *sqlx.DB, expire time.Duration, valid time.Duration) *gameCache {
+func newGameCache(db *sqlx.DB, expire time.Duration, valid time.Duration, limit overloadLimit) *gameCache {
 	return &gameCache{
 		db:      db,
 		expire:  expire,
 		valid:   valid,
+		limit:   limit,
 		servers: make(map[uint32]*gameServer),
 		order:   []uint32{},
 	}
 }
 
 func (c *gameCache) updateInner() error {
-	// 再入室のために、graceful shutdown中のサーバー(status == closing == 2)の情報も取得する.
-	query := ("SELECT id, hostname, public_name, grpc_port, ws_port, status\n" +
-		"FROM game_server WHERE status IN (1, 2) AND heartbeat >= ?")
+	// 再入室のために、graceful shutdown中のサーバー(status == closing == 2)や
+	// drain中のサーバー(status == draining == 3)の情報も取得する.
+	query := ("SELECT id, hostname, public_name, grpc_port, ws_port, region, status,\n" +
+		"  rooms, clients, capacity, watchers, goroutines, msg_backlog\n" +
+		"FROM game_server WHERE status IN (1, 2, 3) AND heartbeat >= ?")
 
 	var servers []gameServer
+	defer metrics.DBQueryLatency.With("game_server_select").ObserveSince(time.Now())
 	err := c.db.Select(&servers, query, time.Now().Add(-c.valid).Unix())
 	if err != nil {
 		return xerrors.Errorf("selecting game servers: %w", err)
@@ -64,7 +101,7 @@ func (c *gameCache) updateInner() error {
 	for i := range servers {
 		s := &servers[i]
 		c.servers[s.Id] = s
-		// Rand() がgraceful shutdown中のサーバーを返さないために、
+		// Rand() がgraceful shutdown中やdrain中のサーバーを返さないために、
 		// status=running のサーバーのみ order に追加する.
 		if s.Status == common.HostStatusRunning {
 			c.order = append(c.order, s.Id)
@@ -98,7 +135,12 @@ func (c *gameCache) Get(id uint32) (*gameServer, error) {
 	return game, nil
 }
 
-func (c *gameCache) Rand() (*gameServer, error) {
+// Select : 部屋を作成するサーバを選ぶ.
+// regionsの順に、その地域で空きのあるサーバがあればそこから選ぶ.
+// どの地域にも空きが無ければ全てのサーバから選ぶ.
+// 負荷が閾値を超えたサーバは選ばない. 全てのサーバが超えていればエラーとするが、
+// limit.fallbackなら全てのサーバから選ぶ.
+func (c *gameCache) Select(regions []string) (*gameServer, error) {
 	c.Lock()
 	defer c.Unlock()
 	if err := c.update(); err != nil {
@@ -108,8 +150,50 @@ func (c *gameCache) Rand() (*gameServer, error) {
 	if len(c.order) == 0 {
 		return nil, xerrors.New("no available game server")
 	}
-	id := c.order[rand.IntN(len(c.order))]
-	return c.servers[id], nil
+	servers := make([]*gameServer, 0, len(c.order))
+	for _, id := range c.order {
+		if s := c.servers[id]; !c.limit.exceeded(&s.hostLoad) {
+			servers = append(servers, s)
+		}
+	}
+	if len(servers) == 0 {
+		if !c.limit.fallback {
+			return nil, xerrors.New("all game servers are overloaded")
+		}
+		for _, id := range c.order {
+			servers = append(servers, c.servers[id])
+		}
+	}
+	return selectGame(servers, regions), nil
+}
+
+// selectGame : 希望する地域の順に、空きのあるサーバを空き容量に比例した確率で選ぶ.
+// 常に最も空いているサーバを選ぶと、キャッシュが更新されるまでの間
+// 起動したばかりのサーバなどに作成が集中してしまうため、確率的に振り分ける.
+func selectGame(servers []*gameServer, regions []string) *gameServer {
+	for _, region := range slices.Concat(regions, []string{""}) {
+		var total float64
+		var cands []*gameServer
+		for _, s := range servers {
+			if s.inRegion(region) && s.Capacity > 0 {
+				cands = append(cands, s)
+				total += s.Capacity
+			}
+		}
+		if len(cands) == 0 {
+			continue
+		}
+		r := rand.Float64() * total
+		for _, s := range cands {
+			if r -= s.Capacity; r < 0 {
+				return s
+			}
+		}
+		return cands[len(cands)-1]
+	}
+
+	// 全て満杯(またはcapacity未報告)なら無作為に選ぶ
+	return servers[rand.IntN(len(servers))]
 }
 
 func (c *gameCache) All() ([]*gameServer, error) {
@@ -1,6 +1,7 @@
 package lobby
 
 import (
+	"slices"
 	"testing"
 	"time"
 )
@@ -19,8 +20,15 @@ func TestGameCache(t *testing.T) {
 			"  `public_name` VARCHAR(191) NOT NULL,\n" +
 			"  `grpc_port`   INTEGER NOT NULL,\n" +
 			"  `ws_port`     INTEGER NOT NULL,\n" +
+			"  `region`      VARCHAR(191) NOT NULL DEFAULT '',\n" +
 			"  `status`      TINYINT NOT NULL,\n" +
 			"  `heartbeat`   BIGINT,\n" +
+			"  `rooms`       INTEGER UNSIGNED NOT NULL DEFAULT 0,\n" +
+			"  `clients`     INTEGER UNSIGNED NOT NULL DEFAULT 0,\n" +
+			"  `capacity`    DOUBLE NOT NULL DEFAULT 0,\n" +
+			"  `watchers`    INTEGER UNSIGNED NOT NULL DEFAULT 0,\n" +
+			"  `goroutines`  INTEGER UNSIGNED NOT NULL DEFAULT 0,\n" +
+			"  `msg_backlog` INTEGER UNSIGNED NOT NULL DEFAULT 0,\n" +
 			"  UNIQUE KEY `idx_hostname` (`hostname`)\n" +
 			") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")
 
@@ -31,16 +39,18 @@ func TestGameCache(t *testing.T) {
 		(1, "host1", "global1", 1001, 1002, 0, ?),
 		(2, "host2", "global2", 2001, 2002, 1, ?),
 		(3, "host3", "global3", 3001, 3002, 2, ?),
-		(4, "host4", "global4", 4001, 4002, 1, ?)`,
-		nowUnix, nowUnix, nowUnix, nowUnix-100)
+		(4, "host4", "global4", 4001, 4002, 1, ?),
+		(5, "host5", "global5", 5001, 5002, 3, ?)`,
+		nowUnix, nowUnix, nowUnix, nowUnix-100, nowUnix)
 	// host1 - not ready
 	// host2 - ready
 	// host3 - shutting down
 	// host4 - expired
+	// host5 - draining
 	// randではhost2のみが選択される
-	// Getではhost3も取得可能
+	// Getではhost3とhost5も取得可能
 
-	hc := newGameCache(lobbyDB, time.Second, time.Second*10)
+	hc := newGameCache(lobbyDB, time.Second, time.Second*10, overloadLimit{})
 	err := hc.update()
 	if err != nil {
 		t.Fatal(err)
@@ -48,15 +58,15 @@ func TestGameCache(t *testing.T) {
 	if hc.lastUpdated.Before(now) {
 		t.Errorf("lastUpdated is not updated: now=%v lastUpdated=%v", now, hc.lastUpdated)
 	}
-	if len(hc.servers) != 2 {
-		t.Errorf("len(servers) is not 2: %v", hc.servers)
+	if len(hc.servers) != 3 {
+		t.Errorf("len(servers) is not 3: %v", hc.servers)
 	}
 	if len(hc.order) != 1 {
 		t.Errorf("len(order) is not 1: %v", hc.order)
 	}
-	host, err := hc.Rand()
+	host, err := hc.Select(nil)
 	if err != nil {
-		t.Fatalf("hc.Rand(): %v", err)
+		t.Fatalf("hc.Select(nil): %v", err)
 	}
 	if host == nil {
 		t.Fatalf("host is nil")
@@ -79,4 +89,93 @@ func TestGameCache(t *testing.T) {
 	if host3 == nil {
 		t.Fatalf("host3 is nil")
 	}
+
+	host5, err := hc.Get(5)
+	if err != nil {
+		t.Fatalf("hc.Get(5): %v", err)
+	}
+	if host5 == nil {
+		t.Fatalf("host5 is nil")
+	}
+}
+
+func TestSelectGame(t *testing.T) {
+	newServer := func(id uint32, region string, capacity float64) *gameServer {
+		return &gameServer{hostInfo: hostInfo{Id: id, Region: region}, Capacity: capacity}
+	}
+	servers := []*gameServer{
+		newServer(1, "tokyo", 0),
+		newServer(2, "tokyo", 0.5),
+		newServer(3, "osaka", 0.8),
+		newServer(4, "seoul", 0),
+	}
+
+	tests := map[string]struct {
+		regions []string
+		wants   []uint32
+	}{
+		"preferred":       {[]string{"tokyo", "osaka"}, []uint32{2}},
+		"second region":   {[]string{"seoul", "osaka"}, []uint32{3}},
+		"unknown region":  {[]string{"london"}, []uint32{2, 3}},
+		"no region":       {nil, []uint32{2, 3}},
+		"skip full hosts": {[]string{"seoul"}, []uint32{2, 3}},
+	}
+	for name, test := range tests {
+		for range 20 {
+			s := selectGame(servers, test.regions)
+			if !slices.Contains(test.wants, s.Id) {
+				t.Errorf("%v: selected %v, wants %v", name, s.Id, test.wants)
+				break
+			}
+		}
+	}
+
+	// 全て満杯なら無作為に選ぶ
+	full := []*gameServer{servers[0], servers[3]}
+	if s := selectGame(full, []string{"tokyo"}); s == nil {
+		t.Errorf("no server selected")
+	}
+}
+
+func TestOverloadLimit(t *testing.T) {
+	limit := overloadLimit{goroutines: 1000, msgBacklog: 5}
+	tests := map[string]struct {
+		load  hostLoad
+		wants bool
+	}{
+		"normal":     {hostLoad{Goroutines: 1000, MsgBacklog: 5}, false},
+		"goroutines": {hostLoad{Goroutines: 1001}, true},
+		"backlog":    {hostLoad{MsgBacklog: 6}, true},
+	}
+	for name, test := range tests {
+		if got := limit.exceeded(&test.load); got != test.wants {
+			t.Errorf("%v: exceeded = %v, wants %v", name, got, test.wants)
+		}
+	}
+	if (overloadLimit{}).exceeded(&hostLoad{Goroutines: 100000, MsgBacklog: 100}) {
+		t.Errorf("zero limit must not be exceeded")
+	}
+}
+
+func TestGameCacheSelectOverloaded(t *testing.T) {
+	newCache := func(fallback bool) *gameCache {
+		gc := newGameCache(nil, time.Hour, time.Hour, overloadLimit{goroutines: 1000, fallback: fallback})
+		gc.servers = map[uint32]*gameServer{
+			1: {hostInfo: hostInfo{Id: 1}, hostLoad: hostLoad{Goroutines: 2000}, Capacity: 1},
+		}
+		gc.order = []uint32{1}
+		gc.lastUpdated = time.Now()
+		return gc
+	}
+
+	if s, err := newCache(false).Select(nil); err == nil {
+		t.Fatalf("overloaded server selected: %v", s.Id)
+	}
+	s, err := newCache(true).Select(nil)
+	if err != nil {
+		t.Fatalf("Select with fallback: %v", err)
+	}
+	if s.Id != 1 {
+		t.Fatalf("server = %v, wants 1", s.Id)
+	}
 }
@@ -8,36 +8,48 @@ import (
 	"github.com/jmoiron/sqlx"
 	"golang.org/x/xerrors"
 
+	"wsnet2/common"
 	"wsnet2/log"
+	"wsnet2/metrics"
 )
 
-type hubServer hostInfo
+type hubServer struct {
+	hostInfo
+	hostLoad // Roomsは中継している部屋の数
+	Status   int32
+}
 
 type hubCache struct {
 	sync.Mutex
 	db     *sqlx.DB
 	expire time.Duration
 	valid  time.Duration
+	limit  overloadLimit
 
 	servers     map[uint32]*hubServer
 	order       []uint32
 	lastUpdated time.Time
 }
 
-func newHubCache(db *sqlx.DB, expire time.Duration, valid time.Duration) *hubCache {
+func newHubCache(db *sqlx.DB, expire time.Duration, valid time.Duration, limit overloadLimit) *hubCache {
 	return &hubCache{
 		db:      db,
 		expire:  expire,
 		valid:   valid,
+		limit:   limit,
 		servers: make(map[uint32]*hubServer),
 		order:   []uint32{},
 	}
 }
 
 func (c *hubCache) updateInner() error {
-	query := "SELECT id, hostname, public_name, grpc_port, ws_port FROM hub_server WHERE status=1 AND heartbeat >= ?"
+	// 既存の観戦hubに相乗りするために、drain中のサーバー(status == draining == 3)の情報も取得する.
+	query := ("SELECT id, hostname, public_name, grpc_port, ws_port, region, status,\n" +
+		"  rooms, watchers, goroutines, msg_backlog\n" +
+		"FROM hub_server WHERE status IN (1, 3) AND heartbeat >= ?")
 
 	var servers []hubServer
+	defer metrics.DBQueryLatency.With("hub_server_select").ObserveSince(time.Now())
 	err := c.db.Select(&servers, query, time.Now().Add(-c.valid).Unix())
 	if err != nil {
 		return xerrors.Errorf("selecting hub servers: %w", err)
@@ -46,10 +58,15 @@ func (c *hubCache) updateInner() error {
 	log.Debugf("Now alive hub servers: %+v", servers)
 
 	c.servers = make(map[uint32]*hubServer, len(servers))
-	c.order = make([]uint32, len(servers))
-	for i, s := range servers {
-		c.servers[s.Id] = &servers[i]
-		c.order[i] = s.Id
+	c.order = make([]uint32, 0, len(servers))
+	for i := range servers {
+		s := &servers[i]
+		c.servers[s.Id] = s
+		// Select() がdrain中のサーバーを返さないために、
+		// status=running のサーバーのみ order に追加する.
+		if s.Status == common.HostStatusRunning {
+			c.order = append(c.order, s.Id)
+		}
 	}
 	c.lastUpdated = time.Now()
 	return nil
@@ -79,7 +96,10 @@ func (c *hubCache) Get(id uint32) (*hubServer, error) {
 	return hub, nil
 }
 
-func (c *hubCache) Rand() (*hubServer, error) {
+// Select : regionのHubのうち観戦者の最も少ないものを選ぶ. regionのHubが無ければ全てのHubから選ぶ.
+// 負荷が閾値を超えたHubは選ばない. 全てのHubが超えていればエラーとするが、
+// limit.fallbackなら全てのHubから選ぶ.
+func (c *hubCache) Select(region string) (*hubServer, error) {
 	c.Lock()
 	defer c.Unlock()
 	if err := c.update(); err != nil {
@@ -89,6 +109,46 @@ func (c *hubCache) Rand() (*hubServer, error) {
 	if len(c.order) == 0 {
 		return nil, xerrors.New("no available hub server")
 	}
-	id := c.order[rand.IntN(len(c.order))]
-	return c.servers[id], nil
+	hubs := make([]*hubServer, 0, len(c.order))
+	for _, id := range c.order {
+		if h := c.servers[id]; !c.limit.exceeded(&h.hostLoad) {
+			hubs = append(hubs, h)
+		}
+	}
+	if len(hubs) == 0 {
+		if !c.limit.fallback {
+			return nil, xerrors.New("all hub servers are overloaded")
+		}
+		for _, id := range c.order {
+			hubs = append(hubs, c.servers[id])
+		}
+	}
+	return leastWatchers(hubs, region), nil
+}
+
+// leastWatchers : regionが一致するHubのうち観戦者の最も少ないものを返す.
+// 一致するHubが無ければ全てのHubから選ぶ. 同数なら無作為に選ぶ.
+func leastWatchers(hubs []*hubServer, region string) *hubServer {
+	var best *hubServer
+	ties := 0
+	for _, local := range []bool{true, false} {
+		for _, h := range hubs {
+			if local && !h.inRegion(region) {
+				continue
+			}
+			switch {
+			case best == nil || h.Watchers < best.Watchers:
+				best, ties = h, 1
+			case h.Watchers == best.Watchers:
+				ties++
+				if rand.IntN(ties) == 0 {
+					best = h
+				}
+			}
+		}
+		if best != nil {
+			break
+		}
+	}
+	return best
 }
@@ -19,8 +19,13 @@ func TestHubCache(t *testing.T) {
 			"  `public_name` VARCHAR(191) NOT NULL,\n" +
 			"  `grpc_port`   INTEGER NOT NULL,\n" +
 			"  `ws_port`     INTEGER NOT NULL,\n" +
+			"  `region`      VARCHAR(191) NOT NULL DEFAULT '',\n" +
 			"  `status`      TINYINT NOT NULL,\n" +
 			"  `heartbeat`   BIGINT,\n" +
+			"  `rooms`       INTEGER UNSIGNED NOT NULL DEFAULT 0,\n" +
+			"  `watchers`    INTEGER UNSIGNED NOT NULL DEFAULT 0,\n" +
+			"  `goroutines`  INTEGER UNSIGNED NOT NULL DEFAULT 0,\n" +
+			"  `msg_backlog` INTEGER UNSIGNED NOT NULL DEFAULT 0,\n" +
 			"  UNIQUE KEY `idx_hostname` (`hostname`)\n" +
 			") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")
 
@@ -31,15 +36,18 @@ func TestHubCache(t *testing.T) {
 		(1, "host1", "global1", 1001, 1002, 0, ?),
 		(2, "host2", "global2", 2001, 2002, 1, ?),
 		(3, "host3", "global3", 3001, 3002, 2, ?),
-		(4, "host4", "global4", 4001, 4002, 1, ?)`,
-		nowUnix, nowUnix, nowUnix, nowUnix-100)
+		(4, "host4", "global4", 4001, 4002, 1, ?),
+		(5, "host5", "global5", 5001, 5002, 3, ?)`,
+		nowUnix, nowUnix, nowUnix, nowUnix-100, nowUnix)
 	// host1 - not ready
 	// host2 - ready
 	// host3 - shutting down
 	// host4 - expired
-	// host2のみが選択される
+	// host5 - draining
+	// Selectではhost2のみが選択される
+	// Getではhost5も取得可能
 
-	hc := newHubCache(lobbyDB, time.Second, time.Second*10)
+	hc := newHubCache(lobbyDB, time.Second, time.Second*10, overloadLimit{})
 	err := hc.update()
 	if err != nil {
 		t.Fatal(err)
@@ -47,15 +55,15 @@ func TestHubCache(t *testing.T) {
 	if hc.lastUpdated.Before(now) {
 		t.Errorf("lastUpdated is not updated: now=%v lastUpdated=%v", now, hc.lastUpdated)
 	}
-	if len(hc.servers) != 1 {
-		t.Errorf("len(servers) is not 1: %v", hc.servers)
+	if len(hc.servers) != 2 {
+		t.Errorf("len(servers) is not 2: %v", hc.servers)
 	}
 	if len(hc.order) != 1 {
 		t.Errorf("len(order) is not 1: %v", hc.order)
 	}
-	host, err := hc.Rand()
+	host, err := hc.Select("")
 	if err != nil {
-		t.Fatalf("hc.Rand(): %v", err)
+		t.Fatalf("hc.Select(): %v", err)
 	}
 	if host == nil {
 		t.Fatalf("host is nil")
@@ -70,4 +78,40 @@ func TestHubCache(t *testing.T) {
 	if host != host2 {
 		t.Errorf("host != host2: %+v != %+v", host, host2)
 	}
+
+	host5, err := hc.Get(5)
+	if err != nil {
+		t.Fatalf("hc.Get(5): %v", err)
+	}
+	if host5 == nil {
+		t.Fatalf("host5 is nil")
+	}
+}
+
+func TestLeastWatchers(t *testing.T) {
+	newHub := func(id uint32, region string, watchers int) *hubServer {
+		return &hubServer{hostInfo: hostInfo{Id: id, Region: region}, hostLoad: hostLoad{Watchers: watchers}}
+	}
+	hubs := []*hubServer{
+		newHub(1, "tokyo", 30),
+		newHub(2, "tokyo", 10),
+		newHub(3, "osaka", 5),
+	}
+	tests := map[string]struct {
+		region string
+		wants  uint32
+	}{
+		"same region":  {"tokyo", 2},
+		"other region": {"osaka", 3},
+		"no region":    {"", 3},
+		"unknown":      {"sapporo", 3},
+	}
+	for name, tc := range tests {
+		if h := leastWatchers(hubs, tc.region); h.Id != tc.wants {
+			t.Errorf("%v: hub = %v, wants %v", name, h.Id, tc.wants)
+		}
+	}
+	if h := leastWatchers(nil, "tokyo"); h != nil {
+		t.Errorf("empty: hub = %v, wants nil", h.Id)
+	}
 }
@@ -0,0 +1,82 @@
+package lobby
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/xerrors"
+
+	"wsnet2/log"
+)
+
+// Maintenance : appのメンテナンス期間
+type Maintenance struct {
+	AppId   string    `db:"app_id" json:"app_id"`
+	StartAt time.Time `db:"start_at" json:"start_at"`
+	EndAt   time.Time `db:"end_at" json:"end_at"`
+	Message string    `db:"message" json:"message"`
+}
+
+// In : tがメンテナンス期間内か
+func (m *Maintenance) In(t time.Time) bool {
+	return !t.Before(m.StartAt) && t.Before(m.EndAt)
+}
+
+type maintenanceCache struct {
+	sync.Mutex
+	db     *sqlx.DB
+	expire time.Duration
+
+	windows     map[string]*Maintenance
+	lastUpdated time.Time
+}
+
+func newMaintenanceCache(db *sqlx.DB, expire time.Duration) *maintenanceCache {
+	return &maintenanceCache{
+		db:      db,
+		expire:  expire,
+		windows: make(map[string]*Maintenance),
+	}
+}
+
+func (c *maintenanceCache) updateInner() error {
+	query := "SELECT app_id, start_at, end_at, message FROM maintenance WHERE end_at > ?"
+
+	var windows []Maintenance
+	err := c.db.Select(&windows, query, time.Now())
+	if err != nil {
+		return xerrors.Errorf("selecting maintenance: %w", err)
+	}
+
+	log.Debugf("Now scheduled maintenance: %+v", windows)
+
+	c.windows = make(map[string]*Maintenance, len(windows))
+	for i := range windows {
+		c.windows[windows[i].AppId] = &windows[i]
+	}
+	c.lastUpdated = time.Now()
+	return nil
+}
+
+func (c *maintenanceCache) update() error {
+	if time.Since(c.lastUpdated) > c.expire {
+		return c.updateInner()
+	}
+	return nil
+}
+
+// Get : 現在メンテナンス中であればその期間を返す
+func (c *maintenanceCache) Get(appId string, now time.Time) (*Maintenance, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.update(); err != nil {
+		return nil, err
+	}
+
+	m := c.windows[appId]
+	if m == nil || !m.In(now) {
+		return nil, nil
+	}
+	return m, nil
+}
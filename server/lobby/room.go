@@ -20,6 +20,7 @@ import (
 	"wsnet2/config"
 	"wsnet2/log"
 	"wsnet2/pb"
+	"wsnet2/trace"
 )
 
 type RoomService struct {
@@ -31,23 +32,34 @@ type RoomService struct {
 	roomCache *RoomCache
 	gameCache *gameCache
 	hubCache  *hubCache
+
+	maintenance *maintenanceCache
+	revocation  *revocationCache
 }
 
 func NewRoomService(db *sqlx.DB, conf *config.LobbyConf) (*RoomService, error) {
-	query := "SELECT id, `key` FROM app"
+	query := "SELECT id, `key`, max_rooms, max_players, max_watchers, max_props_bytes, max_msg_rate, max_lifetime, idle_timeout, empty_grace FROM app"
 	var apps []*pb.App
 	err := db.Select(&apps, query)
 	if err != nil {
 		return nil, xerrors.Errorf("select apps: %w", err)
 	}
+	limit := overloadLimit{
+		goroutines: conf.OverloadGoroutines,
+		msgBacklog: conf.OverloadMsgBacklog,
+		fallback:   conf.OverloadFallback,
+	}
 	rs := &RoomService{
 		db:        db,
 		conf:      conf,
 		apps:      make(map[string]*pb.App),
 		grpcPool:  common.NewGrpcPool(grpc.WithTransportCredentials(insecure.NewCredentials())),
 		roomCache: NewRoomCache(db, time.Millisecond*10),
-		gameCache: newGameCache(db, time.Second*1, time.Duration(conf.ValidHeartBeat)),
-		hubCache:  newHubCache(db, time.Second*1, time.Duration(conf.ValidHeartBeat)),
+		gameCache: newGameCache(db, time.Second*1, time.Duration(conf.ValidHeartBeat), limit),
+		hubCache:  newHubCache(db, time.Second*1, time.Duration(conf.ValidHeartBeat), limit),
+
+		maintenance: newMaintenanceCache(db, time.Second*1),
+		revocation:  newRevocationCache(db, time.Second*1, time.Duration(conf.AuthDataExpire)),
 	}
 	for i, app := range apps {
 		rs.apps[app.Id] = apps[i]
@@ -63,16 +75,30 @@ func (rs *RoomService) GetAppKey(appId string) (string, bool) {
 	return app.Key, true
 }
 
-func (rs *RoomService) Create(ctx context.Context, appId string, roomOption *pb.RoomOption, clientInfo *pb.ClientInfo, macKey string) (*pb.JoinedRoomRes, error) {
+func (rs *RoomService) Create(ctx context.Context, appId string, roomOption *pb.RoomOption, clientInfo *pb.ClientInfo, macKey string, regions []string) (*pb.JoinedRoomRes, error) {
 	if _, found := rs.apps[appId]; !found {
 		return nil, xerrors.Errorf("Unknown appId: %v", appId)
 	}
 
-	game, err := rs.gameCache.Rand()
+	m, err := rs.maintenance.Get(appId, time.Now())
+	if err != nil {
+		return nil, xerrors.Errorf("get maintenance: %w", err)
+	}
+	if m != nil {
+		return nil, WithType(
+			xerrors.Errorf("under maintenance: %v - %v %q", m.StartAt, m.EndAt, m.Message),
+			ErrMaintenance)
+	}
+
+	game, err := rs.gameCache.Select(regions)
 	if err != nil {
 		return nil, xerrors.Errorf("get game server: %w", err)
 	}
 
+	ctx, span := trace.Start(ctx, "RoomService.Create")
+	defer span.End()
+	span.SetAttr("host", game.Id)
+
 	client, err := rs.newGameClient(game.Hostname, game.GRPCPort)
 	if err != nil {
 		return nil, xerrors.Errorf("newGameClient: %w", err)
@@ -95,8 +121,11 @@ func (rs *RoomService) Create(ctx context.Context, appId string, roomOption *pb.
 				err = WithType(err, ErrArgument)
 			case codes.ResourceExhausted:
 				err = WithType(err, ErrRoomLimit)
+			case common.CodeQuotaExceeded: // appの上限
+				err = WithType(err, ErrQuotaExceeded)
 			}
 		}
+		span.SetError(err)
 		return nil, err
 	}
 
@@ -135,8 +164,22 @@ func filter(rooms []*pb.RoomInfo, props []binary.Dict, queries []PropQueries, li
 	return filtered
 }
 
-func (rs *RoomService) join(ctx context.Context, appId, roomId string, clientInfo *pb.ClientInfo, macKey string, hostId uint32) (*pb.JoinedRoomRes, error) {
-	game, err := rs.gameCache.Get(hostId)
+func (rs *RoomService) join(ctx context.Context, appId, roomId string, clientInfo *pb.ClientInfo, macKey string, hostId uint32) (_ *pb.JoinedRoomRes, err error) {
+	ctx, span := trace.Start(ctx, "RoomService.join")
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+	span.SetAttr("room", roomId)
+	span.SetAttr("host", hostId)
+
+	var game *gameServer
+	if hostId == 0 {
+		// 読み込まれていない永続部屋はどのGameサーバでも読み込める
+		game, err = rs.gameCache.Select(nil)
+	} else {
+		game, err = rs.gameCache.Get(hostId)
+	}
 	if err != nil {
 		return nil, xerrors.Errorf("get game server(%v): %w", hostId, err)
 	}
@@ -165,6 +208,8 @@ func (rs *RoomService) join(ctx context.Context, appId, roomId string, clientInf
 				err = WithType(err, ErrNoJoinableRoom)
 			case codes.ResourceExhausted: // 満室
 				err = WithType(err, ErrRoomFull)
+			case common.CodeQuotaExceeded: // appの上限
+				err = WithType(err, ErrQuotaExceeded)
 			case codes.AlreadyExists: // 既に入室している
 				err = WithType(err, ErrAlreadyJoined)
 			case codes.InvalidArgument:
@@ -184,6 +229,9 @@ func (rs *RoomService) JoinById(ctx context.Context, appId, roomId string, queri
 
 	var room pb.RoomInfo
 	err := rs.db.Get(&room, "SELECT * FROM room WHERE app_id = ? AND id = ? AND joinable = 1", appId, roomId)
+	if err != nil {
+		err = rs.db.Get(&room, "SELECT "+unloadedPersistentRoomColumns+" FROM persistent_room WHERE app_id = ? AND id = ? AND joinable = 1 AND host_id = 0", appId, roomId)
+	}
 	if err != nil {
 		return nil, WithType(
 			xerrors.Errorf("select room (id=%v): %w", roomId, err),
@@ -255,8 +303,8 @@ func (rs *RoomService) JoinAtRandom(ctx context.Context, appId string, searchGro
 		}
 		if e, ok := err.(ErrorWithType); ok {
 			switch e.ErrType() {
-			case ErrArgument:
-				// 別の部屋でも引数エラーになるので打ち切る
+			case ErrArgument, ErrQuotaExceeded:
+				// 別の部屋でも同じエラーになるので打ち切る
 				return nil, e
 			}
 		}
@@ -282,7 +330,9 @@ func (rs *RoomService) SearchByIds(ctx context.Context, appId string, roomIds []
 		return []*pb.RoomInfo{}, nil
 	}
 
-	sql, params, err := sqlx.In("SELECT * FROM room WHERE app_id = ? AND id IN (?)", appId, roomIds)
+	sql, params, err := sqlx.In("SELECT "+roomColumns+" FROM room WHERE app_id = ? AND id IN (?) "+
+		"UNION ALL SELECT "+unloadedPersistentRoomColumns+" FROM persistent_room WHERE app_id = ? AND id IN (?) AND host_id = 0",
+		appId, roomIds, appId, roomIds)
 	if err != nil {
 		return nil, xerrors.Errorf("sqlx.In: %w", err)
 	}
@@ -366,6 +416,62 @@ func (rs *RoomService) SearchCurrentRooms(ctx context.Context, appId, clientId s
 	return rooms, nil
 }
 
+// Rejoin : 入室中の部屋のうち最も新しいものに再入室する.
+// game側のClientを引き継ぐので、未読のEventは再接続時に再送される
+func (rs *RoomService) Rejoin(ctx context.Context, appId, clientId string, queries []PropQueries, macKey string, logger log.Logger) (_ *pb.JoinedRoomRes, err error) {
+	if _, found := rs.apps[appId]; !found {
+		return nil, xerrors.Errorf("Unknown appId: %v", appId)
+	}
+
+	rooms, err := rs.SearchCurrentRooms(ctx, appId, clientId, queries, logger)
+	if err != nil {
+		return nil, xerrors.Errorf("SearchCurrentRooms: %w", err)
+	}
+	if len(rooms) == 0 {
+		return nil, WithType(
+			xerrors.Errorf("no current room: client=%v", clientId),
+			ErrNoJoinableRoom)
+	}
+	room := rooms[len(rooms)-1] // Created順なので末尾が最新
+
+	ctx, span := trace.Start(ctx, "RoomService.Rejoin")
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+	span.SetAttr("room", room.Id)
+	span.SetAttr("host", room.HostId)
+
+	game, err := rs.gameCache.Get(room.HostId)
+	if err != nil {
+		return nil, xerrors.Errorf("get game server(%v): %w", room.HostId, err)
+	}
+
+	client, err := rs.newGameClient(game.Hostname, game.GRPCPort)
+	if err != nil {
+		return nil, xerrors.Errorf("newGameClient: %w", err)
+	}
+
+	req := &pb.RejoinRoomReq{
+		AppId:    appId,
+		RoomId:   room.Id,
+		ClientId: clientId,
+		MacKey:   macKey,
+	}
+
+	res, err := client.Rejoin(ctx, req)
+	if err != nil {
+		st, ok := status.FromError(err)
+		err = xerrors.Errorf("gRPC Rejoin: %w", err)
+		if ok && st.Code() == codes.NotFound { // roomが消えたか既に退室した
+			err = WithType(err, ErrNoJoinableRoom)
+		}
+		return nil, err
+	}
+
+	return res, nil
+}
+
 func (rs *RoomService) searchBySQL(ctx context.Context, sql string, params []any, queries []PropQueries, logger log.Logger) ([]*pb.RoomInfo, error) {
 	var rooms []*pb.RoomInfo
 	err := rs.db.SelectContext(ctx, &rooms, sql, params...)
@@ -383,23 +489,60 @@ func (rs *RoomService) searchBySQL(ctx context.Context, sql string, params []any
 	return filter(rooms, props, queries, len(rooms), false, false, logger), nil
 }
 
-func (rs *RoomService) watch(ctx context.Context, room *pb.RoomInfo, clientInfo *pb.ClientInfo, macKey string) (*pb.JoinedRoomRes, error) {
-	var hubIDs []uint32
-	err := rs.db.Select(&hubIDs, "SELECT `host_id` FROM `hub` WHERE `room_id`=? AND `watchers`<?", room.Id, rs.conf.HubMaxWatchers)
+// servingHub : 部屋を中継しているHub (hubテーブルの行)
+type servingHub struct {
+	HostId   uint32 `db:"host_id"`
+	Watchers int    `db:"watchers"`
+}
+
+// selectHub : 観戦に使うHubを選ぶ.
+// 部屋を中継しているregionのHubのうち、この部屋の観戦者の少ないものを優先する.
+// regionのHubが中継していなければregionのHubで新たに中継を始め、
+// regionにHubが無ければ中継しているHubに相乗りする.
+func (rs *RoomService) selectHub(serving []servingHub, region string) (*hubServer, error) {
+	hubs := make([]*hubServer, 0, len(serving))
+	for _, s := range serving {
+		hub, err := rs.hubCache.Get(s.HostId)
+		if err != nil {
+			continue
+		}
+		h := *hub
+		h.Watchers = s.Watchers // Hub全体ではなくこの部屋の観戦者数で比べる
+		hubs = append(hubs, &h)
+	}
+	if hub := leastWatchers(hubs, region); hub != nil && hub.inRegion(region) {
+		return hub, nil
+	}
+
+	hub, err := rs.hubCache.Select(region)
+	if err == nil && hub.inRegion(region) {
+		return hub, nil
+	}
+	if h := leastWatchers(hubs, ""); h != nil {
+		return h, nil
+	}
+	return hub, err
+}
+
+func (rs *RoomService) watch(ctx context.Context, room *pb.RoomInfo, clientInfo *pb.ClientInfo, macKey, region string) (_ *pb.JoinedRoomRes, err error) {
+	ctx, span := trace.Start(ctx, "RoomService.watch")
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+	span.SetAttr("room", room.Id)
+
+	var serving []servingHub
+	err = rs.db.Select(&serving, "SELECT `host_id`, `watchers` FROM `hub` WHERE `room_id`=? AND `watchers`<?", room.Id, rs.conf.HubMaxWatchers)
 	if err != nil {
 		return nil, xerrors.Errorf("select hub: %w", err)
 	}
 
-	var hub *hubServer
-	if len(hubIDs) > 0 {
-		n := rand.IntN(len(hubIDs))
-		hub, err = rs.hubCache.Get(hubIDs[n])
-	} else {
-		hub, err = rs.hubCache.Rand()
-	}
+	hub, err := rs.selectHub(serving, region)
 	if err != nil {
 		return nil, xerrors.Errorf("get hub server: %w", err)
 	}
+	span.SetAttr("hub", hub.Id)
 
 	client, err := rs.newGameClient(hub.Hostname, hub.GRPCPort)
 	if err != nil {
@@ -430,6 +573,8 @@ func (rs *RoomService) watch(ctx context.Context, room *pb.RoomInfo, clientInfo
 				err = WithType(err, ErrNoWatchableRoom)
 			case codes.FailedPrecondition: // watchableでなくなっていた
 				err = WithType(err, ErrNoWatchableRoom)
+			case common.CodeQuotaExceeded: // appの上限
+				err = WithType(err, ErrQuotaExceeded)
 			case codes.AlreadyExists: // 既に入室している
 				err = WithType(err, ErrAlreadyJoined)
 			case codes.InvalidArgument:
@@ -442,7 +587,7 @@ func (rs *RoomService) watch(ctx context.Context, room *pb.RoomInfo, clientInfo
 	return res, nil
 }
 
-func (rs *RoomService) WatchById(ctx context.Context, appId, roomId string, queries []PropQueries, clientInfo *pb.ClientInfo, macKey string, logger log.Logger) (*pb.JoinedRoomRes, error) {
+func (rs *RoomService) WatchById(ctx context.Context, appId, roomId string, queries []PropQueries, clientInfo *pb.ClientInfo, macKey, region string, logger log.Logger) (*pb.JoinedRoomRes, error) {
 	if _, found := rs.apps[appId]; !found {
 		return nil, xerrors.Errorf("Unknown appId: %v", appId)
 	}
@@ -467,10 +612,10 @@ func (rs *RoomService) WatchById(ctx context.Context, appId, roomId string, quer
 			ErrNoWatchableRoom)
 	}
 
-	return rs.watch(ctx, filtered[0], clientInfo, macKey)
+	return rs.watch(ctx, filtered[0], clientInfo, macKey, region)
 }
 
-func (rs *RoomService) WatchByNumber(ctx context.Context, appId string, roomNumber int32, queries []PropQueries, clientInfo *pb.ClientInfo, macKey string, logger log.Logger) (*pb.JoinedRoomRes, error) {
+func (rs *RoomService) WatchByNumber(ctx context.Context, appId string, roomNumber int32, queries []PropQueries, clientInfo *pb.ClientInfo, macKey, region string, logger log.Logger) (*pb.JoinedRoomRes, error) {
 	if _, found := rs.apps[appId]; !found {
 		return nil, xerrors.Errorf("Unknown appId: %v", appId)
 	}
@@ -495,44 +640,7 @@ func (rs *RoomService) WatchByNumber(ctx context.Context, appId string, roomNumb
 			ErrNoWatchableRoom)
 	}
 
-	return rs.watch(ctx, filtered[0], clientInfo, macKey)
-}
-
-func (rs *RoomService) AdminKick(ctx context.Context, appId, targetID string, logger log.Logger) error {
-	if _, found := rs.apps[appId]; !found {
-		return xerrors.Errorf("Unknown appId: %v", appId)
-	}
-
-	go rs.adminKick(appId, targetID, logger)
-	return nil
-}
-
-func (rs *RoomService) adminKick(appID, targetID string, logger log.Logger) {
-	allGameServers, err := rs.gameCache.All()
-	if err != nil {
-		logger.Errorf("adminKick: get all game servers: %+v", err)
-		return
-	}
-
-	for _, game := range allGameServers {
-		client, err := rs.newGameClient(game.Hostname, game.GRPCPort)
-		if err != nil {
-			logger.Errorf("adminKick: newGameClient: %+v", err)
-			continue
-		}
-
-		req := &pb.KickReq{
-			AppId:    appID,
-			RoomId:   "",
-			ClientId: targetID,
-		}
-		_, err = client.Kick(context.Background(), req)
-		if err != nil {
-			logger.Errorf("adminKick: app=%q target=%q host=%q err=%+v", appID, targetID, game.Hostname, err)
-			continue
-		}
-	}
-
+	return rs.watch(ctx, filtered[0], clientInfo, macKey, region)
 }
 
 func (rs *RoomService) newGameClient(host string, port int) (pb.GameClient, error) {
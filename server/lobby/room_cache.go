@@ -9,9 +9,17 @@ import (
 
 	"wsnet2/binary"
 	"wsnet2/log"
+	"wsnet2/metrics"
 	"wsnet2/pb"
 )
 
+// roomColumns : room テーブルをpb.RoomInfoとして読む列
+const roomColumns = "id, app_id, host_id, visible, joinable, watchable, number, search_group, max_players, players, watchers, props, created"
+
+// unloadedPersistentRoomColumns : 読み込まれていない永続部屋をroomColumnsと同じ形で読む列.
+// host_idは0になる. 観戦できるのは読み込まれている部屋だけなのでwatchableは0とする.
+const unloadedPersistentRoomColumns = "id, app_id, host_id, visible, joinable, 0 AS watchable, NULL AS number, search_group, max_players, 0 AS players, 0 AS watchers, props, created"
+
 type roomCacheQuery struct {
 	sync.Mutex
 	db     *sqlx.DB
@@ -46,6 +54,7 @@ func (q *roomCacheQuery) do(ctx context.Context) ([]*pb.RoomInfo, []binary.Dict,
 
 	rooms := []*pb.RoomInfo{}
 	err := q.db.SelectContext(ctx, &rooms, q.query, q.args...)
+	metrics.DBQueryLatency.With("room_select").ObserveSince(now)
 	if err != nil {
 		q.result = nil
 		q.lastError = err
@@ -93,7 +102,11 @@ func (c *RoomCache) GetRooms(ctx context.Context, appId string, searchGroup uint
 		if c.queries[appId] == nil {
 			c.queries[appId] = make(map[uint32]*roomCacheQuery)
 		}
-		q = newRoomCacheQuery(c.db, c.expire, "SELECT * FROM room WHERE app_id = ? AND search_group = ? AND visible = 1 LIMIT 1000", appId, searchGroup)
+		q = newRoomCacheQuery(c.db, c.expire,
+			"SELECT "+roomColumns+" FROM room WHERE app_id = ? AND search_group = ? AND visible = 1 "+
+				"UNION ALL SELECT "+unloadedPersistentRoomColumns+" FROM persistent_room WHERE app_id = ? AND search_group = ? AND visible = 1 AND host_id = 0 "+
+				"LIMIT 1000",
+			appId, searchGroup, appId, searchGroup)
 		c.queries[appId][searchGroup] = q
 	}
 	c.Unlock()
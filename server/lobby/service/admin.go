@@ -0,0 +1,406 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"wsnet2/auth"
+	"wsnet2/lobby"
+	"wsnet2/log"
+)
+
+func (sv *LobbyService) registerAdminRoutes(r *http.ServeMux) {
+	r.HandleFunc("POST /_admin/kick", sv.handleAdminKick)
+	r.HandleFunc("POST /_admin/rooms", sv.handleAdminRooms)
+	r.HandleFunc("POST /_admin/room", sv.handleAdminRoom)
+	r.HandleFunc("POST /_admin/close", sv.handleAdminClose)
+	r.HandleFunc("POST /_admin/notice", sv.handleAdminNotice)
+	r.HandleFunc("POST /_admin/drain", sv.handleAdminDrain)
+	r.HandleFunc("POST /_admin/maintenance", sv.handleAdminMaintenance)
+	r.HandleFunc("POST /_admin/token", sv.handleAdminToken)
+	r.HandleFunc("POST /_admin/revoke", sv.handleAdminRevoke)
+}
+
+// authAdmin : 管理APIトークンを検証してscopeの権限を確認する
+func (sv *LobbyService) authAdmin(h header, scope string) (*auth.AdminClaims, error) {
+	if sv.conf.AdminTokenKey == "" {
+		return nil, xerrors.Errorf("admin token is disabled")
+	}
+	claims, err := auth.ValidAdminToken(h.authData, sv.conf.AdminTokenKey, time.Now())
+	if err != nil {
+		return nil, xerrors.Errorf("invalid admin token: %w", err)
+	}
+	if !claims.HasScope(scope) {
+		return claims, xerrors.Errorf("scope %q is not permitted: sub=%q scopes=%v", scope, claims.Subject, claims.Scopes)
+	}
+	if !claims.AllowApp(h.appId) {
+		return claims, xerrors.Errorf("app %q is not permitted: sub=%q app=%q", h.appId, claims.Subject, claims.AppId)
+	}
+	return claims, nil
+}
+
+// adminRequest : 管理APIの認証とリクエストのデコード
+// 失敗した場合はエラーレスポンスと監査ログを出力してfalseを返す
+func (sv *LobbyService) adminRequest(w http.ResponseWriter, r *http.Request, action, scope string, param any, logger log.Logger) (*auth.AdminClaims, bool) {
+	h := parseSpecificHeader(r)
+	raddr, _ := remoteAddr(r)
+
+	claims, err := sv.authAdmin(h, scope)
+	if err != nil {
+		subject := ""
+		if claims != nil {
+			subject = claims.Subject
+		}
+		sv.roomService.AdminLog(subject, h.appId, action, nil, raddr, err, logger)
+		renderErrorResponse(w, "Failed to admin auth", http.StatusForbidden, err, logger)
+		return nil, false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(param); err != nil {
+		sv.roomService.AdminLog(claims.Subject, h.appId, action, nil, raddr, err, logger)
+		renderErrorResponse(w, "failed to decode JSON request", http.StatusBadRequest, err, logger)
+		return nil, false
+	}
+
+	return claims, true
+}
+
+func renderAdminResponse(w http.ResponseWriter, res *lobby.AdminResponse, logger log.Logger) {
+	body, err := json.Marshal(res)
+	if err != nil {
+		logger.Errorf("Failed to marshal response: %+v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+	logger.Infof("Response(OK): %v", res.Msg)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func renderAdminErrorResponse(w http.ResponseWriter, msg string, err error, logger log.Logger) {
+	var e lobby.ErrorWithType
+	if errors.As(err, &e) && e.ErrType() == lobby.ErrNoJoinableRoom {
+		logger.Infof("ErrorResponse: %d %s: %v", http.StatusNotFound, msg, err)
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	renderErrorResponse(w, msg, http.StatusInternalServerError, err, logger)
+}
+
+// 対象ユーザーをKickする。ゲームAPIサーバーからリクエストされる。
+// php, Python等からアクセスしやすくするために、msgpackではなくてJSONを使う。
+// Method: POST
+// Path: /_admin/kick
+// Scope: kick
+// JSON Params: {"target_id": "user", "room_id": "..."}
+//
+// admin_legacy_authが有効なら、管理APIトークンの代わりに Wsnet2-User をAppIdとしたauthdataも受け付ける
+func (sv *LobbyService) handleAdminKick(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(sv.conf.ApiTimeout))
+	defer cancel()
+
+	h := parseSpecificHeader(r)
+	logger := prepareLogger("lobby:admin/kick", h, r)
+
+	var req lobby.AdminKickParam
+	var subject string
+	if !sv.conf.AdminLegacyAuth || auth.IsAdminToken(h.authData) {
+		claims, ok := sv.adminRequest(w, r, "kick", auth.AdminScopeKick, &req, logger)
+		if !ok {
+			return
+		}
+		subject = claims.Subject
+	} else {
+		raddr, _ := remoteAddr(r)
+		if h.appId != h.userId {
+			err := xerrors.Errorf("bad userID: appID=%q userID=%q", h.appId, h.userId)
+			sv.roomService.AdminLog("", h.appId, "kick", nil, raddr, err, logger)
+			renderErrorResponse(w, "Failed to auth", http.StatusForbidden, err, logger)
+			return
+		}
+
+		_, err := sv.authUser(h)
+		if err != nil {
+			sv.roomService.AdminLog("", h.appId, "kick", nil, raddr, err, logger)
+			renderErrorResponse(w, "Failed to user auth", http.StatusUnauthorized, err, logger)
+			return
+		}
+
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			sv.roomService.AdminLog(h.appId, h.appId, "kick", nil, raddr, err, logger)
+			renderErrorResponse(w, "failed to decode JSON request", http.StatusBadRequest, err, logger)
+			return
+		}
+		subject = h.appId
+		logger.Warnf("legacy authdata is used for /_admin/kick: app=%v. use an admin token instead; admin_legacy_auth will be disabled by default", h.appId)
+	}
+
+	raddr, _ := remoteAddr(r)
+	err := sv.roomService.AdminKick(ctx, h.appId, req.RoomID, req.TargetID, logger)
+	sv.roomService.AdminLog(subject, h.appId, "kick", req, raddr, err, logger)
+	if err != nil {
+		renderAdminErrorResponse(w, "Failed to kick", err, logger)
+		return
+	}
+	logger.Infof("Rresponse(OK): kick by admin: %v", req.TargetID)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"msg": "ok"}`))
+}
+
+// 部屋一覧
+// Method: POST
+// Path: /_admin/rooms
+// Scope: read
+// JSON Params: {"search_group": 1, "limit": 100}
+func (sv *LobbyService) handleAdminRooms(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(sv.conf.ApiTimeout))
+	defer cancel()
+
+	h := parseSpecificHeader(r)
+	logger := prepareLogger("lobby:admin/rooms", h, r)
+
+	var req lobby.AdminRoomsParam
+	claims, ok := sv.adminRequest(w, r, "rooms", auth.AdminScopeRead, &req, logger)
+	if !ok {
+		return
+	}
+
+	raddr, _ := remoteAddr(r)
+	rooms, err := sv.roomService.AdminRooms(ctx, h.appId, req.SearchGroup, req.Limit)
+	sv.roomService.AdminLog(claims.Subject, h.appId, "rooms", req, raddr, err, logger)
+	if err != nil {
+		renderAdminErrorResponse(w, "Failed to list rooms", err, logger)
+		return
+	}
+
+	renderAdminResponse(w, &lobby.AdminResponse{Msg: "ok", Rooms: rooms}, logger.With(log.KeyRoomCount, len(rooms)))
+}
+
+// 部屋の詳細
+// Method: POST
+// Path: /_admin/room
+// Scope: read
+// JSON Params: {"room_id": "..."}
+func (sv *LobbyService) handleAdminRoom(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(sv.conf.ApiTimeout))
+	defer cancel()
+
+	h := parseSpecificHeader(r)
+	logger := prepareLogger("lobby:admin/room", h, r)
+
+	var req lobby.AdminRoomParam
+	claims, ok := sv.adminRequest(w, r, "room", auth.AdminScopeRead, &req, logger)
+	if !ok {
+		return
+	}
+	logger = logger.With(log.KeyRoom, req.RoomID)
+
+	raddr, _ := remoteAddr(r)
+	room, err := sv.roomService.AdminRoomInfo(ctx, h.appId, req.RoomID)
+	sv.roomService.AdminLog(claims.Subject, h.appId, "room", req, raddr, err, logger)
+	if err != nil {
+		renderAdminErrorResponse(w, "Failed to get room info", err, logger)
+		return
+	}
+
+	renderAdminResponse(w, &lobby.AdminResponse{Msg: "ok", Room: room}, logger)
+}
+
+// 部屋の強制終了
+// Method: POST
+// Path: /_admin/close
+// Scope: close
+// JSON Params: {"room_id": "...", "reason": "..."}
+func (sv *LobbyService) handleAdminClose(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(sv.conf.ApiTimeout))
+	defer cancel()
+
+	h := parseSpecificHeader(r)
+	logger := prepareLogger("lobby:admin/close", h, r)
+
+	var req lobby.AdminCloseParam
+	claims, ok := sv.adminRequest(w, r, "close", auth.AdminScopeClose, &req, logger)
+	if !ok {
+		return
+	}
+	logger = logger.With(log.KeyRoom, req.RoomID)
+
+	raddr, _ := remoteAddr(r)
+	err := sv.roomService.AdminClose(ctx, h.appId, req.RoomID, req.Reason)
+	sv.roomService.AdminLog(claims.Subject, h.appId, "close", req, raddr, err, logger)
+	if err != nil {
+		renderAdminErrorResponse(w, "Failed to close room", err, logger)
+		return
+	}
+
+	renderAdminResponse(w, &lobby.AdminResponse{Msg: "ok"}, logger)
+}
+
+// お知らせの送信
+// Method: POST
+// Path: /_admin/notice
+// Scope: notice
+// JSON Params: {"room_id": "...", "message": "..."}
+// room_idを省略した場合はappの全ての部屋に送る
+func (sv *LobbyService) handleAdminNotice(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(sv.conf.ApiTimeout))
+	defer cancel()
+
+	h := parseSpecificHeader(r)
+	logger := prepareLogger("lobby:admin/notice", h, r)
+
+	var req lobby.AdminNoticeParam
+	claims, ok := sv.adminRequest(w, r, "notice", auth.AdminScopeNotice, &req, logger)
+	if !ok {
+		return
+	}
+
+	raddr, _ := remoteAddr(r)
+	err := sv.roomService.AdminNotice(ctx, h.appId, req.RoomID, req.Message, logger)
+	sv.roomService.AdminLog(claims.Subject, h.appId, "notice", req, raddr, err, logger)
+	if err != nil {
+		renderAdminErrorResponse(w, "Failed to send notice", err, logger)
+		return
+	}
+
+	renderAdminResponse(w, &lobby.AdminResponse{Msg: "ok"}, logger)
+}
+
+// game/hub serverのdrain状態の切り替え
+// Method: POST
+// Path: /_admin/drain
+// Scope: maintenance
+// JSON Params: {"type": "game", "host_id": 1, "drain": true}
+//
+// サーバーは全appで共有されるため、app指定の無いトークンのみ受け付ける
+func (sv *LobbyService) handleAdminDrain(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(sv.conf.ApiTimeout))
+	defer cancel()
+
+	h := parseSpecificHeader(r)
+	logger := prepareLogger("lobby:admin/drain", h, r)
+
+	var req lobby.AdminDrainParam
+	claims, ok := sv.adminRequest(w, r, "drain", auth.AdminScopeMaintenance, &req, logger)
+	if !ok {
+		return
+	}
+
+	raddr, _ := remoteAddr(r)
+	if claims.AppId != "" {
+		err := xerrors.Errorf("app restricted token is not permitted: sub=%q app=%q", claims.Subject, claims.AppId)
+		sv.roomService.AdminLog(claims.Subject, h.appId, "drain", req, raddr, err, logger)
+		renderErrorResponse(w, "Failed to admin auth", http.StatusForbidden, err, logger)
+		return
+	}
+
+	err := sv.roomService.AdminDrain(ctx, req.Type, req.HostID, req.Drain)
+	sv.roomService.AdminLog(claims.Subject, h.appId, "drain", req, raddr, err, logger)
+	if err != nil {
+		renderAdminErrorResponse(w, "Failed to drain", err, logger)
+		return
+	}
+
+	renderAdminResponse(w, &lobby.AdminResponse{Msg: "ok"}, logger)
+}
+
+// メンテナンス期間の設定
+// Method: POST
+// Path: /_admin/maintenance
+// Scope: maintenance
+// JSON Params: {"start_at": 1700000000, "end_at": 1700003600, "message": "..."}
+// end_atが0の場合はメンテナンス予定を削除する
+func (sv *LobbyService) handleAdminMaintenance(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(sv.conf.ApiTimeout))
+	defer cancel()
+
+	h := parseSpecificHeader(r)
+	logger := prepareLogger("lobby:admin/maintenance", h, r)
+
+	var req lobby.AdminMaintenanceParam
+	claims, ok := sv.adminRequest(w, r, "maintenance", auth.AdminScopeMaintenance, &req, logger)
+	if !ok {
+		return
+	}
+
+	var start, end time.Time
+	if req.EndAt != 0 {
+		start, end = time.Unix(req.StartAt, 0), time.Unix(req.EndAt, 0)
+	}
+
+	raddr, _ := remoteAddr(r)
+	err := sv.roomService.AdminMaintenance(ctx, h.appId, start, end, req.Message)
+	sv.roomService.AdminLog(claims.Subject, h.appId, "maintenance", req, raddr, err, logger)
+	if err != nil {
+		renderAdminErrorResponse(w, "Failed to set maintenance", err, logger)
+		return
+	}
+
+	renderAdminResponse(w, &lobby.AdminResponse{Msg: "ok"}, logger)
+}
+
+// クライアントのAccessInfoの発行
+// Method: POST
+// Path: /_admin/token
+// Scope: token
+// JSON Params: {"user_id": "...", "ttl": 60}
+// ttlを省略した場合はtoken_ttlとする
+func (sv *LobbyService) handleAdminToken(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(sv.conf.ApiTimeout))
+	defer cancel()
+
+	h := parseSpecificHeader(r)
+	logger := prepareLogger("lobby:admin/token", h, r)
+
+	var req lobby.AdminTokenParam
+	claims, ok := sv.adminRequest(w, r, "token", auth.AdminScopeToken, &req, logger)
+	if !ok {
+		return
+	}
+
+	raddr, _ := remoteAddr(r)
+	token, err := sv.roomService.AdminIssueToken(ctx, h.appId, req.UserID, time.Duration(req.TTL)*time.Second)
+	sv.roomService.AdminLog(claims.Subject, h.appId, "token", req, raddr, err, logger)
+	if err != nil {
+		renderAdminErrorResponse(w, "Failed to issue token", err, logger)
+		return
+	}
+
+	renderAdminResponse(w, &lobby.AdminResponse{Msg: "ok", Token: token}, logger)
+}
+
+// 発行済みのbearerの失効
+// Method: POST
+// Path: /_admin/revoke
+// Scope: token
+// JSON Params: {"user_id": "..."}
+// これまでに発行したuser_idのbearerを全て失効させる. 以降に発行したものは有効
+func (sv *LobbyService) handleAdminRevoke(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(sv.conf.ApiTimeout))
+	defer cancel()
+
+	h := parseSpecificHeader(r)
+	logger := prepareLogger("lobby:admin/revoke", h, r)
+
+	var req lobby.AdminRevokeParam
+	claims, ok := sv.adminRequest(w, r, "revoke", auth.AdminScopeToken, &req, logger)
+	if !ok {
+		return
+	}
+
+	raddr, _ := remoteAddr(r)
+	err := sv.roomService.AdminRevoke(ctx, h.appId, req.UserID)
+	sv.roomService.AdminLog(claims.Subject, h.appId, "revoke", req, raddr, err, logger)
+	if err != nil {
+		renderAdminErrorResponse(w, "Failed to revoke", err, logger)
+		return
+	}
+
+	renderAdminResponse(w, &lobby.AdminResponse{Msg: "ok"}, logger)
+}
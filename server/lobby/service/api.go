@@ -3,7 +3,6 @@ package service
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -11,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -23,6 +23,7 @@ import (
 	"wsnet2/lobby"
 	"wsnet2/log"
 	"wsnet2/pb"
+	"wsnet2/trace"
 )
 
 func msgpackDecode(r io.Reader, out interface{}) error {
@@ -66,7 +67,7 @@ func (sv *LobbyService) serveAPI(ctx context.Context) <-chan error {
 		r := http.NewServeMux()
 		sv.registerRoutes(r)
 
-		errCh <- http.Serve(listener, r)
+		errCh <- http.Serve(listener, instrumentAPI(r))
 	}()
 
 	return errCh
@@ -85,24 +86,28 @@ func (sv *LobbyService) registerRoutes(r *http.ServeMux) {
 	r.HandleFunc("POST /rooms/join/id/{roomId}", sv.handleJoinRoom)
 	r.HandleFunc("POST /rooms/join/number/{roomNumber}", sv.handleJoinRoomByNumber)
 	r.HandleFunc("POST /rooms/join/random/{searchGroup}", sv.handleJoinRoomAtRandom)
+	r.HandleFunc("POST /rooms/rejoin", sv.handleRejoinRoom)
 	r.HandleFunc("POST /rooms/search", sv.handleSearchRooms)
 	r.HandleFunc("POST /rooms/search/ids", sv.handleSearchByIds)
 	r.HandleFunc("POST /rooms/search/numbers", sv.handleSearchByNumbers)
 	r.HandleFunc("POST /rooms/search/current", sv.handleSearchCurrentRooms)
 	r.HandleFunc("POST /rooms/watch/id/{roomId}", sv.handleWatchRoom)
 	r.HandleFunc("POST /rooms/watch/number/{roomNumber}", sv.handleWatchRoomByNumber)
-	r.HandleFunc("POST /_admin/kick", sv.handleAdminKick)
+
+	sv.registerAdminRoutes(r)
 }
 
 type header struct {
 	appId    string
 	userId   string
 	authData string
+	region   string // クライアントに近いサーバを選ぶための地域. 省略可
 }
 
 func parseSpecificHeader(r *http.Request) (hdr header) {
 	hdr.appId = r.Header.Get("Wsnet2-App")
 	hdr.userId = r.Header.Get("Wsnet2-User")
+	hdr.region = r.Header.Get("Wsnet2-Region")
 
 	bearer := r.Header.Get("Authorization")
 	if strings.HasPrefix(bearer, "Bearer ") {
@@ -112,7 +117,7 @@ func parseSpecificHeader(r *http.Request) (hdr header) {
 	return hdr
 }
 
-func prepareLogger(handler string, hdr header, r *http.Request) log.Logger {
+func remoteAddr(r *http.Request) (string, error) {
 	raddr, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
 		raddr = r.RemoteAddr
@@ -123,6 +128,11 @@ func prepareLogger(handler string, hdr header, r *http.Request) log.Logger {
 		}
 		raddr = f
 	}
+	return raddr, err
+}
+
+func prepareLogger(handler string, hdr header, r *http.Request) log.Logger {
+	raddr, err := remoteAddr(r)
 	l := log.GetLoggerWith(
 		log.KeyHandler, handler,
 		log.KeyRequestedAt, float64(time.Now().UnixMilli())/1000,
@@ -131,6 +141,7 @@ func prepareLogger(handler string, hdr header, r *http.Request) log.Logger {
 		log.KeyRemoteAddr, raddr,
 		log.KeyPath, r.URL.Path,
 	)
+	l = trace.LoggerWith(r.Context(), l)
 	if err != nil {
 		l.Errorf("SplitHostPort: %v", err)
 	}
@@ -149,6 +160,7 @@ func renderResponse(w http.ResponseWriter, res *lobby.Response, logger log.Logge
 		return
 	}
 	logger.Infof("Response(%v): %v", res.Type, res.Msg)
+	setResponseType(w, res.Type)
 	w.Header().Set("Content-Type", "application/x-msgpack")
 	w.Write(body.Bytes())
 }
@@ -188,6 +200,14 @@ func renderErrorResponse(w http.ResponseWriter, msg string, status int, err erro
 			logger.Infof("Failed with status OK: %+v", err)
 			renderResponse(w, &lobby.Response{Msg: msg, Type: lobby.ResponseTypeRoomFull}, logger)
 			return
+		case lobby.ErrQuotaExceeded:
+			logger.Infof("Failed with status OK: %+v", err)
+			renderResponse(w, &lobby.Response{Msg: msg, Type: lobby.ResponseTypeQuotaExceeded}, logger)
+			return
+		case lobby.ErrMaintenance:
+			logger.Infof("Failed with status OK: %+v", err)
+			renderResponse(w, &lobby.Response{Msg: msg, Type: lobby.ResponseTypeMaintenance}, logger)
+			return
 		case lobby.ErrNoJoinableRoom, lobby.ErrNoWatchableRoom:
 			logger.Infof("Failed with status OK: %+v", err)
 			renderResponse(w, &lobby.Response{Msg: msg, Type: lobby.ResponseTypeNoRoomFound}, logger)
@@ -214,6 +234,17 @@ func (sv *LobbyService) authUser(h header) (string, error) {
 		}
 		return "", xerrors.Errorf("invalid authdata: %w", err)
 	}
+	issued, err := auth.AuthDataTime(h.authData)
+	if err != nil {
+		return "", xerrors.Errorf("invalid authdata: %w", err)
+	}
+	revoked, err := sv.roomService.Revoked(h.appId, h.userId, issued)
+	if err != nil {
+		return "", xerrors.Errorf("check revocation: %w", err)
+	}
+	if revoked {
+		return "", xerrors.Errorf("revoked authdata: user=%v issued=%v", h.userId, issued)
+	}
 	return appKey, nil
 }
 
@@ -247,7 +278,13 @@ func (sv *LobbyService) handleCreateRoom(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	room, err := sv.roomService.Create(ctx, h.appId, param.RoomOption, param.ClientInfo, macKey)
+	// Wsnet2-Regionヘッダの地域はパラメータで指定された地域の後に候補とする
+	regions := param.Regions
+	if h.region != "" && !slices.Contains(regions, h.region) {
+		regions = append(regions, h.region)
+	}
+
+	room, err := sv.roomService.Create(ctx, h.appId, param.RoomOption, param.ClientInfo, macKey, regions)
 	if err != nil {
 		renderErrorResponse(w, "Failed to create room", http.StatusInternalServerError, err, logger)
 		return
@@ -421,6 +458,42 @@ func (sv *LobbyService) handleJoinRoomAtRandom(w http.ResponseWriter, r *http.Re
 	renderJoinedRoomResponse(w, room, logger)
 }
 
+func (sv *LobbyService) handleRejoinRoom(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(sv.conf.ApiTimeout))
+	defer cancel()
+
+	h := parseSpecificHeader(r)
+	logger := prepareLogger("lobby:rejoin", h, r)
+	logger.Debugf("handleRejoinRoom")
+
+	appKey, err := sv.authUser(h)
+	if err != nil {
+		renderErrorResponse(w, "Failed to user auth", http.StatusUnauthorized, err, logger)
+		return
+	}
+
+	var param lobby.RejoinParam
+	err = msgpackDecode(r.Body, &param)
+	if err != nil {
+		renderErrorResponse(w, "Failed to read request body", http.StatusBadRequest, err, logger)
+		return
+	}
+
+	macKey, err := auth.DecryptMACKey(appKey, param.EncMACKey)
+	if err != nil {
+		renderErrorResponse(w, "Failed to read MAC Key", http.StatusBadRequest, err, logger)
+		return
+	}
+
+	room, err := sv.roomService.Rejoin(ctx, h.appId, h.userId, param.Queries, macKey, logger)
+	if err != nil {
+		renderErrorResponse(w, "Failed to rejoin room", http.StatusInternalServerError, err, logger)
+		return
+	}
+
+	renderJoinedRoomResponse(w, room, logger)
+}
+
 func (sv *LobbyService) handleSearchRooms(w http.ResponseWriter, r *http.Request) {
 	h := parseSpecificHeader(r)
 	logger := prepareLogger("lobby:search", h, r)
@@ -573,7 +646,7 @@ func (sv *LobbyService) handleWatchRoom(w http.ResponseWriter, r *http.Request)
 	}
 	logger = logger.With(log.KeyRoom, roomId)
 
-	room, err := sv.roomService.WatchById(ctx, h.appId, roomId, param.Queries, param.ClientInfo, macKey, logger)
+	room, err := sv.roomService.WatchById(ctx, h.appId, roomId, param.Queries, param.ClientInfo, macKey, h.region, logger)
 	if err != nil {
 		renderErrorResponse(w, "Failed to watch room", http.StatusInternalServerError, err, logger)
 		return
@@ -618,7 +691,7 @@ func (sv *LobbyService) handleWatchRoomByNumber(w http.ResponseWriter, r *http.R
 	}
 	logger = logger.With(log.KeyRoomNumber, roomNumber)
 
-	room, err := sv.roomService.WatchByNumber(ctx, h.appId, roomNumber, param.Queries, param.ClientInfo, macKey, logger)
+	room, err := sv.roomService.WatchByNumber(ctx, h.appId, roomNumber, param.Queries, param.ClientInfo, macKey, h.region, logger)
 	if err != nil {
 		renderErrorResponse(w, "Failed to watch room", http.StatusInternalServerError, err, logger)
 		return
@@ -626,40 +699,3 @@ func (sv *LobbyService) handleWatchRoomByNumber(w http.ResponseWriter, r *http.R
 
 	renderJoinedRoomResponse(w, room, logger)
 }
-
-// 対象ユーザーをKickする。ゲームAPIサーバーからリクエストされる。
-// php, Python等からアクセスしやすくするために、msgpackではなくてJSONを使う。
-func (sv *LobbyService) handleAdminKick(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(sv.conf.ApiTimeout))
-	defer cancel()
-
-	h := parseSpecificHeader(r)
-	logger := prepareLogger("lobby:admin/kick", h, r)
-	if h.appId != h.userId {
-		err := xerrors.Errorf("bad userID: appID=%q userID=%q", h.appId, h.userId)
-		renderErrorResponse(w, "Failed to auth", http.StatusForbidden, err, logger)
-		return
-	}
-
-	_, err := sv.authUser(h)
-	if err != nil {
-		renderErrorResponse(w, "Failed to user auth", http.StatusUnauthorized, err, logger)
-		return
-	}
-
-	var req lobby.AdminKickParam
-	err = json.NewDecoder(r.Body).Decode(&req)
-	if err != nil {
-		renderErrorResponse(w, "failed to decode JSON request", http.StatusBadRequest, err, logger)
-		return
-	}
-
-	err = sv.roomService.AdminKick(ctx, h.appId, req.TargetID, logger)
-	if err != nil {
-		renderErrorResponse(w, "Internal Server Error", http.StatusInternalServerError, err, logger)
-		return
-	}
-	logger.Infof("Rresponse(OK): kick by admin: %v", req.TargetID)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"msg": "ok"}`))
-}
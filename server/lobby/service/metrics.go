@@ -0,0 +1,63 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"wsnet2/metrics"
+	"wsnet2/trace"
+)
+
+// apiRecorder : メトリクスのためにレスポンスのステータスと種別を記録する
+type apiRecorder struct {
+	http.ResponseWriter
+	status  int
+	resType string
+}
+
+func (rec *apiRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// setResponseType : renderResponseから呼ばれ、ResponseTypeを記録する
+func setResponseType(w http.ResponseWriter, t fmt.Stringer) {
+	if rec, ok := w.(*apiRecorder); ok {
+		rec.resType = t.String()
+	}
+}
+
+// instrumentAPI : handler毎のレイテンシをメトリクスに記録する.
+// また、Wsnet2-Traceヘッダのトレースコンテキストを引き継いでhandlerのSpanを記録する.
+func instrumentAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &apiRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		ctx := trace.Extract(r.Context(), r.Header.Get(trace.Header))
+		ctx, span := trace.Start(ctx, "lobby")
+		defer span.End()
+
+		// クライアントがログと突き合わせられるようにトレースIDを返す
+		w.Header().Set(trace.Header, span.SpanContext().Traceparent())
+
+		r = r.WithContext(ctx)
+		next.ServeHTTP(rec, r)
+
+		// ServeMuxがマッチしたパターンを設定する
+		handler := r.Pattern
+		if handler == "" {
+			handler = "unmatched"
+		}
+		typ := rec.resType
+		if typ == "" {
+			typ = fmt.Sprintf("Status%d", rec.status)
+		}
+		metrics.LobbyAPILatency.With(handler, typ).ObserveSince(start)
+
+		span.SetName("lobby " + handler)
+		span.SetAttr("status", rec.status)
+		span.SetAttr("type", typ)
+	})
+}
@@ -7,6 +7,7 @@ import (
 	_ "net/http/pprof"
 
 	"wsnet2/log"
+	"wsnet2/metrics"
 )
 
 func (sv *LobbyService) servePprof(ctx context.Context) <-chan error {
@@ -14,6 +15,9 @@ func (sv *LobbyService) servePprof(ctx context.Context) <-chan error {
 		return nil
 	}
 
+	// Prometheus形式のメトリクス
+	http.Handle("/metrics", metrics.Handler())
+
 	errCh := make(chan error)
 
 	go func() {
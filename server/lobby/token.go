@@ -0,0 +1,190 @@
+package lobby
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/xerrors"
+
+	"wsnet2/auth"
+	"wsnet2/log"
+)
+
+// AccessToken : ゲームのバックエンドがクライアントに渡すLobbyへの接続情報
+type AccessToken struct {
+	AppId     string `json:"app_id"`
+	UserId    string `json:"user_id"`
+	Bearer    string `json:"bearer"`
+	MACKey    string `json:"mac_key"`
+	EncMACKey string `json:"enc_mac_key"`
+	ExpireAt  int64  `json:"expire_at"` // bearerの有効期限 (unix time)
+}
+
+// errRevokedRecently : 失効させた直後でttlどおりに失効するbearerを発行できない
+var errRevokedRecently = errors.New("revoked recently")
+
+// NewAccessToken : userIdのbearerとMACKeyを発行する.
+//
+// Lobbyはtimestampがauthdata_expire(expire)より古いbearerを拒否するので、
+// ttlで失効するようにtimestampをexpire-ttlだけ過去にずらす.
+// ただしrevokedと同じ秒以前のtimestampは失効させたものとして拒否されるので、
+// ずらしたtimestampがそうなるときは有効期限を延ばさずにエラーとする.
+// ttlが0またはexpireより長ければexpireとする.
+func NewAccessToken(appId, appKey, userId string, now time.Time, ttl, expire time.Duration, revoked time.Time) (*AccessToken, error) {
+	if ttl <= 0 || ttl > expire {
+		ttl = expire
+	}
+	issued := now.Add(ttl - expire).Truncate(time.Second)
+	if issued.Unix() <= revoked.Unix() {
+		return nil, xerrors.Errorf("user revoked at %v: cannot issue ttl=%v until %v: %w",
+			revoked, ttl, revoked.Add(time.Second+expire-ttl), errRevokedRecently)
+	}
+
+	bearer, err := auth.GenerateAuthData(appKey, userId, issued)
+	if err != nil {
+		return nil, xerrors.Errorf("generate authdata: %w", err)
+	}
+	macKey := auth.GenMACKey()
+	encMACKey, err := auth.EncryptMACKey(appKey, macKey)
+	if err != nil {
+		return nil, xerrors.Errorf("encrypt mackey: %w", err)
+	}
+
+	return &AccessToken{
+		AppId:     appId,
+		UserId:    userId,
+		Bearer:    bearer,
+		MACKey:    macKey,
+		EncMACKey: encMACKey,
+		ExpireAt:  issued.Add(expire).Unix(),
+	}, nil
+}
+
+type revokedUser struct {
+	AppId  string `db:"app_id"`
+	UserId string `db:"user_id"`
+}
+
+// revocationCache : revoked_userテーブル.
+// timestampが秒単位なので、revoked_atと同じ秒以前のtimestampのbearerは失効している.
+type revocationCache struct {
+	sync.Mutex
+	db     *sqlx.DB
+	expire time.Duration
+	valid  time.Duration
+
+	revoked     map[revokedUser]time.Time
+	lastUpdated time.Time
+}
+
+func newRevocationCache(db *sqlx.DB, expire time.Duration, valid time.Duration) *revocationCache {
+	return &revocationCache{
+		db:      db,
+		expire:  expire,
+		valid:   valid,
+		revoked: make(map[revokedUser]time.Time),
+	}
+}
+
+func (c *revocationCache) updateInner() error {
+	// validより前に失効させたbearerは既に期限切れなので読み込まない
+	query := "SELECT app_id, user_id, revoked_at FROM revoked_user WHERE revoked_at >= ?"
+
+	var rows []struct {
+		revokedUser
+		RevokedAt int64 `db:"revoked_at"`
+	}
+	err := c.db.Select(&rows, query, time.Now().Add(-c.valid).Unix())
+	if err != nil {
+		return xerrors.Errorf("selecting revoked_user: %w", err)
+	}
+
+	log.Debugf("Now revoked users: %v", len(rows))
+
+	c.revoked = make(map[revokedUser]time.Time, len(rows))
+	for _, r := range rows {
+		c.revoked[r.revokedUser] = time.Unix(r.RevokedAt, 0)
+	}
+	c.lastUpdated = time.Now()
+	return nil
+}
+
+func (c *revocationCache) update() error {
+	if time.Since(c.lastUpdated) > c.expire {
+		return c.updateInner()
+	}
+	return nil
+}
+
+// Revoked : issuedに発行されたuserIdのbearerが失効しているか
+func (c *revocationCache) Revoked(appId, userId string, issued time.Time) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.update(); err != nil {
+		return false, err
+	}
+
+	revoked, ok := c.revoked[revokedUser{appId, userId}]
+	return ok && !issued.After(revoked), nil
+}
+
+// Revoked : bearerが失効しているか
+func (rs *RoomService) Revoked(appId, userId string, issued time.Time) (bool, error) {
+	return rs.revocation.Revoked(appId, userId, issued)
+}
+
+// AdminIssueToken : userIdのAccessTokenを発行する. ttlが0ならtoken_ttlとする
+func (rs *RoomService) AdminIssueToken(ctx context.Context, appId, userId string, ttl time.Duration) (*AccessToken, error) {
+	app, found := rs.apps[appId]
+	if !found {
+		return nil, xerrors.Errorf("Unknown appId: %v", appId)
+	}
+	if userId == "" {
+		return nil, WithType(xerrors.Errorf("empty user_id"), ErrArgument)
+	}
+	if ttl <= 0 {
+		ttl = time.Duration(rs.conf.TokenTTL)
+	}
+
+	// 失効させた直後に発行したものが拒否されないよう、キャッシュではなくDBから取得する
+	var revokedAt int64
+	err := rs.db.GetContext(ctx, &revokedAt,
+		"SELECT revoked_at FROM revoked_user WHERE app_id = ? AND user_id = ?", appId, userId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, xerrors.Errorf("select revoked_user: %w", err)
+	}
+
+	token, err := NewAccessToken(appId, app.Key, userId, time.Now(), ttl, time.Duration(rs.conf.AuthDataExpire), time.Unix(revokedAt, 0))
+	if errors.Is(err, errRevokedRecently) {
+		return nil, WithType(err, ErrArgument)
+	}
+	return token, err
+}
+
+// AdminRevoke : userIdにこれまでに発行したbearerを失効させる
+func (rs *RoomService) AdminRevoke(ctx context.Context, appId, userId string) error {
+	if _, found := rs.apps[appId]; !found {
+		return xerrors.Errorf("Unknown appId: %v", appId)
+	}
+	if userId == "" {
+		return WithType(xerrors.Errorf("empty user_id"), ErrArgument)
+	}
+
+	now := time.Now()
+	const q = "INSERT INTO revoked_user (`app_id`, `user_id`, `revoked_at`) VALUES (?, ?, ?) " +
+		"ON DUPLICATE KEY UPDATE `revoked_at`=VALUES(`revoked_at`)"
+	if _, err := rs.db.ExecContext(ctx, q, appId, userId, now.Unix()); err != nil {
+		return xerrors.Errorf("insert revoked_user: %w", err)
+	}
+
+	// 期限切れのbearerしか拒否しない古い行は削除しておく
+	expired := now.Add(-time.Duration(rs.conf.AuthDataExpire)).Unix()
+	if _, err := rs.db.ExecContext(ctx, "DELETE FROM revoked_user WHERE revoked_at < ?", expired); err != nil {
+		return xerrors.Errorf("delete revoked_user: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package lobby
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"wsnet2/auth"
+)
+
+func TestNewAccessToken(t *testing.T) {
+	const key = "testappkey"
+	expire := time.Minute
+	now := time.Now()
+
+	token, err := NewAccessToken("app", key, "user1", now, 10*time.Second, expire, time.Time{})
+	if err != nil {
+		t.Fatalf("NewAccessToken: %+v", err)
+	}
+	if wants := now.Add(10 * time.Second).Unix(); token.ExpireAt != wants {
+		t.Errorf("ExpireAt = %v, wants %v", token.ExpireAt, wants)
+	}
+	if mk, err := auth.DecryptMACKey(key, token.EncMACKey); err != nil || mk != token.MACKey {
+		t.Errorf("DecryptMACKey = %q, %v, wants %q", mk, err, token.MACKey)
+	}
+
+	// Lobbyはauthdata_expireで検証するが、ttlで失効する
+	if err := auth.ValidAuthData(token.Bearer, key, "user1", now.Add(-expire)); err != nil {
+		t.Errorf("ValidAuthData: %+v", err)
+	}
+	later := now.Add(11 * time.Second)
+	if err := auth.ValidAuthData(token.Bearer, key, "user1", later.Add(-expire)); !errors.Is(err, auth.ErrExpired) {
+		t.Errorf("ValidAuthData after ttl = %v, wants %v", err, auth.ErrExpired)
+	}
+
+	// 失効させた時刻以前のtimestampになるttlでは、有効期限を延ばさずにエラーとする
+	revoked := now.Add(-5 * time.Second).Truncate(time.Second)
+	if _, err := NewAccessToken("app", key, "user1", now, 10*time.Second, expire, revoked); !errors.Is(err, errRevokedRecently) {
+		t.Fatalf("NewAccessToken after revoked = %v, wants %v", err, errRevokedRecently)
+	}
+	token, err = NewAccessToken("app", key, "user1", now, expire, expire, revoked)
+	if err != nil {
+		t.Fatalf("NewAccessToken: %+v", err)
+	}
+	if issued, err := auth.AuthDataTime(token.Bearer); err != nil || !issued.After(revoked) {
+		t.Errorf("AuthDataTime = %v, %v, wants after %v", issued, err, revoked)
+	}
+}
+
+func TestRevocationCache(t *testing.T) {
+	revoked := time.Unix(time.Now().Unix(), 0)
+	c := newRevocationCache(nil, time.Hour, time.Hour)
+	c.revoked[revokedUser{"app", "user1"}] = revoked
+	c.lastUpdated = time.Now()
+
+	tests := map[string]struct {
+		userId string
+		issued time.Time
+		wants  bool
+	}{
+		"before":      {"user1", revoked.Add(-time.Second), true},
+		"same second": {"user1", revoked, true},
+		"after":       {"user1", revoked.Add(time.Second), false},
+		"other user":  {"user2", revoked.Add(-time.Second), false},
+	}
+	for name, tc := range tests {
+		got, err := c.Revoked("app", tc.userId, tc.issued)
+		if err != nil {
+			t.Fatalf("%v: Revoked: %v", name, err)
+		}
+		if got != tc.wants {
+			t.Errorf("%v: Revoked = %v, wants %v", name, got, tc.wants)
+		}
+	}
+}
@@ -68,6 +68,10 @@ const (
 	KeyRoomNumbers = "roomNums"
 	// Search group
 	KeySearchGroup = "group"
+	// Trace ID
+	KeyTraceID = "traceId"
+	// Span ID
+	KeySpanID = "spanId"
 )
 
 var (
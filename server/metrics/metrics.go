@@ -13,10 +13,32 @@ var (
 	MessageRecv = new(expvar.Int)
 )
 
+// Prometheus形式で出力するメトリクス
+var (
+	AppRooms    = NewGaugeVec("wsnet2_app_rooms", "Number of rooms per app.", "app")
+	AppPlayers  = NewGaugeVec("wsnet2_app_players", "Number of players per app.", "app")
+	AppWatchers = NewGaugeVec("wsnet2_app_watchers", "Number of watchers per app. Game servers count the watchers via hubs too.", "app")
+
+	MessageRecvByType = NewCounterVec("wsnet2_messages_received_by_type_total", "Number of received messages by MsgType.", "type")
+	Reconnects        = NewCounter("wsnet2_websocket_reconnects_total", "Number of websocket reconnections of clients.")
+	Resyncs           = NewCounter("wsnet2_event_resyncs_total", "Number of snapshots sent to clients whose event buffer overflowed.")
+
+	SendEventsLatency = NewHistogram("wsnet2_peer_send_events_seconds", "Latency of Peer.SendEvents.", DefBuckets)
+	LobbyAPILatency   = NewHistogramVec("wsnet2_lobby_api_seconds", "Latency of lobby API by handler and response type.", DefBuckets, "handler", "type")
+	DBQueryLatency    = NewHistogramVec("wsnet2_db_query_seconds", "Latency of DB queries.", DefBuckets, "query")
+)
+
 func init() {
 	expmap.Set("conns", Conns)
 	expmap.Set("rooms", Rooms)
 	expmap.Set("hubs", Hubs)
 	expmap.Set("message_sent", MessageSent)
 	expmap.Set("message_recv", MessageRecv)
+
+	// expvarのカウンタもPrometheus形式で出力する
+	NewGaugeFunc("wsnet2_conns", "Number of websocket connections.", func() float64 { return float64(Conns.Value()) })
+	NewGaugeFunc("wsnet2_rooms", "Number of rooms.", func() float64 { return float64(Rooms.Value()) })
+	NewGaugeFunc("wsnet2_hubs", "Number of hubs.", func() float64 { return float64(Hubs.Value()) })
+	NewCounterFunc("wsnet2_messages_sent_total", "Number of sent websocket messages.", func() float64 { return float64(MessageSent.Value()) })
+	NewCounterFunc("wsnet2_messages_received_total", "Number of received websocket messages.", func() float64 { return float64(MessageRecv.Value()) })
 }
@@ -0,0 +1,382 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefBuckets : 秒単位のレイテンシ向けの既定のバケット
+var DefBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	muRegistry sync.Mutex
+	registry   []collector
+)
+
+func register(c collector) {
+	muRegistry.Lock()
+	defer muRegistry.Unlock()
+	for _, r := range registry {
+		if r.name() == c.name() {
+			panic(fmt.Sprintf("metrics: duplicated metric name: %v", c.name()))
+		}
+	}
+	registry = append(registry, c)
+}
+
+// Handler : 登録済みのメトリクスをPrometheusのテキスト形式で出力する
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w)
+	})
+}
+
+// Write : 登録済みのメトリクスをPrometheusのテキスト形式で書き出す
+func Write(w io.Writer) {
+	muRegistry.Lock()
+	cs := slices.Clone(registry)
+	muRegistry.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range cs {
+		c.write(bw)
+	}
+	bw.Flush()
+}
+
+// atomicFloat : float64をatomicに加算する
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) add(v float64) {
+	for {
+		old := f.bits.Load()
+		n := math.Float64bits(math.Float64frombits(old) + v)
+		if f.bits.CompareAndSwap(old, n) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) set(v float64) {
+	f.bits.Store(math.Float64bits(v))
+}
+
+func (f *atomicFloat) load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+// Counter : 単調増加する値
+type Counter struct {
+	v atomicFloat
+}
+
+func (c *Counter) Inc() {
+	c.v.add(1)
+}
+
+// Add : vは負であってはならない
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.v.add(v)
+}
+
+// Gauge : 増減する値
+type Gauge struct {
+	v atomicFloat
+}
+
+func (g *Gauge) Set(v float64) {
+	g.v.set(v)
+}
+
+func (g *Gauge) Add(v float64) {
+	g.v.add(v)
+}
+
+func (g *Gauge) Inc() {
+	g.v.add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.v.add(-1)
+}
+
+// Histogram : 観測値の分布
+type Histogram struct {
+	upper  []float64
+	counts []atomic.Uint64
+	count  atomic.Uint64
+	sum    atomicFloat
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		upper:  buckets,
+		counts: make([]atomic.Uint64, len(buckets)),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	if i, _ := slices.BinarySearch(h.upper, v); i < len(h.upper) {
+		h.counts[i].Add(1)
+	}
+	h.count.Add(1)
+	h.sum.add(v)
+}
+
+// ObserveSince : startからの経過秒数を観測する
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// vec : ラベル値の組毎の値を保持する
+type vec[T any] struct {
+	desc
+	labels []string
+	newT   func() *T
+	writeT func(w io.Writer, name, labels string, v *T)
+
+	mu     sync.RWMutex
+	values map[string]*T
+	lvs    map[string][]string
+}
+
+type desc struct {
+	fqName string
+	help   string
+	typ    string
+}
+
+func (d *desc) name() string {
+	return d.fqName
+}
+
+func newVec[T any](d desc, labels []string, newT func() *T, writeT func(io.Writer, string, string, *T)) *vec[T] {
+	v := &vec[T]{
+		desc:   d,
+		labels: labels,
+		newT:   newT,
+		writeT: writeT,
+		values: make(map[string]*T),
+		lvs:    make(map[string][]string),
+	}
+	register(v)
+	return v
+}
+
+func (v *vec[T]) with(lvs []string) *T {
+	if len(lvs) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %v requires %d label values: %v", v.fqName, len(v.labels), lvs))
+	}
+	key := strings.Join(lvs, "\xff")
+
+	v.mu.RLock()
+	t, ok := v.values[key]
+	v.mu.RUnlock()
+	if ok {
+		return t
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if t, ok := v.values[key]; ok {
+		return t
+	}
+	t = v.newT()
+	v.values[key] = t
+	v.lvs[key] = slices.Clone(lvs)
+	return t
+}
+
+func (v *vec[T]) write(w io.Writer) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if len(v.values) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "# HELP %s %s\n", v.fqName, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.fqName, v.typ)
+
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		v.writeT(w, v.fqName, formatLabels(v.labels, v.lvs[k]), v.values[k])
+	}
+}
+
+// CounterVec : ラベル付きのCounter
+type CounterVec struct {
+	*vec[Counter]
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{newVec(desc{name, help, "counter"}, labels,
+		func() *Counter { return &Counter{} },
+		func(w io.Writer, name, labels string, c *Counter) {
+			fmt.Fprintf(w, "%s%s %s\n", name, labels, formatValue(c.v.load()))
+		})}
+}
+
+// With : ラベル値に対応するCounter
+func (v *CounterVec) With(lvs ...string) *Counter {
+	return v.with(lvs)
+}
+
+// NewCounter : ラベル無しのCounter
+func NewCounter(name, help string) *Counter {
+	return NewCounterVec(name, help).With()
+}
+
+// GaugeVec : ラベル付きのGauge
+type GaugeVec struct {
+	*vec[Gauge]
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{newVec(desc{name, help, "gauge"}, labels,
+		func() *Gauge { return &Gauge{} },
+		func(w io.Writer, name, labels string, g *Gauge) {
+			fmt.Fprintf(w, "%s%s %s\n", name, labels, formatValue(g.v.load()))
+		})}
+}
+
+// With : ラベル値に対応するGauge
+func (v *GaugeVec) With(lvs ...string) *Gauge {
+	return v.with(lvs)
+}
+
+// NewGauge : ラベル無しのGauge
+func NewGauge(name, help string) *Gauge {
+	return NewGaugeVec(name, help).With()
+}
+
+// HistogramVec : ラベル付きのHistogram
+type HistogramVec struct {
+	*vec[Histogram]
+}
+
+// NewHistogramVec : bucketsは昇順でなければならない
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if !slices.IsSorted(buckets) {
+		panic(fmt.Sprintf("metrics: buckets of %v must be sorted: %v", name, buckets))
+	}
+	return &HistogramVec{newVec(desc{name, help, "histogram"}, labels,
+		func() *Histogram { return newHistogram(buckets) },
+		writeHistogram)}
+}
+
+// With : ラベル値に対応するHistogram
+func (v *HistogramVec) With(lvs ...string) *Histogram {
+	return v.with(lvs)
+}
+
+// NewHistogram : ラベル無しのHistogram
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return NewHistogramVec(name, help, buckets).With()
+}
+
+func writeHistogram(w io.Writer, name, labels string, h *Histogram) {
+	// 書き込み中にObserveされてもcountとbucketの整合が取れるよう先にcountを読む
+	count := h.count.Load()
+	sum := h.sum.load()
+
+	var cum uint64
+	for i, le := range h.upper {
+		cum += h.counts[i].Load()
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, appendLabel(labels, "le", formatValue(le)), min(cum, count))
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, appendLabel(labels, "le", "+Inf"), count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatValue(sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, count)
+}
+
+// funcCollector : 出力時に関数を呼び出して値を取得する
+type funcCollector struct {
+	desc
+	f func() float64
+}
+
+func (c *funcCollector) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", c.fqName, escapeHelp(c.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", c.fqName, c.typ)
+	fmt.Fprintf(w, "%s %s\n", c.fqName, formatValue(c.f()))
+}
+
+// NewGaugeFunc : 出力時にfの値をGaugeとして出力する
+func NewGaugeFunc(name, help string, f func() float64) {
+	register(&funcCollector{desc{name, help, "gauge"}, f})
+}
+
+// NewCounterFunc : 出力時にfの値をCounterとして出力する
+func NewCounterFunc(name, help string, f func() float64) {
+	register(&funcCollector{desc{name, help, "counter"}, f})
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, `%s="%s"`, n, labelEscaper.Replace(values[i]))
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func appendLabel(labels, name, value string) string {
+	l := fmt.Sprintf(`%s="%s"`, name, value)
+	if labels == "" {
+		return "{" + l + "}"
+	}
+	return labels[:len(labels)-1] + "," + l + "}"
+}
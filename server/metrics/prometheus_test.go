@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	muRegistry.Lock()
+	saved := registry
+	registry = nil
+	muRegistry.Unlock()
+	defer func() {
+		muRegistry.Lock()
+		registry = saved
+		muRegistry.Unlock()
+	}()
+
+	cv := NewCounterVec("test_counter_total", "Test counter.", "app", "type")
+	cv.With("app1", "msg").Inc()
+	cv.With("app1", "msg").Add(2)
+	cv.With(`a"b`, "x\ny").Inc()
+
+	g := NewGauge("test_gauge", "Test\ngauge.")
+	g.Set(5)
+	g.Dec()
+
+	h := NewHistogramVec("test_seconds", "Test histogram.", []float64{0.1, 1}, "handler")
+	h.With("create").Observe(0.05)
+	h.With("create").Observe(0.5)
+	h.With("create").Observe(2)
+
+	NewGaugeFunc("test_func", "Test func.", func() float64 { return 1.5 })
+
+	NewCounterVec("test_empty_total", "No values.", "app")
+
+	var buf bytes.Buffer
+	Write(&buf)
+
+	want := strings.Join([]string{
+		`# HELP test_counter_total Test counter.`,
+		`# TYPE test_counter_total counter`,
+		`test_counter_total{app="a\"b",type="x\ny"} 1`,
+		`test_counter_total{app="app1",type="msg"} 3`,
+		`# HELP test_gauge Test\ngauge.`,
+		`# TYPE test_gauge gauge`,
+		`test_gauge 4`,
+		`# HELP test_seconds Test histogram.`,
+		`# TYPE test_seconds histogram`,
+		`test_seconds_bucket{handler="create",le="0.1"} 1`,
+		`test_seconds_bucket{handler="create",le="1"} 2`,
+		`test_seconds_bucket{handler="create",le="+Inf"} 3`,
+		`test_seconds_sum{handler="create"} 2.55`,
+		`test_seconds_count{handler="create"} 3`,
+		`# HELP test_func Test func.`,
+		`# TYPE test_func gauge`,
+		`test_func 1.5`,
+		``,
+	}, "\n")
+
+	if got := buf.String(); got != want {
+		t.Errorf("output mismatch:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -6,8 +6,15 @@ CREATE TABLE `game_server` (
   `public_name` VARCHAR(191) NOT NULL,
   `grpc_port`   INTEGER NOT NULL,
   `ws_port`     INTEGER NOT NULL,
+  `region`      VARCHAR(191) NOT NULL DEFAULT '',
   `status`      TINYINT NOT NULL,
   `heartbeat`   BIGINT,
+  `rooms`       INTEGER UNSIGNED NOT NULL DEFAULT 0,
+  `clients`     INTEGER UNSIGNED NOT NULL DEFAULT 0,
+  `capacity`    DOUBLE NOT NULL DEFAULT 0,
+  `watchers`    INTEGER UNSIGNED NOT NULL DEFAULT 0,
+  `goroutines`  INTEGER UNSIGNED NOT NULL DEFAULT 0,
+  `msg_backlog` INTEGER UNSIGNED NOT NULL DEFAULT 0,
   UNIQUE KEY `idx_hostname` (`hostname`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
@@ -18,8 +25,13 @@ CREATE TABLE `hub_server` (
   `public_name` VARCHAR(191) NOT NULL,
   `grpc_port`   INTEGER NOT NULL,
   `ws_port`     INTEGER NOT NULL,
+  `region`      VARCHAR(191) NOT NULL DEFAULT '',
   `status`      TINYINT NOT NULL,
   `heartbeat`   BIGINT,
+  `rooms`       INTEGER UNSIGNED NOT NULL DEFAULT 0,
+  `watchers`    INTEGER UNSIGNED NOT NULL DEFAULT 0,
+  `goroutines`  INTEGER UNSIGNED NOT NULL DEFAULT 0,
+  `msg_backlog` INTEGER UNSIGNED NOT NULL DEFAULT 0,
   UNIQUE KEY `idx_hostname` (`hostname`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
@@ -27,7 +39,15 @@ DROP TABLE IF EXISTS `app`;
 CREATE TABLE app (
   `id`   VARCHAR(32) COLLATE ascii_bin PRIMARY KEY,
   `name` VARCHAR(191) COLLATE utf8mb4_bin,
-  `key`  VARCHAR(191) COLLATE ascii_bin
+  `key`  VARCHAR(191) COLLATE ascii_bin,
+  `max_rooms`       INTEGER UNSIGNED NOT NULL DEFAULT 0,
+  `max_players`     INTEGER UNSIGNED NOT NULL DEFAULT 0,
+  `max_watchers`    INTEGER UNSIGNED NOT NULL DEFAULT 0,
+  `max_props_bytes` INTEGER UNSIGNED NOT NULL DEFAULT 0,
+  `max_msg_rate`    INTEGER UNSIGNED NOT NULL DEFAULT 0,
+  `max_lifetime`    INTEGER UNSIGNED NOT NULL DEFAULT 0,
+  `idle_timeout`    INTEGER UNSIGNED NOT NULL DEFAULT 0,
+  `empty_grace`     INTEGER UNSIGNED NOT NULL DEFAULT 0
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
 DROP TABLE IF EXISTS `room`;
@@ -49,6 +69,25 @@ CREATE TABLE room (
   KEY `idx_search_group` (`app_id`, `search_group`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
+DROP TABLE IF EXISTS `persistent_room`;
+CREATE TABLE `persistent_room` (
+  `id`     VARCHAR(32) PRIMARY KEY,
+  `app_id` VARCHAR(32) NOT NULL,
+  `host_id` INTEGER UNSIGNED NOT NULL DEFAULT 0,
+  `visible` TINYINT NOT NULL,
+  `joinable` TINYINT NOT NULL,
+  `watchable` TINYINT NOT NULL,
+  `search_group` INTEGER UNSIGNED NOT NULL,
+  `max_players` INTEGER UNSIGNED NOT NULL,
+  `props` BLOB,
+  `private_props` BLOB,
+  `room_option` BLOB,
+  `created` DATETIME,
+  `updated` DATETIME,
+  KEY `idx_search_group` (`app_id`, `search_group`),
+  KEY `idx_host_id` (`host_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
 DROP TABLE IF EXISTS `room_history`;
 CREATE TABLE `room_history` (
   `id` BIGINT UNSIGNED PRIMARY KEY AUTO_INCREMENT,
@@ -62,6 +101,7 @@ CREATE TABLE `room_history` (
   `private_props` BLOB,
   `created` DATETIME,
   `closed` DATETIME,
+  `close_reason` VARCHAR(191) NOT NULL DEFAULT '',
   KEY `room_id` (`room_id`),
   KEY `created` (`created`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -77,6 +117,32 @@ CREATE TABLE player_log (
   KEY `player_id` (`player_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
+DROP TABLE IF EXISTS `room_result`;
+CREATE TABLE room_result (
+  `id`          BIGINT UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+  `app_id`      VARCHAR(32) NOT NULL,
+  `room_id`     VARCHAR(32) NOT NULL,
+  `agreed`      TINYINT(1) NOT NULL,
+  `result`      TEXT,
+  `submissions` TEXT,
+  `created`     DATETIME,
+  KEY `room_id` (`room_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `room_event`;
+CREATE TABLE room_event (
+  `id`        BIGINT UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+  `type`      VARCHAR(32) NOT NULL,
+  `datetime`  DATETIME,
+  `app_id`    VARCHAR(32) NOT NULL,
+  `room_id`   VARCHAR(32) NOT NULL,
+  `host_id`   INTEGER UNSIGNED NOT NULL,
+  `client_id` VARCHAR(32) NOT NULL DEFAULT '',
+  `data`      TEXT,
+  KEY `room_id` (`room_id`),
+  KEY `datetime` (`datetime`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
 DROP TABLE IF EXISTS `hub`;
 CREATE TABLE hub (
   `id`      BIGINT UNSIGNED PRIMARY KEY AUTO_INCREMENT,
@@ -86,3 +152,33 @@ CREATE TABLE hub (
   `created` DATETIME NOT NULL,
   UNIQUE KEY `idx_room` (`room_id`, `host_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `admin_log`;
+CREATE TABLE admin_log (
+  `id`          BIGINT UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+  `subject`     VARCHAR(191) NOT NULL,
+  `app_id`      VARCHAR(32) NOT NULL,
+  `action`      VARCHAR(32) NOT NULL,
+  `param`       TEXT,
+  `remote_addr` VARCHAR(191),
+  `result`      VARCHAR(191) NOT NULL,
+  `datetime`    DATETIME,
+  KEY `subject` (`subject`),
+  KEY `datetime` (`datetime`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `maintenance`;
+CREATE TABLE maintenance (
+  `app_id`   VARCHAR(32) COLLATE ascii_bin PRIMARY KEY,
+  `start_at` DATETIME NOT NULL,
+  `end_at`   DATETIME NOT NULL,
+  `message`  VARCHAR(191) NOT NULL DEFAULT ''
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `revoked_user`;
+CREATE TABLE revoked_user (
+  `app_id`     VARCHAR(32) COLLATE ascii_bin NOT NULL,
+  `user_id`    VARCHAR(191) COLLATE utf8mb4_bin NOT NULL,
+  `revoked_at` BIGINT NOT NULL,
+  PRIMARY KEY (`app_id`, `user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,122 @@
+package trace
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"wsnet2/config"
+	"wsnet2/log"
+)
+
+// SpanData : Exporterに渡される終了したSpan
+type SpanData struct {
+	TraceID  string         `json:"trace_id"`
+	SpanID   string         `json:"span_id"`
+	ParentID string         `json:"parent_id,omitempty"`
+	Name     string         `json:"name"`
+	Service  string         `json:"service"`
+	Start    time.Time      `json:"start"`
+	Duration float64        `json:"duration"` // 秒
+	Attrs    map[string]any `json:"attrs,omitempty"`
+	Links    []SpanLink     `json:"links,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// SpanLink : 親子関係にない関連するSpan
+type SpanLink struct {
+	TraceID string `json:"trace_id"`
+	SpanID  string `json:"span_id"`
+}
+
+// Exporter : 終了したSpanの出力先
+type Exporter interface {
+	Export(span *SpanData)
+}
+
+type noopExporter struct{}
+
+func (noopExporter) Export(*SpanData) {}
+
+// JSONExporter : SpanをJSON Lines形式で書き出す
+type JSONExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	return &JSONExporter{w: w}
+}
+
+func (e *JSONExporter) Export(span *SpanData) {
+	b, err := json.Marshal(span)
+	if err != nil {
+		log.Errorf("trace: marshal span: %+v", err)
+		return
+	}
+	b = append(b, '\n')
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.w.Write(b); err != nil {
+		log.Errorf("trace: write span: %+v", err)
+	}
+}
+
+type exporterHolder struct {
+	Exporter
+}
+
+var (
+	exporter    atomic.Pointer[exporterHolder]
+	serviceName string
+)
+
+func init() {
+	exporter.Store(&exporterHolder{noopExporter{}})
+}
+
+// SetExporter : Spanの出力先を設定する. nilなら出力しない
+func SetExporter(e Exporter) {
+	if e == nil {
+		e = noopExporter{}
+	}
+	exporter.Store(&exporterHolder{e})
+}
+
+func getExporter() Exporter {
+	return exporter.Load().Exporter
+}
+
+// Init : 設定に従ってExporterを初期化する. 戻り値の関数で出力先を閉じる
+//   - "": 出力しない
+//   - "stdout": 標準出力にJSON Lines形式で出力
+//   - "file": trace_pathのファイルにJSON Lines形式で出力
+func Init(service string, conf *config.TraceConf) (func(), error) {
+	serviceName = service
+
+	switch conf.TraceExporter {
+	case "":
+		SetExporter(nil)
+		return func() {}, nil
+	case "stdout":
+		SetExporter(NewJSONExporter(os.Stdout))
+		return func() {}, nil
+	case "file":
+		f, err := os.OpenFile(conf.TracePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, xerrors.Errorf("open trace file: %w", err)
+		}
+		SetExporter(NewJSONExporter(f))
+		return func() {
+			SetExporter(nil)
+			f.Close()
+		}, nil
+	}
+	return nil, xerrors.Errorf("unknown trace exporter: %q", conf.TraceExporter)
+}
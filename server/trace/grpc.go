@@ -0,0 +1,46 @@
+package trace
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryClientInterceptor : gRPC呼び出しのSpanを記録し、メタデータでトレースコンテキストを伝搬する
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := Start(ctx, "grpc.client "+method)
+		defer span.End()
+		span.SetAttr("target", cc.Target())
+
+		ctx = metadata.AppendToOutgoingContext(ctx, MetadataKey, span.SpanContext().Traceparent())
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err != nil {
+			span.SetAttr("code", status.Code(err).String())
+			span.SetError(err)
+		}
+		return err
+	}
+}
+
+// UnaryServerInterceptor : メタデータからトレースコンテキストを取り出してgRPCハンドラのSpanを記録する
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if v := md.Get(MetadataKey); len(v) > 0 {
+				ctx = Extract(ctx, v[0])
+			}
+		}
+		ctx, span := Start(ctx, "grpc.server "+info.FullMethod)
+		defer span.End()
+
+		res, err := handler(ctx, req)
+		if err != nil {
+			span.SetAttr("code", status.Code(err).String())
+			span.SetError(err)
+		}
+		return res, err
+	}
+}
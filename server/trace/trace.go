@@ -0,0 +1,248 @@
+// Package trace : lobby, game, hubを跨いだ分散トレーシング.
+//
+// トレースコンテキストはW3C Trace Contextのtraceparent形式で
+// HTTPヘッダ(Wsnet2-Trace)とgRPCメタデータ(wsnet2-trace)で伝搬する.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"wsnet2/log"
+)
+
+const (
+	// Header : トレースコンテキストを伝搬するHTTPヘッダ
+	Header = "Wsnet2-Trace"
+
+	// MetadataKey : トレースコンテキストを伝搬するgRPCメタデータ
+	MetadataKey = "wsnet2-trace"
+)
+
+type TraceID [16]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+type SpanID [8]byte
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// SpanContext : プロセスを跨いで伝搬するSpanの識別子
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent : W3C Trace Contextのtraceparent形式
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", sc.TraceID, sc.SpanID)
+}
+
+// ParseTraceparent : traceparent形式の文字列をSpanContextに変換する
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	f := strings.Split(s, "-")
+	if len(f) != 4 || len(f[0]) != 2 || len(f[1]) != 32 || len(f[2]) != 16 || len(f[3]) != 2 {
+		return sc, xerrors.Errorf("invalid traceparent: %q", s)
+	}
+	if f[0] == "ff" {
+		return sc, xerrors.Errorf("invalid traceparent version: %q", s)
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(f[1])); err != nil {
+		return sc, xerrors.Errorf("invalid trace-id: %q: %w", s, err)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(f[2])); err != nil {
+		return sc, xerrors.Errorf("invalid parent-id: %q: %w", s, err)
+	}
+	if !sc.IsValid() {
+		return sc, xerrors.Errorf("invalid traceparent: %q", s)
+	}
+	return sc, nil
+}
+
+// Span : 処理の区間
+// nilのSpanのメソッドは何もしない.
+type Span struct {
+	mu     sync.Mutex
+	name   string
+	sc     SpanContext
+	parent SpanID
+	start  time.Time
+	attrs  map[string]any
+	links  []SpanContext
+	err    string
+	ended  bool
+}
+
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetName : Span名を変更する. 開始時に名前が決まらない場合に使う
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attrs == nil {
+		s.attrs = make(map[string]any)
+	}
+	s.attrs[key] = value
+}
+
+// AddLink : 親子関係にない関連するSpanを記録する.
+// 別のトレースで開始した処理と、そのきっかけになったリクエストを結びつけるのに使う
+func (s *Span) AddLink(sc SpanContext) {
+	if s == nil || !sc.IsValid() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.links = append(s.links, sc)
+}
+
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// End : Spanを終了してExporterに出力する. 2回目以降の呼び出しは無視される
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	d := &SpanData{
+		TraceID:  s.sc.TraceID.String(),
+		SpanID:   s.sc.SpanID.String(),
+		Name:     s.name,
+		Service:  serviceName,
+		Start:    s.start,
+		Duration: time.Since(s.start).Seconds(),
+		Attrs:    s.attrs,
+		Error:    s.err,
+	}
+	if s.parent.IsValid() {
+		d.ParentID = s.parent.String()
+	}
+	for _, l := range s.links {
+		d.Links = append(d.Links, SpanLink{TraceID: l.TraceID.String(), SpanID: l.SpanID.String()})
+	}
+	s.mu.Unlock()
+
+	getExporter().Export(d)
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// Start : ctxのSpanを親とするSpanを開始する.
+// ctxにSpanが無ければ新しいトレースを開始する.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent := SpanContextFromContext(ctx)
+
+	s := &Span{
+		name:  name,
+		start: time.Now(),
+	}
+	if parent.IsValid() {
+		s.sc.TraceID = parent.TraceID
+		s.parent = parent.SpanID
+	} else {
+		rand.Read(s.sc.TraceID[:])
+	}
+	rand.Read(s.sc.SpanID[:])
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SpanFromContext : ctxのSpan. 無ければnil
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SpanContextFromContext : ctxのSpanか、他プロセスから伝搬したSpanContext
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.sc
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// Inject : 伝搬用のtraceparent文字列. ctxにSpanが無ければ空文字列
+func Inject(ctx context.Context) string {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+	return sc.Traceparent()
+}
+
+// Extract : 伝搬されたtraceparent文字列をctxに設定する.
+// 不正な文字列は無視する.
+func Extract(ctx context.Context, traceparent string) context.Context {
+	if traceparent == "" {
+		return ctx
+	}
+	sc, err := ParseTraceparent(traceparent)
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// LoggerWith : loggerにctxのtrace/span IDを付与する
+func LoggerWith(ctx context.Context, logger log.Logger) log.Logger {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return logger
+	}
+	return logger.With(log.KeyTraceID, sc.TraceID.String(), log.KeySpanID, sc.SpanID.String())
+}
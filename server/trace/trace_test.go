@@ -0,0 +1,118 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const tp = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	sc, err := ParseTraceparent(tp)
+	if err != nil {
+		t.Fatalf("ParseTraceparent(%q): %v", tp, err)
+	}
+	if got := sc.TraceID.String(); got != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("TraceID = %v", got)
+	}
+	if got := sc.SpanID.String(); got != "b7ad6b7169203331" {
+		t.Errorf("SpanID = %v", got)
+	}
+	if got := sc.Traceparent(); got != tp {
+		t.Errorf("Traceparent() = %v, wants %v", got, tp)
+	}
+
+	invalids := []string{
+		"",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331",
+		"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01",
+		"00-0af7651916cd43dd8448eb211c80319x-b7ad6b7169203331-01",
+	}
+	for _, s := range invalids {
+		if _, err := ParseTraceparent(s); err == nil {
+			t.Errorf("ParseTraceparent(%q) wants error", s)
+		}
+	}
+}
+
+func TestStart(t *testing.T) {
+	var buf bytes.Buffer
+	SetExporter(NewJSONExporter(&buf))
+	defer SetExporter(nil)
+
+	const tp = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	ctx := Extract(context.Background(), tp)
+
+	ctx, parent := Start(ctx, "parent")
+	_, child := Start(ctx, "child")
+
+	if parent.SpanContext().TraceID.String() != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("parent trace id = %v", parent.SpanContext().TraceID)
+	}
+	if child.SpanContext().TraceID != parent.SpanContext().TraceID {
+		t.Errorf("child trace id = %v, wants %v", child.SpanContext().TraceID, parent.SpanContext().TraceID)
+	}
+	if got := Inject(ctx); got != parent.SpanContext().Traceparent() {
+		t.Errorf("Inject() = %v, wants %v", got, parent.SpanContext().Traceparent())
+	}
+
+	child.SetAttr("room", "room1")
+	child.End()
+	child.End() // 2回目は出力しない
+	parent.End()
+
+	dec := json.NewDecoder(&buf)
+	var spans []SpanData
+	for dec.More() {
+		var d SpanData
+		if err := dec.Decode(&d); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		spans = append(spans, d)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("exported spans = %v, wants 2", len(spans))
+	}
+	if spans[0].Name != "child" || spans[0].ParentID != parent.SpanContext().SpanID.String() || spans[0].Attrs["room"] != "room1" {
+		t.Errorf("child span = %+v", spans[0])
+	}
+	if spans[1].Name != "parent" || spans[1].ParentID != "b7ad6b7169203331" {
+		t.Errorf("parent span = %+v", spans[1])
+	}
+}
+
+func TestNewTrace(t *testing.T) {
+	ctx, span := Start(context.Background(), "root")
+	if !span.SpanContext().IsValid() {
+		t.Errorf("invalid span context: %v", span.SpanContext())
+	}
+	if Inject(context.Background()) != "" {
+		t.Errorf("Inject() without span wants empty")
+	}
+
+	var buf bytes.Buffer
+	SetExporter(NewJSONExporter(&buf))
+	defer SetExporter(nil)
+
+	// 別トレースで開始してリクエストのSpanをリンクする
+	_, linked := Start(context.Background(), "linked")
+	linked.AddLink(SpanContextFromContext(ctx))
+	linked.AddLink(SpanContext{}) // 無効なものは無視する
+	linked.End()
+
+	if linked.SpanContext().TraceID == span.SpanContext().TraceID {
+		t.Errorf("linked span wants a new trace: %v", linked.SpanContext().TraceID)
+	}
+	var d SpanData
+	if err := json.NewDecoder(&buf).Decode(&d); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	wants := []SpanLink{{TraceID: span.SpanContext().TraceID.String(), SpanID: span.SpanContext().SpanID.String()}}
+	if d.ParentID != "" || !reflect.DeepEqual(d.Links, wants) {
+		t.Errorf("linked span = %+v, wants links %v", d, wants)
+	}
+}
@@ -280,6 +280,11 @@ namespace WSNet2
                             onPong(ev as EvPong);
                             room.handleEvent(ev);
                             break;
+                        case EvType.Snapshot:
+                            // 以降のEventはスナップショットの通番の続きから届く
+                            evSeqNum = (ev as EvSnapshot).Seq;
+                            room.handleEvent(ev);
+                            break;
                         default:
                             room.handleEvent(ev);
                             break;
@@ -0,0 +1,19 @@
+﻿namespace WSNet2
+{
+    /// <summary>
+    ///   サーバからのお知らせ
+    /// </summary>
+    public class EvNotice : Event
+    {
+        /// <summary>お知らせ本文</summary>
+        public string Message { get; private set; }
+
+        /// <summary>
+        ///   コンストラクタ
+        /// </summary>
+        public EvNotice(SerialReader reader) : base(EvType.Notice, reader)
+        {
+            Message = reader.ReadString();
+        }
+    }
+}
@@ -0,0 +1,63 @@
+﻿using System.Collections.Generic;
+
+namespace WSNet2
+{
+    /// <summary>
+    ///   部屋の全状態
+    /// </summary>
+    /// <remarks>
+    ///   <para>
+    ///     受信が遅れてサーバのイベントバッファが溢れたときに届く。
+    ///     以降のイベントはSeqの続きから届く。
+    ///   </para>
+    /// </remarks>
+    public class EvSnapshot : Event
+    {
+        /// <summary>直前のイベントの通し番号</summary>
+        public uint Seq { get; private set; }
+
+        /// <summary>MasterのID</summary>
+        public string MasterID { get; private set; }
+
+        /// <summary>プレイヤーID => プロパティ</summary>
+        public Dictionary<string, Dictionary<string, object>> Players { get; private set; }
+
+        public bool Visible;
+        public bool Joinable;
+        public bool Watchable;
+        public uint SearchGroup;
+        public ushort MaxPlayers;
+        public ushort ClientDeadline;
+        public Dictionary<string, object> PublicProps;
+        public Dictionary<string, object> PrivateProps;
+
+        /// <summary>
+        ///   コンストラクタ
+        /// </summary>
+        public EvSnapshot(SerialReader reader) : base(EvType.Snapshot, reader)
+        {
+            Seq = reader.ReadUInt();
+            MasterID = reader.ReadString();
+
+            var players = reader.ReadDict();
+            Players = new Dictionary<string, Dictionary<string, object>>(players.Count);
+            foreach (var kv in players)
+            {
+                Players[kv.Key] = kv.Value as Dictionary<string, object> ?? new Dictionary<string, object>();
+            }
+
+            // プレイヤーのprivate propsは未対応なので読み飛ばす
+            _ = reader.ReadDict();
+
+            var flags = reader.ReadByte();
+            Visible = (flags & 1) != 0;
+            Joinable = (flags & 2) != 0;
+            Watchable = (flags & 4) != 0;
+            SearchGroup = reader.ReadUInt();
+            MaxPlayers = reader.ReadUShort();
+            ClientDeadline = reader.ReadUShort();
+            PublicProps = reader.ReadDict();
+            PrivateProps = reader.ReadDict();
+        }
+    }
+}
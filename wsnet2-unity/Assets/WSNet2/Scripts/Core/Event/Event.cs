@@ -9,6 +9,7 @@ namespace WSNet2
     {
         PeerReady = 1,
         Pong,
+        Snapshot = 4,
 
         Joined = EvTypeExt.regularEvType,
         Left,
@@ -17,6 +18,7 @@ namespace WSNet2
         MasterSwitched,
         Message,
         Rejoined,
+        Notice,
 
         Succeeded = EvTypeExt.responseEvType,
         PermissionDenied,
@@ -76,6 +78,9 @@ namespace WSNet2
                 case EvType.Pong:
                     ev = new EvPong(reader);
                     break;
+                case EvType.Snapshot:
+                    ev = new EvSnapshot(reader);
+                    break;
 
                 case EvType.Joined:
                     ev = new EvJoined(reader);
@@ -98,6 +103,9 @@ namespace WSNet2
                 case EvType.Rejoined:
                     ev = new EvRejoined(reader);
                     break;
+                case EvType.Notice:
+                    ev = new EvNotice(reader);
+                    break;
 
                 case EvType.Succeeded:
                 case EvType.PermissionDenied:
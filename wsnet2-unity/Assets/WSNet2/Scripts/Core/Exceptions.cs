@@ -33,4 +33,20 @@ namespace WSNet2
     {
         public RoomFullException(string message) : base(message) { }
     }
+
+    /// <summary>
+    ///   アプリ毎の上限に達した例外
+    /// </summary>
+    public class QuotaExceededException : LobbyNormalException
+    {
+        public QuotaExceededException(string message) : base(message) { }
+    }
+
+    /// <summary>
+    ///   メンテナンス中で部屋を作成できなかった例外
+    /// </summary>
+    public class MaintenanceException : LobbyNormalException
+    {
+        public MaintenanceException(string message) : base(message) { }
+    }
 }
@@ -24,5 +24,7 @@ namespace WSNet2
         RoomLimit,
         NoRoomFound,
         RoomFull,
+        QuotaExceeded,
+        Maintenance,
     }
 }
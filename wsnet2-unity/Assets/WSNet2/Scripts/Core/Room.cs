@@ -105,6 +105,25 @@ namespace WSNet2
         /// </remarks>
         public Action<ulong, ulong, IReadOnlyDictionary<string, ulong>> OnPongReceived;
 
+        /// <summary>
+        ///   サーバからのお知らせ受信通知
+        /// </summary>
+        /// OnNoticeReceived(message)
+        public Action<string> OnNoticeReceived;
+
+        /// <summary>
+        ///   部屋の全状態の置き換え通知
+        /// </summary>
+        /// <remarks>
+        ///   <para>
+        ///     受信が遅れてサーバのイベントバッファが溢れたとき、
+        ///     未受信のイベントは破棄され、部屋の全状態で置き換えられます。
+        ///     破棄されたイベントのコールバックは呼ばれないので、
+        ///     Players、Master、Roomプロパティを改めて参照してください。
+        ///   </para>
+        /// </remarks>
+        public Action OnResynced;
+
         /// <summary>
         ///   接続状態変化通知
         /// </summary>
@@ -908,6 +927,9 @@ namespace WSNet2
                 case EvPong evPong:
                     OnEvPong(evPong);
                     break;
+                case EvSnapshot evSnapshot:
+                    OnEvSnapshot(evSnapshot);
+                    break;
                 case EvJoined evJoined:
                     OnEvJoined(evJoined);
                     break;
@@ -929,6 +951,9 @@ namespace WSNet2
                 case EvRPC evRpc:
                     OnEvRPC(evRpc);
                     break;
+                case EvNotice evNotice:
+                    OnEvNotice(evNotice);
+                    break;
                 case EvClosed evClosed:
                     OnEvClosed(evClosed);
                     break;
@@ -960,6 +985,68 @@ namespace WSNet2
             });
         }
 
+        /// <summary>
+        ///   全状態イベント
+        /// </summary>
+        private void OnEvSnapshot(EvSnapshot ev)
+        {
+            logger?.Info("resync with snapshot: seq={0}", ev.Seq);
+
+            if (ev.ClientDeadline > 0)
+            {
+                // ping間隔はすぐに変更しないとTimeoutする可能性がある
+                con.UpdatePingInterval(ev.ClientDeadline);
+            }
+
+            callbackPool.Add(() =>
+            {
+                info.visible = ev.Visible;
+                info.joinable = ev.Joinable;
+                info.watchable = ev.Watchable;
+                info.searchGroup = ev.SearchGroup;
+                info.maxPlayers = ev.MaxPlayers;
+                if (ev.ClientDeadline > 0)
+                {
+                    clientDeadline = ev.ClientDeadline;
+                }
+
+                publicProps = ev.PublicProps ?? new Dictionary<string, object>();
+                privateProps = ev.PrivateProps ?? new Dictionary<string, object>();
+
+                var newPlayers = new Dictionary<string, Player>(ev.Players.Count);
+                foreach (var kv in ev.Players)
+                {
+                    if (players.TryGetValue(kv.Key, out var player))
+                    {
+                        player.Props = kv.Value;
+                    }
+                    else
+                    {
+                        player = new Player(kv.Key, kv.Value);
+                    }
+                    newPlayers[kv.Key] = player;
+
+                    if (!lastMsgTimestamps.ContainsKey(kv.Key))
+                    {
+                        lastMsgTimestamps[kv.Key] = 0;
+                    }
+                }
+                foreach (var id in players.Keys)
+                {
+                    if (!newPlayers.ContainsKey(id))
+                    {
+                        lastMsgTimestamps.Remove(id);
+                    }
+                }
+
+                players = newPlayers;
+                masterId = ev.MasterID;
+                info.players = (uint)players.Count;
+
+                OnResynced?.Invoke();
+            });
+        }
+
         /// <summary>
         ///   入室イベント
         /// </summary>
@@ -1152,6 +1239,19 @@ namespace WSNet2
             });
         }
 
+        /// <summary>
+        ///   お知らせイベント
+        /// </summary>
+        private void OnEvNotice(EvNotice ev)
+        {
+            logger?.Info("notice: {0}", ev.Message);
+
+            callbackPool.Add(() =>
+            {
+                OnNoticeReceived?.Invoke(ev.Message);
+            });
+        }
+
         /// <summary>
         ///   RPCイベント
         /// </summary>
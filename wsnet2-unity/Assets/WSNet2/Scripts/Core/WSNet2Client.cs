@@ -493,6 +493,10 @@ namespace WSNet2
                         throw new RoomNotFoundException(res.msg);
                     case LobbyResponseType.RoomFull:
                         throw new RoomFullException(res.msg);
+                    case LobbyResponseType.QuotaExceeded:
+                        throw new QuotaExceededException(res.msg);
+                    case LobbyResponseType.Maintenance:
+                        throw new MaintenanceException(res.msg);
                 }
 
                 if (AdjustJoinedRoomInfo != null)